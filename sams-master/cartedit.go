@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// 修改购物车的命令，修改成功后输出最新的购物车
+
+func cartAddCommand(args []string) error {
+	var spuId, storeId string
+	quantity := 1
+	return inspect("cart-add", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&spuId, "spu", "", "必填，加入购物车的商品spuId")
+		fs.IntVar(&quantity, "quantity", quantity, "可选，增加的数量，默认1")
+		fs.StringVar(&storeId, "storeId", "", "可选，商品所属的商店，默认为floorId、deliveryType对应楼层的商店")
+	}, func(ctx context.Context, session *dd.DingdongSession) error {
+		if spuId == "" || quantity <= 0 {
+			return errors.New("spu不能为空，quantity应大于0")
+		}
+		if err := session.CheckCart(ctx); err != nil {
+			return err
+		}
+		if _, err := session.AddCartGoods(ctx, dd.CartGoods{SpuId: spuId, StoreId: storeId, IncreaseQuantity: quantity, IsSelected: true}); err != nil {
+			return err
+		}
+		printCart(session)
+		return nil
+	})
+}
+
+func cartUpdateCommand(args []string) error {
+	var spuId string
+	var quantity int
+	return inspect("cart-update", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&spuId, "spu", "", "必填，要修改数量的商品spuId")
+		fs.IntVar(&quantity, "quantity", 0, "必填，修改后的数量")
+	}, func(ctx context.Context, session *dd.DingdongSession) error {
+		if spuId == "" || quantity <= 0 {
+			return errors.New("spu不能为空，quantity应大于0")
+		}
+		if err := session.CheckCart(ctx); err != nil {
+			return err
+		}
+		if _, err := session.UpdateCartGoods(ctx, spuId, quantity); err != nil {
+			return err
+		}
+		printCart(session)
+		return nil
+	})
+}
+
+func cartSelectCommand(args []string) error {
+	var spuIds string
+	selected := true
+	return inspect("cart-select", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&spuIds, "spu", "", "必填，要勾选的商品spuId，多个用逗号分隔")
+		fs.BoolVar(&selected, "selected", selected, "可选，false时取消勾选")
+	}, func(ctx context.Context, session *dd.DingdongSession) error {
+		spus := splitSpuIds(spuIds)
+		if len(spus) == 0 {
+			return errors.New("spu不能为空")
+		}
+		if err := session.CheckCart(ctx); err != nil {
+			return err
+		}
+		if _, err := session.SelectCartGoods(ctx, selected, spus...); err != nil {
+			return err
+		}
+		printCart(session)
+		return nil
+	})
+}
+
+func cartRemoveCommand(args []string) error {
+	var spuIds string
+	return inspect("cart-remove", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&spuIds, "spu", "", "必填，要移除的商品spuId，多个用逗号分隔")
+	}, func(ctx context.Context, session *dd.DingdongSession) error {
+		spus := splitSpuIds(spuIds)
+		if len(spus) == 0 {
+			return errors.New("spu不能为空")
+		}
+		if err := session.CheckCart(ctx); err != nil {
+			return err
+		}
+		if _, err := session.RemoveCartGoods(ctx, spus...); err != nil {
+			return err
+		}
+		printCart(session)
+		return nil
+	})
+}
+
+func splitSpuIds(s string) []string {
+	return strings.FieldsFunc(s, func(c rune) bool {
+		return c == ',' || c == ' '
+	})
+}
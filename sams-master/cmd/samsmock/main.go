@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/robGoods/sams/samsmock"
+)
+
+var (
+	port     = flag.String("port", "9090", "监听端口")
+	scenario = flag.String("scenario", "", "可选，场景文件，见 samsmock/scenarios")
+)
+
+func main() {
+	flag.Parse()
+
+	var sc *samsmock.Scenario
+	if *scenario != "" {
+		var err error
+		if sc, err = samsmock.LoadScenario(*scenario); err != nil {
+			log.Fatal("加载场景失败:", err)
+		}
+		fmt.Printf("########## 加载场景: %s ##########\n", sc.Name)
+	}
+
+	fmt.Printf("模拟服务启动在 http://localhost:%s\n", *port)
+	fmt.Printf("使用 -baseUrl=http://localhost:%s -addressId=%s 运行抢购流程\n", *port, samsmock.MockAddressId)
+	if err := http.ListenAndServe(":"+*port, samsmock.NewHandler(sc)); err != nil {
+		log.Fatal("模拟服务启动失败:", err)
+	}
+}
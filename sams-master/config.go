@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+)
+
+// ConfigRequest 命令行参数、配置文件和Web配置接口共用的配置
+type ConfigRequest struct {
+	AuthToken      string  `json:"authToken"`
+	BarkId         string  `json:"barkId"`
+	FloorId        int     `json:"floorId"`
+	DeliveryType   int     `json:"deliveryType"`
+	Longitude      string  `json:"longitude"`
+	Latitude       string  `json:"latitude"`
+	DeviceId       string  `json:"deviceId"`
+	TrackInfo      string  `json:"trackInfo"`
+	PromotionId    string  `json:"promotionId"`
+	AddressId      string  `json:"addressId"`
+	AddressKeyword string  `json:"addressKeyword"`
+	AddressIds     string  `json:"addressIds"`
+	PayMethod      int     `json:"payMethod"`
+	DeliveryFee    bool    `json:"deliveryFee"`
+	StoreConf      string  `json:"storeConf"`
+	IsSelected     bool    `json:"isSelected"`
+	BaseURL        string  `json:"baseUrl"`
+	Device         string  `json:"device"`
+	DeviceFile     string  `json:"deviceFile"`
+	RateLimit      string  `json:"rateLimit"`
+	Backoff        string  `json:"backoff"`
+	MaxBackoff     string  `json:"maxBackoff"`
+	StartAt        string  `json:"startAt"`
+	LeadTime       string  `json:"leadTime"`
+	Concurrency    int     `json:"concurrency"`
+	Stagger        string  `json:"stagger"`
+	SlotOrder      string  `json:"slotOrder"`
+	SlotWeekdays   string  `json:"slotWeekdays"`
+	SlotHours      string  `json:"slotHours"`
+	ExcludeDates   string  `json:"excludeDates"`
+	MinLead        string  `json:"minLead"`
+	CapacityDays   int     `json:"capacityDays"`
+	CapacityDates  string  `json:"capacityDates"`
+	Floors         string  `json:"floors"`
+	MaxFailures    int     `json:"maxFailures"`
+	DryRun         bool    `json:"dryRun"`
+	MaxAmount      int     `json:"maxAmount"`
+	TrimPolicy     string  `json:"trimPolicy"`
+	Priorities     string  `json:"priorities"`
+	MaxWeight      float64 `json:"maxWeight"`
+	MinQuantity    string  `json:"minQuantity"`
+	PartialStock   string  `json:"partialStock"`
+	Substitutions  string  `json:"substitutions"`
+}
+
+func defaultConfigRequest() ConfigRequest {
+	return ConfigRequest{
+		FloorId:      1,
+		DeliveryType: 2,
+		PayMethod:    1,
+	}
+}
+
+// bindFlags 注册全部配置参数，默认值取自c当前的值
+func bindFlags(fs *flag.FlagSet, c *ConfigRequest) {
+	fs.StringVar(&c.AuthToken, "authToken", c.AuthToken, "必选, Sam's App HTTP头部auth-token")
+	fs.StringVar(&c.BarkId, "barkId", c.BarkId, "可选，通知用的`bark` id, 可选参数")
+	fs.IntVar(&c.FloorId, "floorId", c.FloorId, "可选，1,普通商品 2,全球购保税 3,特殊订购自提 4,大件商品 5,厂家直供商品 6,特殊订购商品 7,失效商品")
+	fs.IntVar(&c.DeliveryType, "deliveryType", c.DeliveryType, "可选，1 急速达，2， 全程配送")
+	fs.StringVar(&c.Floors, "floors", c.Floors, "可选，一次下单多个楼层，格式为 楼层[:配送方式]，如 1,4 或 1,2:1，未指定配送方式时使用deliveryType")
+	fs.IntVar(&c.MaxFailures, "maxFailures", c.MaxFailures, "可选，失败的累计次数上限，达到后放弃(多楼层时只放弃该楼层)，默认不限")
+	fs.BoolVar(&c.DryRun, "dryRun", c.DryRun, "可选，演练模式，执行到获取配送时间后输出将要提交的订单参数、配送时段、优惠券和商品，不提交订单")
+	fs.IntVar(&c.MaxAmount, "maxAmount", c.MaxAmount, "可选，订单商品总价上限(分)，超出时按trimPolicy减少商品，默认不限")
+	fs.StringVar(&c.TrimPolicy, "trimPolicy", c.TrimPolicy, "可选，超出maxAmount时减少商品的顺序，priority(默认)优先级最低的先减少，expensive单价最高的先减少")
+	fs.StringVar(&c.Priorities, "priorities", c.Priorities, "可选，商品优先级，格式为 spuId:优先级，如 spu1:must,spu2:optional；must必需(缺货时不下单)、preferred优先(默认)、optional可选(需要减少商品时先减少)")
+	fs.Float64Var(&c.MaxWeight, "maxWeight", c.MaxWeight, "可选，单笔订单限重(kg)，超出时提交订单前按商品优先级减少商品，默认急速达30kg，其他配送方式不限")
+	fs.StringVar(&c.MinQuantity, "minQuantity", c.MinQuantity, "可选，商品可接受的最少数量，格式为 spuId:数量，如 spu1:6,spu2:2，可购买数量更少时不下单该商品")
+	fs.StringVar(&c.PartialStock, "partialStock", c.PartialStock, "可选，库存不足购物车中的数量时的处理方式，accept(默认)接受可购买的数量，full要求全部数量，atleast:N至少N件；必需商品未配置minQuantity时要求全部数量")
+	fs.StringVar(&c.Substitutions, "substitutions", c.Substitutions, "可选，缺货商品的替代商品，格式为 spuId:替代spuId[*数量]|...，如 spuA:spuB*2|spuC,spuX:spuY；缺货时按顺序将第一个有货的替代商品加入购物车，*数量为原商品每件对应的替代商品数量")
+	fs.StringVar(&c.Longitude, "longitude", c.Longitude, "可选，HTTP头部longitude")
+	fs.StringVar(&c.Latitude, "latitude", c.Latitude, "可选，HTTP头部latitude")
+	fs.StringVar(&c.DeviceId, "deviceId", c.DeviceId, "可选，HTTP头部device-id")
+	fs.StringVar(&c.TrackInfo, "trackInfo", c.TrackInfo, "可选，HTTP头部track-info")
+	fs.StringVar(&c.PromotionId, "promotionId", c.PromotionId, "可选，优惠券id,多个用逗号隔开，山姆app优惠券列表接口中的'ruleId'字段")
+	fs.StringVar(&c.AddressId, "addressId", c.AddressId, "可选，地址id")
+	fs.StringVar(&c.AddressIds, "addressIds", c.AddressIds, "可选，备选地址id,多个用逗号隔开，当前地址不支持配送或门店已打烊时按顺序切换")
+	fs.StringVar(&c.AddressKeyword, "addressKeyword", c.AddressKeyword, "可选，未指定地址id时，按区县或地址关键字选择第一个匹配的地址")
+	fs.IntVar(&c.PayMethod, "payMethod", c.PayMethod, "可选，1,微信 2,支付宝")
+	fs.BoolVar(&c.DeliveryFee, "deliveryFee", c.DeliveryFee, "可选，是否免运费下单")
+	fs.StringVar(&c.StoreConf, "storeConf", c.StoreConf, "可选，加载商店信息文件名")
+	fs.BoolVar(&c.IsSelected, "isSelected", c.IsSelected, "可选，是否只选择勾选商品")
+	fs.StringVar(&c.BaseURL, "baseUrl", c.BaseURL, "可选，接口地址，默认 https://api-sams.walmartmobile.cn，可指向本地模拟服务或调试代理")
+	fs.StringVar(&c.Device, "device", c.Device, "可选，请求头设备信息名称，内置 iphone13-ios15(默认)，其他设备用deviceFile加载")
+	fs.StringVar(&c.DeviceFile, "deviceFile", c.DeviceFile, "可选，设备信息JSON文件，字段见 dd.DeviceProfile")
+	fs.StringVar(&c.RateLimit, "rateLimit", c.RateLimit, "可选，接口两次请求的最小间隔，如 commitPay=200ms,getCapacityData=1s,*=100ms")
+	fs.StringVar(&c.Backoff, "backoff", c.Backoff, "可选，被限流后的初始退避时间，默认500ms，每次连续限流翻倍")
+	fs.StringVar(&c.MaxBackoff, "maxBackoff", c.MaxBackoff, "可选，被限流后的最长退避时间，默认10s")
+	fs.StringVar(&c.StartAt, "startAt", c.StartAt, "可选，开抢时间(山姆服务器时间)，如 06:00 或 2022-04-20 06:00:00，到时间后才获取配送时间并下单")
+	fs.IntVar(&c.Concurrency, "concurrency", c.Concurrency, "可选，为前N个配送时段错开提交订单，第一个成功后不再提交并取消其余请求，默认逐个提交")
+	fs.StringVar(&c.Stagger, "stagger", c.Stagger, "可选，并发提交时相邻两次提交的间隔，默认100ms，间隔内前一个时段下单成功则不再提交、失败则立即提交下一个；为0时同时提交，更容易重复下单")
+	fs.StringVar(&c.LeadTime, "leadTime", c.LeadTime, "可选，指定startAt时准备步骤(地址、门店、购物车、结算)提前执行的时长，默认1m")
+	fs.StringVar(&c.SlotOrder, "slotOrder", c.SlotOrder, "可选，配送时段尝试顺序，earliest(默认)最早优先，latest最晚优先")
+	fs.StringVar(&c.SlotWeekdays, "slotWeekdays", c.SlotWeekdays, "可选，允许的配送星期，1-7表示周一到周日，如 1-5,7")
+	fs.StringVar(&c.SlotHours, "slotHours", c.SlotHours, "可选，允许的配送时间窗口(点)，时段需完整落在窗口内，如 9-12,18-21")
+	fs.StringVar(&c.ExcludeDates, "excludeDates", c.ExcludeDates, "可选，排除的配送日期，如 2022-04-20,2022-04-21")
+	fs.StringVar(&c.MinLead, "minLead", c.MinLead, "可选，配送时段开始时间距当前的最短时长，如 2h")
+	fs.IntVar(&c.CapacityDays, "capacityDays", c.CapacityDays, "可选，从今天起(上海时间)查询配送时间的天数，默认2")
+	fs.StringVar(&c.CapacityDates, "capacityDates", c.CapacityDates, "可选，指定查询配送时间的日期，如 2022-04-20,2022-04-21，优先于capacityDays")
+}
+
+// parseConfig 解析子命令参数，extra用于注册子命令自己的参数。
+// 指定-config时先加载配置文件，命令行参数优先于配置文件
+func parseConfig(name string, args []string, extra func(fs *flag.FlagSet)) (*flag.FlagSet, *ConfigRequest, error) {
+	c := defaultConfigRequest()
+	fs, configFile := newConfigFlagSet(name, &c, extra)
+	if err := fs.Parse(args); err != nil {
+		return fs, nil, err
+	}
+	if *configFile == "" {
+		return fs, &c, nil
+	}
+
+	c = defaultConfigRequest()
+	if err := loadConfigFile(*configFile, &c); err != nil {
+		return fs, nil, err
+	}
+	fs, _ = newConfigFlagSet(name, &c, extra)
+	if err := fs.Parse(args); err != nil {
+		return fs, nil, err
+	}
+	return fs, &c, nil
+}
+
+func newConfigFlagSet(name string, c *ConfigRequest, extra func(fs *flag.FlagSet)) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	bindFlags(fs, c)
+	configFile := fs.String("config", "", "可选，JSON配置文件，字段与Web配置接口一致，命令行参数优先")
+	if extra != nil {
+		extra(fs)
+	}
+	return fs, configFile
+}
+
+func loadConfigFile(path string, c *ConfigRequest) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("解析配置文件%s失败: %w", path, err)
+	}
+	return nil
+}
+
+// Config 转换为dd.Config
+func (c ConfigRequest) Config() (dd.Config, error) {
+	splitFn := func(c rune) bool {
+		return c == ','
+	}
+	device, err := dd.ResolveDeviceProfile(c.Device, c.DeviceFile)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	intervals, err := dd.ParseIntervals(c.RateLimit)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	backoff := dd.DefaultBackoff
+	if c.Backoff != "" {
+		if backoff.Base, err = time.ParseDuration(c.Backoff); err != nil {
+			return dd.Config{}, fmt.Errorf("backoff格式有误: %w", err)
+		}
+	}
+	if c.MaxBackoff != "" {
+		if backoff.Max, err = time.ParseDuration(c.MaxBackoff); err != nil {
+			return dd.Config{}, fmt.Errorf("maxBackoff格式有误: %w", err)
+		}
+	}
+	slotPolicy, err := c.SlotPolicy()
+	if err != nil {
+		return dd.Config{}, err
+	}
+	capacityDates, err := dd.ParseDates(c.CapacityDates)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	floors, err := dd.ParseFloors(c.Floors, c.DeliveryType)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	priorities, err := dd.ParsePriorities(c.Priorities)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	minQuantities, err := dd.ParseMinQuantities(c.MinQuantity)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	partialStock, err := dd.ParsePartialStock(c.PartialStock)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	substitutions, err := dd.ParseSubstitutions(c.Substitutions)
+	if err != nil {
+		return dd.Config{}, err
+	}
+	if c.TrimPolicy != "" && c.TrimPolicy != dd.TrimLowestPriority && c.TrimPolicy != dd.TrimMostExpensive {
+		return dd.Config{}, fmt.Errorf("trimPolicy只能为%s或%s: %s", dd.TrimLowestPriority, dd.TrimMostExpensive, c.TrimPolicy)
+	}
+	return dd.Config{
+		AuthToken:      c.AuthToken,                                //HTTP头部auth-token
+		BarkId:         c.BarkId,                                   //通知用的bark id，下载bark后从app界面获取, 如果不需要可以填空字符串
+		FloorId:        c.FloorId,                                  //1,普通商品 2,全球购保税 3,特殊订购自提 4,大件商品 5,厂家直供商品 6,特殊订购商品 7,失效商品
+		DeliveryType:   c.DeliveryType,                             //1 急速达，2， 全程配送
+		Longitude:      c.Longitude,                                //HTTP头部longitude,可选参数
+		Latitude:       c.Latitude,                                 //HTTP头部latitude,可选参数
+		Deviceid:       c.DeviceId,                                 //HTTP头部device-id,可选参数
+		Trackinfo:      c.TrackInfo,                                //HTTP头部track-info,可选参数
+		PromotionId:    strings.FieldsFunc(c.PromotionId, splitFn), //优惠券id
+		AddressId:      c.AddressId,                                //地址
+		AddressKeyword: c.AddressKeyword,                           //地址关键字
+		AddressIds:     strings.FieldsFunc(c.AddressIds, splitFn),  //备选地址
+		PayMethod:      c.PayMethod,                                //支付方式
+		DeliveryFee:    c.DeliveryFee,
+		StoreConf:      c.StoreConf,
+		IsSelected:     c.IsSelected,
+		BaseURL:        c.BaseURL,
+		Device:         device,
+		Intervals:      intervals,
+		Backoff:        backoff,
+		SlotPolicy:     slotPolicy,
+		CapacityDays:   c.CapacityDays,
+		CapacityDates:  capacityDates,
+		Floors:         floors,
+		Budget:         dd.Budget{MaxAmount: c.MaxAmount, Trim: c.TrimPolicy},
+		Priorities:     priorities,
+		MaxWeight:      c.MaxWeight,
+		MinQuantities:  minQuantities,
+		PartialStock:   partialStock,
+		Substitutions:  substitutions,
+	}, nil
+}
+
+// SlotPolicy 解析配送时段偏好
+func (c ConfigRequest) SlotPolicy() (dd.SlotPolicy, error) {
+	policy := dd.SlotPolicy{Order: c.SlotOrder}
+	if c.SlotOrder != "" && c.SlotOrder != dd.SlotEarliest && c.SlotOrder != dd.SlotLatest {
+		return policy, fmt.Errorf("slotOrder只能为%s或%s: %s", dd.SlotEarliest, dd.SlotLatest, c.SlotOrder)
+	}
+	var err error
+	if policy.Weekdays, err = dd.ParseWeekdays(c.SlotWeekdays); err != nil {
+		return policy, err
+	}
+	if policy.Hours, err = dd.ParseHourWindows(c.SlotHours); err != nil {
+		return policy, err
+	}
+	if policy.ExcludeDates, err = dd.ParseDates(c.ExcludeDates); err != nil {
+		return policy, err
+	}
+	if c.MinLead != "" {
+		if policy.MinLead, err = time.ParseDuration(c.MinLead); err != nil {
+			return policy, fmt.Errorf("minLead格式有误: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+// CommitStagger 解析并发提交的间隔，未指定时返回engine.DefaultStagger，指定为0时同时提交
+func (c ConfigRequest) CommitStagger() (time.Duration, error) {
+	if c.Stagger == "" {
+		return engine.DefaultStagger, nil
+	}
+	d, err := time.ParseDuration(c.Stagger)
+	if err != nil {
+		return 0, fmt.Errorf("stagger格式有误: %w", err)
+	}
+	return d, nil
+}
+
+// Schedule 解析开抢时间及准备步骤的提前时长，now为服务器当前时间；未指定startAt时返回零值
+func (c ConfigRequest) Schedule(now time.Time) (time.Time, time.Duration, error) {
+	if c.StartAt == "" {
+		return time.Time{}, 0, nil
+	}
+	startAt, err := engine.ParseStartAt(c.StartAt, now)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	lead := engine.DefaultLeadTime
+	if c.LeadTime != "" {
+		if lead, err = time.ParseDuration(c.LeadTime); err != nil {
+			return time.Time{}, 0, fmt.Errorf("leadTime格式有误: %w", err)
+		}
+	}
+	return startAt, lead, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/robGoods/sams/engine"
+)
+
+// TestParseConfig 测试命令行参数与配置文件
+// 验证默认值、-config加载的配置文件、命令行参数覆盖配置文件以及子命令自己的参数
+func TestParseConfig(t *testing.T) {
+	writeConfig := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "conf.json")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("写入配置文件失败: %v", err)
+		}
+		return path
+	}
+
+	t.Run("测试默认值", func(t *testing.T) {
+		_, c, err := parseConfig("run", []string{"-authToken=token"}, nil)
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if c.AuthToken != "token" || c.FloorId != 1 || c.DeliveryType != 2 || c.PayMethod != 1 {
+			t.Errorf("默认值有误: %+v", c)
+		}
+
+		t.Log("✅ 默认值测试通过")
+	})
+
+	t.Run("测试配置文件与命令行参数", func(t *testing.T) {
+		path := writeConfig(t, `{"authToken":"file-token","floorId":4,"concurrency":3,"slotOrder":"latest"}`)
+		_, c, err := parseConfig("run", []string{"-floorId=2", "-config", path, "-dryRun"}, nil)
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if c.AuthToken != "file-token" || c.Concurrency != 3 || c.SlotOrder != "latest" {
+			t.Errorf("应使用配置文件中的值: %+v", c)
+		}
+		if c.FloorId != 2 || !c.DryRun {
+			t.Errorf("命令行参数应优先于配置文件: %+v", c)
+		}
+		if c.DeliveryType != 2 || c.PayMethod != 1 {
+			t.Errorf("配置文件未指定的字段应保留默认值: %+v", c)
+		}
+
+		t.Log("✅ 配置文件与命令行参数测试通过")
+	})
+
+	t.Run("测试子命令参数", func(t *testing.T) {
+		path := writeConfig(t, `{"authToken":"file-token"}`)
+		var port string
+		_, c, err := parseConfig("server", []string{"-config=" + path, "-port=9000"}, func(fs *flag.FlagSet) {
+			fs.StringVar(&port, "port", "8080", "端口")
+		})
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if port != "9000" || c.AuthToken != "file-token" {
+			t.Errorf("子命令参数解析有误: %s %+v", port, c)
+		}
+
+		t.Log("✅ 子命令参数测试通过")
+	})
+
+	t.Run("测试错误的配置文件", func(t *testing.T) {
+		if _, _, err := parseConfig("run", []string{"-config", filepath.Join(t.TempDir(), "missing.json")}, nil); err == nil {
+			t.Error("配置文件不存在时应返回错误")
+		}
+		path := writeConfig(t, `{"floorId":"1"}`)
+		if _, _, err := parseConfig("run", []string{"-config", path}, nil); err == nil {
+			t.Error("配置文件格式有误时应返回错误")
+		}
+		if _, _, err := parseConfig("run", []string{"-unknown"}, nil); err == nil {
+			t.Error("未知参数应返回错误")
+		}
+
+		t.Log("✅ 错误的配置文件测试通过")
+	})
+}
+
+// TestConfigRequest 测试配置转换为dd.Config时的校验
+func TestConfigRequest(t *testing.T) {
+	t.Run("测试有效配置", func(t *testing.T) {
+		c := defaultConfigRequest()
+		c.AuthToken = "token"
+		c.AddressIds = "a1,,a2"
+		c.Floors = "1,4:1"
+		c.Backoff = "1s"
+		c.SlotOrder = "latest"
+		conf, err := c.Config()
+		if err != nil {
+			t.Fatalf("转换失败: %v", err)
+		}
+		if conf.AuthToken != "token" || len(conf.AddressIds) != 2 || len(conf.Floors) != 2 {
+			t.Errorf("转换结果有误: %+v", conf)
+		}
+		if conf.Backoff.Base.String() != "1s" || conf.SlotPolicy.Order != "latest" {
+			t.Errorf("退避时间或时段偏好有误: %+v %+v", conf.Backoff, conf.SlotPolicy)
+		}
+
+		t.Log("✅ 有效配置测试通过")
+	})
+
+	t.Run("测试无效配置", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			modify func(c *ConfigRequest)
+		}{
+			{"device", func(c *ConfigRequest) { c.Device = "unknown-device" }},
+			{"rateLimit", func(c *ConfigRequest) { c.RateLimit = "commitPay" }},
+			{"backoff", func(c *ConfigRequest) { c.Backoff = "1x" }},
+			{"maxBackoff", func(c *ConfigRequest) { c.MaxBackoff = "abc" }},
+			{"slotOrder", func(c *ConfigRequest) { c.SlotOrder = "random" }},
+			{"slotWeekdays", func(c *ConfigRequest) { c.SlotWeekdays = "8" }},
+			{"minLead", func(c *ConfigRequest) { c.MinLead = "2" }},
+			{"capacityDates", func(c *ConfigRequest) { c.CapacityDates = "2022/04/20" }},
+			{"floors", func(c *ConfigRequest) { c.Floors = "x" }},
+			{"priorities", func(c *ConfigRequest) { c.Priorities = "spu1:urgent" }},
+			{"minQuantity", func(c *ConfigRequest) { c.MinQuantity = "spu1:x" }},
+			{"partialStock", func(c *ConfigRequest) { c.PartialStock = "some" }},
+			{"substitutions", func(c *ConfigRequest) { c.Substitutions = "spuA" }},
+			{"trimPolicy", func(c *ConfigRequest) { c.TrimPolicy = "cheapest" }},
+		}
+		for _, tt := range tests {
+			c := defaultConfigRequest()
+			c.AuthToken = "token"
+			tt.modify(&c)
+			if _, err := c.Config(); err == nil {
+				t.Errorf("%s无效时应返回错误", tt.name)
+			}
+		}
+
+		t.Log("✅ 无效配置测试通过")
+	})
+
+	t.Run("测试并发提交间隔", func(t *testing.T) {
+		c := defaultConfigRequest()
+		if d, err := c.CommitStagger(); err != nil || d != engine.DefaultStagger {
+			t.Errorf("未指定时应使用默认间隔，实际为: %v %v", d, err)
+		}
+		c.Stagger = "0"
+		if d, err := c.CommitStagger(); err != nil || d != 0 {
+			t.Errorf("指定为0时应同时提交，实际为: %v %v", d, err)
+		}
+		c.Stagger = "fast"
+		if _, err := c.CommitStagger(); err == nil {
+			t.Error("stagger格式有误时应返回错误")
+		}
+
+		t.Log("✅ 并发提交间隔测试通过")
+	})
+}
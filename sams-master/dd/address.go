@@ -1,10 +1,13 @@
 package dd
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"strings"
 
 	"github.com/tidwall/gjson"
 )
@@ -40,76 +43,181 @@ func parseAddress(addressMap gjson.Result) (Address, error) {
 	return address, nil
 }
 
-func (s *DingdongSession) GetAddress() (error, []Address) {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/sams-user/receiver_address/address_list"
-	req := s.NewRequest("GET", urlPath, nil)
+func (s *DingdongSession) GetAddress(ctx context.Context) (error, []Address) {
+	urlPath := s.Conf.EndpointURL(EndpointAddressList)
+	req := s.NewRequest(ctx, "GET", urlPath, nil)
 
-	resp, err := s.Client.Do(req)
+	result, err := s.doRequest(EndpointAddressList, req)
 	if err != nil {
 		return err, nil
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err, nil
-	}
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			var addressList = make([]Address, 0)
-			validAddress := result.Get("data.addressList").Array()
-			for _, addressMap := range validAddress {
-				address, err := parseAddress(addressMap)
-				if err != nil {
-					return err, nil
-				}
-				addressList = append(addressList, address)
-			}
-			return nil, addressList
-		case "AUTH_FAIL":
-			return errors.New(fmt.Sprintf("%s %s", result.Get("msg").Str, "token过期！！！")), nil
-		default:
-			return errors.New(result.Get("msg").Str), nil
+	var addressList = make([]Address, 0)
+	validAddress := result.Get("data.addressList").Array()
+	for _, addressMap := range validAddress {
+		address, err := parseAddress(addressMap)
+		if err != nil {
+			return err, nil
 		}
-	} else {
-		return errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body)), nil
+		addressList = append(addressList, address)
 	}
+	return nil, addressList
 }
 
-func (s *DingdongSession) SaveDeliveryAddress() error {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/trade/cart/saveDeliveryAddress"
+func (s *DingdongSession) SaveDeliveryAddress(ctx context.Context) error {
+	urlPath := s.Conf.EndpointURL(EndpointSaveDeliveryAddress)
 
 	data := make(map[string]interface{})
 	data["uid"] = ""
 	data["addressId"] = s.Address.AddressId
 	dataStr, _ := json.Marshal(data)
 
-	req := s.NewRequest("POST", urlPath, dataStr)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
 
-	resp, err := s.Client.Do(req)
+	result, err := s.doRequest(EndpointSaveDeliveryAddress, req)
 	if err != nil {
 		return err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	if !result.Get("data.result").Bool() {
+		return newAPIError(EndpointSaveDeliveryAddress, result)
 	}
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			if result.Get("data.result").Bool() {
-				return nil
+	return nil
+}
+
+// ErrAddressNotSelected 选择策略未选出收货地址，可选地址见DingdongSession.AddressList
+var ErrAddressNotSelected = errors.New("未选择收货地址")
+
+// AddressSelector 收货地址选择策略，未选出时返回nil
+type AddressSelector interface {
+	Select(addrList []Address) (*Address, error)
+}
+
+// AddressSelectorFunc 将函数转换为AddressSelector
+type AddressSelectorFunc func(addrList []Address) (*Address, error)
+
+func (f AddressSelectorFunc) Select(addrList []Address) (*Address, error) {
+	return f(addrList)
+}
+
+// SelectAddressById 按地址id选择，指定多个id时选择第一个存在的地址
+func SelectAddressById(ids ...string) AddressSelector {
+	return AddressSelectorFunc(func(addrList []Address) (*Address, error) {
+		for _, id := range ids {
+			for i := range addrList {
+				if id != "" && addrList[i].AddressId == id {
+					return &addrList[i], nil
+				}
+			}
+		}
+		return nil, nil
+	})
+}
+
+// SelectAddressByDistrict 选择第一个区县名称一致的地址
+func SelectAddressByDistrict(district string) AddressSelector {
+	return AddressSelectorFunc(func(addrList []Address) (*Address, error) {
+		for i := range addrList {
+			if district != "" && addrList[i].DistrictName == district {
+				return &addrList[i], nil
 			}
-			return errors.New(result.Get("msg").Str)
-		case "AUTH_FAIL":
-			return errors.New(fmt.Sprintf("%s %s", result.Get("msg").Str, "token过期！！！"))
-		default:
-			return errors.New(result.Get("msg").Str)
 		}
-	} else {
-		return errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body))
+		return nil, nil
+	})
+}
+
+// SelectAddressByKeyword 选择第一个区县、街道、详细地址或收货人包含关键字的地址
+func SelectAddressByKeyword(keyword string) AddressSelector {
+	return AddressSelectorFunc(func(addrList []Address) (*Address, error) {
+		if keyword == "" {
+			return nil, nil
+		}
+		for i, addr := range addrList {
+			text := strings.Join([]string{addr.DistrictName, addr.ReceiverAddress, addr.DetailAddress, addr.Name}, " ")
+			if strings.Contains(text, keyword) {
+				return &addrList[i], nil
+			}
+		}
+		return nil, nil
+	})
+}
+
+// PromptAddress 列出地址并从in读取序号
+func PromptAddress(in io.Reader, out io.Writer) AddressSelector {
+	return AddressSelectorFunc(func(addrList []Address) (*Address, error) {
+		fmt.Fprintln(out, "########## 选择收货地址 ##########")
+		for i, addr := range addrList {
+			fmt.Fprintf(out, "[%v] Id: %s %s %s %s %s %s \n", i, addr.AddressId, addr.Name, addr.DistrictName, addr.ReceiverAddress, addr.DetailAddress, addr.Mobile)
+		}
+
+		stdin := bufio.NewReader(in)
+		var index int
+		for true {
+			fmt.Fprintln(out, "请输入地址序号（0, 1, 2...)：")
+			_, err := fmt.Fscanln(stdin, &index)
+			if err == io.EOF {
+				return nil, ErrAddressNotSelected
+			}
+			if err != nil {
+				fmt.Fprintf(out, "输入有误：%s!\n", err)
+			} else if index < 0 || index >= len(addrList) {
+				fmt.Fprintln(out, "输入有误：超过最大序号！")
+			} else {
+				break
+			}
+		}
+		return &addrList[index], nil
+	})
+}
+
+// ReturnAddressList 不选择地址，由调用方通过SelectAddress选择
+var ReturnAddressList AddressSelector = AddressSelectorFunc(func(addrList []Address) (*Address, error) {
+	return nil, ErrAddressNotSelected
+})
+
+// FirstAddress 依次使用各策略，返回第一个选出的地址
+func FirstAddress(selectors ...AddressSelector) AddressSelector {
+	return AddressSelectorFunc(func(addrList []Address) (*Address, error) {
+		for _, selector := range selectors {
+			addr, err := selector.Select(addrList)
+			if err != nil || addr != nil {
+				return addr, err
+			}
+		}
+		return nil, nil
+	})
+}
+
+// SelectAddress 从AddressList中按id选择收货地址
+func (s *DingdongSession) SelectAddress(id string) error {
+	addr, _ := SelectAddressById(id).Select(s.AddressList)
+	if addr == nil {
+		return fmt.Errorf("%w: 地址%s不存在", ErrAddressNotSelected, id)
+	}
+	s.Address = *addr
+	s.Conf.AddressId = id
+	return nil
+}
+
+// ErrNoFallbackAddress 备选收货地址均已尝试
+var ErrNoFallbackAddress = errors.New("没有可切换的备选收货地址")
+
+// NextAddress 按Conf.AddressIds的顺序切换到当前地址之后的下一个地址，跳过地址列表中不存在的id。
+// 当前地址不在AddressIds中时从第一个开始
+func (s *DingdongSession) NextAddress() (Address, error) {
+	ids := s.Conf.AddressIds
+	start := 0
+	for i, id := range ids {
+		if id == s.Address.AddressId {
+			start = i + 1
+			break
+		}
+	}
+	for _, id := range ids[start:] {
+		if id == s.Address.AddressId {
+			continue
+		}
+		if err := s.SelectAddress(id); err == nil {
+			return s.Address, nil
+		}
 	}
+	return s.Address, ErrNoFallbackAddress
 }
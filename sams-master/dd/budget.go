@@ -0,0 +1,137 @@
+package dd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// 超出预算时减少商品的顺序
+const (
+	TrimLowestPriority = "priority"  //优先减少优先级最低的商品，同一优先级按购物车中的顺序从后往前
+	TrimMostExpensive  = "expensive" //同一优先级中优先减少单价最高的商品
+)
+
+// ErrOverBudget 按预算调整后没有可下单的商品，或只有减少必需商品才能满足上限
+var ErrOverBudget = errors.New("商品总价超过预算上限")
+
+// Budget 订单金额上限，单位与Goods.Price一致(分)
+type Budget struct {
+	MaxAmount int    //商品总价上限，0表示不限
+	Trim      string //超出上限时减少商品的顺序，默认TrimLowestPriority
+}
+
+// GoodsTrim 按预算调整的一件商品，Quantity为调整后的数量，0表示移除
+type GoodsTrim struct {
+	Goods    Goods
+	Quantity int
+}
+
+// GoodsAmount 商品总价(分)
+func GoodsAmount(goodsList []Goods) int {
+	amount := 0
+	for _, goods := range goodsList {
+		amount += goods.Price * goods.Quantity
+	}
+	return amount
+}
+
+// FormatAmount 将分转换为购物车中金额的格式，如 16770 → "167.70"
+func FormatAmount(amount int) string {
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
+
+// Apply 商品总价超过MaxAmount时按Trim的顺序逐件减少商品，直到不超过上限；再按相反的顺序放回减少过多的商品，
+// 例如减少了单价高的商品后，之前移除的便宜商品可能又能放下。必需商品不会被减少，数量减少到MinQuantity以下时移除该商品。
+// 返回调整后的商品及被调整的商品；无法满足上限时返回ErrOverBudget
+func (b Budget) Apply(goodsList []Goods) ([]Goods, []GoodsTrim, error) {
+	amount := GoodsAmount(goodsList)
+	if b.MaxAmount <= 0 || amount <= b.MaxAmount {
+		return goodsList, nil, nil
+	}
+
+	goods := append([]Goods(nil), goodsList...)
+	order := b.trimOrder(goods)
+	for _, i := range order {
+		for goods[i].Quantity > 0 && amount > b.MaxAmount {
+			amount -= goods[i].Price * goods[i].reduce()
+		}
+		if amount <= b.MaxAmount {
+			break
+		}
+	}
+	if amount <= b.MaxAmount {
+		putBack(goodsList, goods, order, float64(b.MaxAmount-amount), func(g Goods) float64 {
+			return float64(g.Price)
+		})
+	}
+
+	result, trims := trimResult(goodsList, goods)
+	if len(result) == 0 || amount > b.MaxAmount {
+		return nil, trims, fmt.Errorf("%w: 商品总价%s元，上限%s元", ErrOverBudget, FormatAmount(GoodsAmount(goodsList)), FormatAmount(b.MaxAmount))
+	}
+	return result, trims, nil
+}
+
+// putBack 按order的相反顺序放回减少过多的商品，spare为剩余额度，cost为一件商品占用的额度；
+// 从0件放回时至少放回MinQuantity件
+func putBack(before, goods []Goods, order []int, spare float64, cost func(g Goods) float64) {
+	for k := len(order) - 1; k >= 0; k-- {
+		i := order[k]
+		for goods[i].Quantity < before[i].Quantity {
+			n := 1
+			if goods[i].Quantity == 0 && goods[i].MinQuantity > 1 {
+				n = goods[i].MinQuantity
+			}
+			c := cost(goods[i]) * float64(n)
+			if n > before[i].Quantity-goods[i].Quantity || c > spare+weightEpsilon {
+				break
+			}
+			goods[i].Quantity += n
+			spare -= c
+		}
+	}
+}
+
+// reduce 减少一件商品，数量已不超过MinQuantity时移除，返回减少的数量
+func (g *Goods) reduce() int {
+	n := 1
+	if g.Quantity <= g.MinQuantity {
+		n = g.Quantity
+	}
+	g.Quantity -= n
+	return n
+}
+
+// trimResult 比较调整前后的商品，返回保留的商品及被调整的商品
+func trimResult(before, after []Goods) ([]Goods, []GoodsTrim) {
+	result := make([]Goods, 0, len(after))
+	trims := make([]GoodsTrim, 0)
+	for i, g := range after {
+		if g.Quantity != before[i].Quantity {
+			trims = append(trims, GoodsTrim{Goods: before[i], Quantity: g.Quantity})
+		}
+		if g.Quantity > 0 {
+			result = append(result, g)
+		}
+	}
+	return result, trims
+}
+
+// trimOrder 按Trim返回减少商品的顺序(下标)，不包括必需商品
+func (b Budget) trimOrder(goods []Goods) []int {
+	order := make([]int, 0, len(goods))
+	for i := len(goods) - 1; i >= 0; i-- {
+		if goods[i].Priority != PriorityMustHave {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		gi, gj := goods[order[i]], goods[order[j]]
+		if gi.Priority != gj.Priority {
+			return gi.Priority < gj.Priority
+		}
+		return b.Trim == TrimMostExpensive && gi.Price > gj.Price
+	})
+	return order
+}
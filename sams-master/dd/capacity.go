@@ -1,11 +1,9 @@
 package dd
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"github.com/tidwall/gjson"
-	"io/ioutil"
 	"time"
 )
 
@@ -69,38 +67,41 @@ func parseCapacity(result gjson.Result) *Capacity {
 	}
 }
 
-func (s *DingdongSession) GetCapacity(storeDeliveryTemplateId string) (*Capacity, error) {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/delivery/portal/getCapacityData"
+// DefaultCapacityDays 默认查询今明两天的配送时间
+const DefaultCapacityDays = 2
+
+// PerDateList 查询配送时间的日期列表，按上海时区计算，与运行环境的时区无关
+func (c Config) PerDateList(now time.Time) []string {
+	if len(c.CapacityDates) > 0 {
+		return c.CapacityDates
+	}
+	days := c.CapacityDays
+	if days <= 0 {
+		days = DefaultCapacityDays
+	}
+	now = now.In(Shanghai)
+	dates := make([]string, 0, days)
+	for i := 0; i < days; i++ {
+		dates = append(dates, now.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+	return dates
+}
+
+func (s *DingdongSession) GetCapacity(ctx context.Context, storeDeliveryTemplateId string) (*Capacity, error) {
+	urlPath := s.Conf.EndpointURL(EndpointCapacity)
+	now := time.Now()
+	if s.Clock != nil {
+		now = s.Clock.Now()
+	}
 	data := make(map[string]interface{})
-	data["perDateList"] = []string{time.Now().Format("2006-01-02"), time.Now().AddDate(0, 0, 1).Format("2006-01-02")}
+	data["perDateList"] = s.Conf.PerDateList(now)
 	data["storeDeliveryTemplateId"] = storeDeliveryTemplateId
 	dataStr, _ := json.Marshal(data)
-	req := s.NewRequest("POST", urlPath, dataStr)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
 
-	resp, err := s.Client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	body, err := ioutil.ReadAll(resp.Body)
+	result, err := s.doRequest(EndpointCapacity, req)
 	if err != nil {
 		return nil, err
 	}
-
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			return parseCapacity(result), nil
-		case "LIMITED":
-			return nil, LimitedErr
-		default:
-			if result.Get("msg").Str == CapacityErr.Error() {
-				return nil, CapacityErr
-			}
-			return nil, errors.New(result.Get("msg").Str)
-		}
-	} else {
-		return nil, errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body))
-	}
+	return parseCapacity(result), nil
 }
@@ -1,10 +1,10 @@
 package dd
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 
 	"github.com/tidwall/gjson"
 )
@@ -56,6 +56,39 @@ func parseFloorInfos(g gjson.Result) (error, FloorInfo) {
 
 	return nil, r
 }
+
+// AvailableQuantity 按库存、限购数量和剩余可购买数量调整后的可购买数量
+func (this NormalGoods) AvailableQuantity() int {
+	if !(this.StockQuantity > 0 && this.StockStatus && this.IsPutOnSale && this.IsAvailable) {
+		return 0
+	}
+	quantity := this.Quantity
+	if this.StockQuantity <= quantity {
+		quantity = this.StockQuantity
+	}
+	if this.LimitNum > 0 && quantity > this.LimitNum {
+		quantity = this.LimitNum
+	}
+	if this.LimitNum > 0 && quantity > this.ResiduePurchaseNum {
+		quantity = this.ResiduePurchaseNum
+	}
+	return quantity
+}
+
+// AvailableGoods 返回楼层中可购买的商品，包括正常、库存不足及重新上架的商品
+func (f FloorInfo) AvailableGoods() []Goods {
+	goodsList := make([]Goods, 0)
+	for _, list := range [][]NormalGoods{f.NormalGoodsList, f.ShortageStockGoodsList, f.AllOutOfStockGoodsList} {
+		for _, goods := range list {
+			if quantity := goods.AvailableQuantity(); quantity > 0 {
+				goods.Quantity = quantity
+				goodsList = append(goodsList, goods.ToGoods())
+			}
+		}
+	}
+	return goodsList
+}
+
 func (s *DingdongSession) GetCart(result gjson.Result) error {
 	c := Cart{
 		FloorInfoList: make([]FloorInfo, 0),
@@ -78,12 +111,12 @@ type GetCartPram struct {
 	HomePagelatitude  string  `json:"homePagelatitude"`
 }
 
-func (s *DingdongSession) CheckCart() error {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/trade/cart/getUserCart"
+func (s *DingdongSession) CheckCart(ctx context.Context) error {
+	urlPath := s.Conf.EndpointURL(EndpointUserCart)
 
 	data := GetCartPram{
 		Uid:               "",
-		DeviceType:        "ios",
+		DeviceType:        s.Conf.Device.withDefaults().DeviceType,
 		StoreList:         make([]Store, 0),
 		DeliveryType:      s.Conf.DeliveryType,
 		HomePagelongitude: s.Address.Longitude,
@@ -95,28 +128,140 @@ func (s *DingdongSession) CheckCart() error {
 	}
 
 	dataStr, _ := json.Marshal(data)
-	req := s.NewRequest("POST", urlPath, dataStr)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
 
-	resp, err := s.Client.Do(req)
+	result, err := s.doRequest(EndpointUserCart, req)
 	if err != nil {
 		return err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
+	return s.GetCart(result)
+}
+
+// CartGoods 修改购物车的一件商品
+type CartGoods struct {
+	SpuId            string `json:"spuId"`
+	StoreId          string `json:"storeId"`
+	IncreaseQuantity int    `json:"increaseQuantity,omitempty"` //加购时增加的数量
+	Quantity         int    `json:"quantity,omitempty"`         //修改数量时的新数量
+	IsSelected       bool   `json:"isSelected"`
+}
+
+type CartGoodsPram struct {
+	Uid               string      `json:"uid"`
+	DeviceType        string      `json:"deviceType"`
+	CartGoodsInfoList []CartGoods `json:"cartGoodsInfoList"`
+	DeliveryType      int         `json:"deliveryType"`
+	HomePagelongitude string      `json:"homePagelongitude"`
+	HomePagelatitude  string      `json:"homePagelatitude"`
+}
+
+// ErrNotInCart 要修改的商品不在购物车中
+var ErrNotInCart = errors.New("商品不在购物车中")
+
+// FindGoods 在购物车中查找商品
+func (c Cart) FindGoods(spuId string) (NormalGoods, bool) {
+	for _, floor := range c.FloorInfoList {
+		for _, list := range [][]NormalGoods{floor.NormalGoodsList, floor.ShortageStockGoodsList, floor.AllOutOfStockGoodsList} {
+			for _, goods := range list {
+				if goods.SpuId == spuId {
+					return goods, true
+				}
+			}
+		}
+	}
+	return NormalGoods{}, false
+}
+
+// AddCartGoods 将商品加入购物车，购物车中已有的商品增加IncreaseQuantity件；
+// StoreId为空时使用购物车中当前楼层的商店，不修改传入的goods。返回重新获取的购物车
+func (s *DingdongSession) AddCartGoods(ctx context.Context, goods ...CartGoods) (Cart, error) {
+	storeId := ""
+	for _, floor := range s.Cart.FloorInfoList {
+		if floor.FloorId == s.Conf.FloorId && floor.DeliveryType == s.Conf.DeliveryType {
+			storeId = floor.StoreId
+			break
+		}
+	}
+	goods = append([]CartGoods(nil), goods...)
+	for i := range goods {
+		if goods[i].StoreId == "" {
+			goods[i].StoreId = storeId
+		}
+		if goods[i].StoreId == "" {
+			return s.Cart, fmt.Errorf("无法确定商品%s所属的商店，请先获取购物车或指定storeId", goods[i].SpuId)
+		}
+	}
+	return s.modifyCart(ctx, EndpointAddCartGoods, goods)
+}
+
+// UpdateCartGoods 修改购物车中商品的数量，返回重新获取的购物车
+func (s *DingdongSession) UpdateCartGoods(ctx context.Context, spuId string, quantity int) (Cart, error) {
+	if quantity <= 0 {
+		return s.Cart, fmt.Errorf("商品数量应大于0，移除商品请使用RemoveCartGoods: %d", quantity)
+	}
+	goods, err := s.cartGoods(spuId)
 	if err != nil {
-		return err
+		return s.Cart, err
+	}
+	goods[0].Quantity = quantity
+	return s.modifyCart(ctx, EndpointUpdateCartGoods, goods)
+}
+
+// SelectCartGoods 勾选或取消勾选购物车中的商品，返回重新获取的购物车
+func (s *DingdongSession) SelectCartGoods(ctx context.Context, selected bool, spuIds ...string) (Cart, error) {
+	goods, err := s.cartGoods(spuIds...)
+	if err != nil {
+		return s.Cart, err
 	}
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			return s.GetCart(result)
-		case "LIMITED":
-			return LimitedErr1
-		default:
-			return errors.New(result.Get("msg").Str)
+	for i := range goods {
+		goods[i].IsSelected = selected
+	}
+	return s.modifyCart(ctx, EndpointSelectCartGoods, goods)
+}
+
+// RemoveCartGoods 从购物车中移除商品，返回重新获取的购物车
+func (s *DingdongSession) RemoveCartGoods(ctx context.Context, spuIds ...string) (Cart, error) {
+	goods, err := s.cartGoods(spuIds...)
+	if err != nil {
+		return s.Cart, err
+	}
+	return s.modifyCart(ctx, EndpointDeleteCartGoods, goods)
+}
+
+// cartGoods 按最近一次获取的购物车构造要修改的商品
+func (s *DingdongSession) cartGoods(spuIds ...string) ([]CartGoods, error) {
+	goods := make([]CartGoods, 0, len(spuIds))
+	for _, spuId := range spuIds {
+		g, ok := s.Cart.FindGoods(spuId)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotInCart, spuId)
 		}
-	} else {
-		return errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body))
+		goods = append(goods, CartGoods{SpuId: g.SpuId, StoreId: g.StoreId, IsSelected: g.IsSelected})
+	}
+	return goods, nil
+}
+
+// modifyCart 调用修改购物车的接口，成功后重新获取购物车
+func (s *DingdongSession) modifyCart(ctx context.Context, endpoint string, goods []CartGoods) (Cart, error) {
+	urlPath := s.Conf.EndpointURL(endpoint)
+
+	data := CartGoodsPram{
+		Uid:               "",
+		DeviceType:        s.Conf.Device.withDefaults().DeviceType,
+		CartGoodsInfoList: goods,
+		DeliveryType:      s.Conf.DeliveryType,
+		HomePagelongitude: s.Address.Longitude,
+		HomePagelatitude:  s.Address.Latitude,
+	}
+
+	dataStr, _ := json.Marshal(data)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
+
+	if _, err := s.doRequest(endpoint, req); err != nil {
+		return s.Cart, err
+	}
+	if err := s.CheckCart(ctx); err != nil {
+		return s.Cart, err
 	}
+	return s.Cart, nil
 }
@@ -0,0 +1,83 @@
+package dd
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Shanghai 山姆服务器所在时区，补货、放时段等时间均以此为准
+var Shanghai = func() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Shanghai"); err == nil {
+		return loc
+	}
+	return time.FixedZone("CST", 8*3600)
+}()
+
+const clockSamples = 16
+
+type clockSample struct {
+	min, max time.Duration
+}
+
+// ServerClock 根据接口响应的Date头估算服务器时间与本地时间的偏差。
+// Date头只精确到秒，每次请求只能确定偏差所在的区间，取最近样本区间的交集以缩小误差
+type ServerClock struct {
+	mu      sync.Mutex
+	samples []clockSample
+}
+
+// Observe 记录一次请求，sent、received为本地发送和收到响应的时间，date为响应的Date头
+func (c *ServerClock) Observe(sent, received time.Time, date string) {
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	// 服务器生成Date时处于[t, t+1s)，对应的本地时间处于[sent, received]
+	sample := clockSample{min: t.Sub(received), max: t.Add(time.Second).Sub(sent)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = append(c.samples, sample)
+	if len(c.samples) > clockSamples {
+		c.samples = c.samples[len(c.samples)-clockSamples:]
+	}
+}
+
+// Offset 服务器时间减去本地时间；没有样本时为0
+func (c *ServerClock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.samples) == 0 {
+		return 0
+	}
+	// 从最新的样本开始求交集，交集为空(如本地时间被调整)时只使用更新的样本
+	r := c.samples[len(c.samples)-1]
+	for i := len(c.samples) - 2; i >= 0; i-- {
+		s := c.samples[i]
+		next := r
+		if s.min > next.min {
+			next.min = s.min
+		}
+		if s.max < next.max {
+			next.max = s.max
+		}
+		if next.min > next.max {
+			break
+		}
+		r = next
+	}
+	return r.min + (r.max-r.min)/2
+}
+
+// Samples 已记录的样本数
+func (c *ServerClock) Samples() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.samples)
+}
+
+// Now 估算的服务器当前时间
+func (c *ServerClock) Now() time.Time {
+	return time.Now().Add(c.Offset())
+}
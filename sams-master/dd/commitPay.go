@@ -1,11 +1,10 @@
 package dd
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/tidwall/gjson"
-	"io/ioutil"
 )
 
 type CommitPayPram struct {
@@ -70,9 +69,8 @@ func (s *DingdongSession) GetOrderInfo(result gjson.Result) *Order {
 	}
 }
 
-func (s *DingdongSession) CommitPay(info SettleDeliveryInfo) (*Order, error) {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/trade/settlement/commitPay"
-
+// NewCommitPayPram 按当前会话的商品、门店、地址和优惠券构造提交订单的参数
+func (s *DingdongSession) NewCommitPayPram(info SettleDeliveryInfo) CommitPayPram {
 	data := CommitPayPram{
 		GoodsList:          s.GoodsList,
 		InvoiceInfo:        make(map[int]interface{}),
@@ -114,56 +112,26 @@ func (s *DingdongSession) CommitPay(info SettleDeliveryInfo) (*Order, error) {
 		}
 	}
 
+	return data
+}
+
+func (s *DingdongSession) CommitPay(ctx context.Context, info SettleDeliveryInfo) (*Order, error) {
+	urlPath := s.Conf.EndpointURL(EndpointCommitPay)
+
+	data := s.NewCommitPayPram(info)
+
 	dataStr, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
 	}
-	req := s.NewRequest("POST", urlPath, dataStr)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
 	req.Header.Set("track-info", s.Conf.Trackinfo)
-	resp, err := s.Client.Do(req)
+	result, err := s.doRequest(EndpointCommitPay, req)
 	if err != nil {
 		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			if result.Get("data.isSuccess").Bool() {
-				return s.GetOrderInfo(result), nil
-			} else {
-				return nil, errors.New(result.Get("data.failReason").Str)
-			}
-		case "LIMITED":
-			return nil, LimitedErr1
-		case "GOODS_EXCEED_LIMIT":
-			return nil, GoodsExceedLimitErr
-		case "CLOSE_ORDER_TIME_EXCEPTION":
-			return nil, CloseOrderTimeExceptionErr
-		case "DECREASE_CAPACITY_COUNT_ERROR":
-			return nil, DecreaseCapacityCountError
-		case "OUT_OF_STOCK":
-			return nil, OOSErr
-		case "NOT_DELIVERY_CAPACITY_ERROR":
-			return nil, NotDeliverCapCityErr
-		case "STORE_HAS_CLOSED":
-			return nil, StoreHasClosedError
-		case "PRE_GOOD_NOT_START_SELL":
-			return nil, PreGoodNotStartSellErr
-		case "CLOUD_GOODS_OVER_WEIGHT":
-			return nil, CloudGoodsOverWightErr
-		case "CART_GOOD_CHANGE":
-			return nil, CartGoodChangeErr
-		case "GET_DELIVERY_INFO_ERROR":
-			return nil, GetDeliveryInfoErr
-		default:
-			return nil, errors.New(result.Get("msg").Str)
-		}
-	} else {
-		return nil, errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body))
+	if !result.Get("data.isSuccess").Bool() {
+		return nil, newAPIError(EndpointCommitPay, result)
 	}
+	return s.GetOrderInfo(result), nil
 }
@@ -0,0 +1,126 @@
+package dd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+// DeviceProfile 请求头中的客户端信息，需与抓取auth-token时的客户端一致
+type DeviceProfile struct {
+	Name           string            `json:"name"`
+	AppVersion     string            `json:"appVersion"`     //app-version，如 5.0.47.0
+	DeviceType     string            `json:"deviceType"`     //device-type及apptype，ios或android
+	DeviceName     string            `json:"deviceName"`     //device-name，如 iPhone14,5
+	OSVersion      string            `json:"osVersion"`      //device-os-version，如 15.4.1
+	UserAgent      string            `json:"userAgent"`      //User-Agent
+	Language       string            `json:"language"`       //Accept-Language
+	SystemLanguage string            `json:"systemLanguage"` //system-language
+	Headers        map[string]string `json:"headers"`        //其他需要添加的请求头
+}
+
+const DefaultDeviceProfile = "iphone13-ios15"
+
+// DeviceProfiles 内置设备信息，key为名称；只内置与原有请求头一致的设备，其他客户端用LoadDeviceProfiles从文件加载
+var DeviceProfiles = map[string]DeviceProfile{
+	"iphone13-ios15": {
+		Name:           "iphone13-ios15",
+		AppVersion:     "5.0.47.0",
+		DeviceType:     "ios",
+		DeviceName:     "iPhone14,5",
+		OSVersion:      "15.4.1",
+		UserAgent:      "SamClub/5.0.47 (iPhone; iOS 15.4.1; Scale/3.00)",
+		Language:       "zh-Hans-CN;q=1",
+		SystemLanguage: "CN",
+	},
+}
+
+// Apply 设置请求头，未填写的字段使用默认设备信息
+func (p DeviceProfile) Apply(header http.Header) {
+	p = p.withDefaults()
+	header.Set("app-version", p.AppVersion)
+	header.Set("device-type", p.DeviceType)
+	header.Set("Accept-Language", p.Language)
+	header.Set("apptype", p.DeviceType)
+	header.Set("device-name", p.DeviceName)
+	header.Set("device-os-version", p.OSVersion)
+	header.Set("User-Agent", p.UserAgent)
+	header.Set("system-language", p.SystemLanguage)
+	for k, v := range p.Headers {
+		header.Set(k, v)
+	}
+}
+
+func (p DeviceProfile) withDefaults() DeviceProfile {
+	def := DeviceProfiles[DefaultDeviceProfile]
+	if p.AppVersion == "" {
+		p.AppVersion = def.AppVersion
+	}
+	if p.DeviceType == "" {
+		p.DeviceType = def.DeviceType
+	}
+	if p.DeviceName == "" {
+		p.DeviceName = def.DeviceName
+	}
+	if p.OSVersion == "" {
+		p.OSVersion = def.OSVersion
+	}
+	if p.UserAgent == "" {
+		p.UserAgent = def.UserAgent
+	}
+	if p.Language == "" {
+		p.Language = def.Language
+	}
+	if p.SystemLanguage == "" {
+		p.SystemLanguage = def.SystemLanguage
+	}
+	return p
+}
+
+// LoadDeviceProfiles 从JSON文件加载设备信息，文件内容可以是单个对象或数组
+func LoadDeviceProfiles(path string) ([]DeviceProfile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []DeviceProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		var profile DeviceProfile
+		if err := json.Unmarshal(data, &profile); err != nil {
+			return nil, fmt.Errorf("解析设备信息文件%s失败: %w", path, err)
+		}
+		profiles = []DeviceProfile{profile}
+	}
+	return profiles, nil
+}
+
+// ResolveDeviceProfile 按名称选择设备信息。指定file时优先从文件中查找，
+// name为空时使用文件中的第一个；未指定file且name为空时使用DefaultDeviceProfile
+func ResolveDeviceProfile(name, file string) (DeviceProfile, error) {
+	if file != "" {
+		profiles, err := LoadDeviceProfiles(file)
+		if err != nil {
+			return DeviceProfile{}, err
+		}
+		for _, p := range profiles {
+			if name == "" || p.Name == name {
+				return p.withDefaults(), nil
+			}
+		}
+	}
+	if name == "" {
+		name = DefaultDeviceProfile
+	}
+	if p, ok := DeviceProfiles[name]; ok {
+		return p, nil
+	}
+
+	names := make([]string, 0, len(DeviceProfiles))
+	for k := range DeviceProfiles {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return DeviceProfile{}, fmt.Errorf("未找到设备信息%s，可选: %v", name, names)
+}
@@ -0,0 +1,54 @@
+package dd
+
+import "strings"
+
+// DefaultBaseURL 山姆App接口地址
+const DefaultBaseURL = "https://api-sams.walmartmobile.cn"
+
+// 接口名称，用于Config.Endpoints覆盖默认路径
+const (
+	EndpointAddressList         = "address_list"
+	EndpointSaveDeliveryAddress = "saveDeliveryAddress"
+	EndpointStoreList           = "getRecommendStoreListByLocation"
+	EndpointUserCart            = "getUserCart"
+	EndpointCheckGoods          = "checkGoodsInfo"
+	EndpointSettleInfo          = "getSettleInfo"
+	EndpointCapacity            = "getCapacityData"
+	EndpointCommitPay           = "commitPay"
+	EndpointAddCartGoods        = "addCartGoodsInfo"
+	EndpointUpdateCartGoods     = "updateCartGoodsInfo"
+	EndpointSelectCartGoods     = "selectCartGoods"
+	EndpointDeleteCartGoods     = "deleteCartGoodsInfo"
+)
+
+// DefaultEndpoints 各接口默认路径
+var DefaultEndpoints = map[string]string{
+	EndpointAddressList:         "/api/v1/sams/sams-user/receiver_address/address_list",
+	EndpointSaveDeliveryAddress: "/api/v1/sams/trade/cart/saveDeliveryAddress",
+	EndpointStoreList:           "/api/v1/sams/merchant/storeApi/getRecommendStoreListByLocation",
+	EndpointUserCart:            "/api/v1/sams/trade/cart/getUserCart",
+	EndpointCheckGoods:          "/api/v1/sams/trade/settlement/checkGoodsInfo",
+	EndpointSettleInfo:          "/api/v1/sams/trade/settlement/getSettleInfo",
+	EndpointCapacity:            "/api/v1/sams/delivery/portal/getCapacityData",
+	EndpointCommitPay:           "/api/v1/sams/trade/settlement/commitPay",
+	EndpointAddCartGoods:        "/api/v1/sams/trade/cart/addCartGoodsInfo",
+	EndpointUpdateCartGoods:     "/api/v1/sams/trade/cart/updateCartGoodsInfo",
+	EndpointSelectCartGoods:     "/api/v1/sams/trade/cart/selectCartGoods",
+	EndpointDeleteCartGoods:     "/api/v1/sams/trade/cart/deleteCartGoodsInfo",
+}
+
+// EndpointURL 返回接口完整地址，BaseURL和Endpoints为空时使用默认值
+func (c Config) EndpointURL(name string) string {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	path, ok := c.Endpoints[name]
+	if !ok {
+		path = DefaultEndpoints[name]
+	}
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -1,6 +1,12 @@
 package dd
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/tidwall/gjson"
+)
 
 var CartGoodChangeErr = errors.New("购物车商品发生变化，请返回购物车页面重新结算")
 var CapacityErr = errors.New("获取履约时间异常")
@@ -17,3 +23,158 @@ var PreGoodNotStartSellErr = errors.New("商品还未开始正式售卖，无法
 var CloudGoodsOverWightErr = errors.New("出于交通安全考虑，极速达订单限重30公斤，您的订单已超重，请分开下单")
 
 var OOSErr = errors.New("部分商品已缺货")
+var AuthFailErr = errors.New("token过期！！！")
+
+// ErrorClass 错误分类，决定下单流程如何继续
+type ErrorClass int
+
+const (
+	ClassRetryable     ErrorClass = iota //可直接重试
+	ClassRefreshCart                     //需要重新获取购物车
+	ClassRefreshStore                    //需要重新获取门店
+	ClassSlotExhausted                   //当前配送时段不可用
+	ClassFatal                           //无法继续
+	ClassAuthExpired                     //登录失效
+	ClassUnknown                         //未识别的接口错误，可重试但需要等待，避免频繁请求
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassRetryable:
+		return "retryable"
+	case ClassRefreshCart:
+		return "refresh_cart"
+	case ClassRefreshStore:
+		return "refresh_store"
+	case ClassSlotExhausted:
+		return "slot_exhausted"
+	case ClassFatal:
+		return "fatal"
+	case ClassAuthExpired:
+		return "auth_expired"
+	case ClassUnknown:
+		return "unknown"
+	default:
+		return fmt.Sprintf("ErrorClass(%d)", int(c))
+	}
+}
+
+// APIError 接口返回的错误
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Code       string
+	Msg        string
+	FailReason string
+	Class      ErrorClass
+	Err        error //对应的预定义错误，用于errors.Is判断
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.StatusCode != http.StatusOK:
+		return fmt.Sprintf("[%v] %s", e.StatusCode, e.Msg)
+	case e.Err == AuthFailErr:
+		return fmt.Sprintf("%s %s", e.Msg, AuthFailErr)
+	case e.Err != nil:
+		return e.Err.Error()
+	case e.FailReason != "":
+		return e.FailReason
+	default:
+		return e.Msg
+	}
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+type errorRule struct {
+	code  string
+	err   error
+	class ErrorClass
+}
+
+var errorRules = []errorRule{
+	{"LIMITED", LimitedErr, ClassRetryable},
+	{"LIMITED", LimitedErr1, ClassRetryable},
+	{"CLOUD_GOODS_OVER_WEIGHT", CloudGoodsOverWightErr, ClassRetryable},
+	{"CART_GOOD_CHANGE", CartGoodChangeErr, ClassRefreshCart},
+	{"OUT_OF_STOCK", OOSErr, ClassRefreshCart},
+	{"GOODS_EXCEED_LIMIT", GoodsExceedLimitErr, ClassRefreshCart},
+	{"PRE_GOOD_NOT_START_SELL", PreGoodNotStartSellErr, ClassRefreshCart},
+	{"NO_MATCH_DELIVERY_MODE", NoMatchDeliverMode, ClassRefreshStore},
+	{"STORE_HAS_CLOSED", StoreHasClosedError, ClassRefreshStore},
+	{"GET_DELIVERY_INFO_ERROR", GetDeliveryInfoErr, ClassRefreshStore},
+	{"", CapacityErr, ClassRefreshStore},
+	{"CLOSE_ORDER_TIME_EXCEPTION", CloseOrderTimeExceptionErr, ClassSlotExhausted},
+	{"DECREASE_CAPACITY_COUNT_ERROR", DecreaseCapacityCountError, ClassSlotExhausted},
+	{"NOT_DELIVERY_CAPACITY_ERROR", NotDeliverCapCityErr, ClassSlotExhausted},
+	{"AUTH_FAIL", AuthFailErr, ClassAuthExpired},
+}
+
+// localErrorRules 本地产生的错误，不对应接口返回的code、msg，只在ClassOf中用errors.Is匹配
+var localErrorRules = []errorRule{
+	{"", ErrOverBudget, ClassFatal},
+	{"", ErrOverWeight, ClassFatal},
+	{"", ErrMustHaveMissing, ClassRefreshCart},
+}
+
+// newAPIError 根据接口返回的code、msg归类错误，未识别的错误归类为ClassUnknown
+func newAPIError(endpoint string, result gjson.Result) *APIError {
+	e := &APIError{
+		Endpoint:   endpoint,
+		StatusCode: http.StatusOK,
+		Code:       result.Get("code").Str,
+		Msg:        result.Get("msg").Str,
+		FailReason: result.Get("data.failReason").Str,
+		Class:      ClassUnknown,
+	}
+	// 购物车和下单接口的限流提示与其他接口不同
+	if e.Code == "LIMITED" && (endpoint == EndpointUserCart || endpoint == EndpointCommitPay) {
+		e.Err, e.Class = LimitedErr1, ClassRetryable
+		return e
+	}
+	for _, rule := range errorRules {
+		if (rule.code != "" && rule.code == e.Code) || rule.err.Error() == e.Msg || (e.FailReason != "" && rule.err.Error() == e.FailReason) {
+			e.Err, e.Class = rule.err, rule.class
+			return e
+		}
+	}
+	return e
+}
+
+// newHTTPError 非200响应
+func newHTTPError(endpoint string, statusCode int, body []byte) *APIError {
+	e := &APIError{
+		Endpoint:   endpoint,
+		StatusCode: statusCode,
+		Msg:        string(body),
+		Class:      ClassRetryable,
+	}
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		e.Class = ClassAuthExpired
+	case statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError:
+		e.Class = ClassRetryable
+	case statusCode >= http.StatusBadRequest:
+		e.Class = ClassFatal
+	}
+	return e
+}
+
+// ClassOf 返回错误分类，本地错误按localErrorRules归类，其他非接口错误（如网络错误）视为可重试
+func ClassOf(err error) ErrorClass {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Class
+	}
+	for _, rules := range [][]errorRule{localErrorRules, errorRules} {
+		for _, rule := range rules {
+			if errors.Is(err, rule.err) {
+				return rule.class
+			}
+		}
+	}
+	return ClassRetryable
+}
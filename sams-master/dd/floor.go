@@ -0,0 +1,45 @@
+package dd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Floor 下单的楼层及配送方式，对应购物车中的一个FloorInfo
+type Floor struct {
+	FloorId      int `json:"floorId"`      //1,普通商品 2,全球购保税 3,特殊订购自提 4,大件商品 5,厂家直供商品 6,特殊订购商品 7,失效商品
+	DeliveryType int `json:"deliveryType"` //1 急速达，2， 全程配送
+}
+
+func (f Floor) String() string {
+	return fmt.Sprintf("楼层%d(配送方式%d)", f.FloorId, f.DeliveryType)
+}
+
+// ParseFloors 解析楼层列表，格式为 "楼层[:配送方式]"，如 "1,4:2"，未指定配送方式时使用deliveryType
+func ParseFloors(s string, deliveryType int) ([]Floor, error) {
+	floors := make([]Floor, 0)
+	seen := map[Floor]bool{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		floor := Floor{DeliveryType: deliveryType}
+		var err error
+		if floor.FloorId, err = strconv.Atoi(strings.TrimSpace(kv[0])); err != nil || floor.FloorId <= 0 {
+			return nil, fmt.Errorf("楼层格式有误: %s", item)
+		}
+		if len(kv) == 2 {
+			if floor.DeliveryType, err = strconv.Atoi(strings.TrimSpace(kv[1])); err != nil || floor.DeliveryType <= 0 {
+				return nil, fmt.Errorf("楼层格式有误: %s", item)
+			}
+		}
+		if !seen[floor] {
+			seen[floor] = true
+			floors = append(floors, floor)
+		}
+	}
+	return floors, nil
+}
@@ -1,22 +1,34 @@
 package dd
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"io/ioutil"
+	"net/http"
 
 	"github.com/tidwall/gjson"
 )
 
 type Goods struct {
-	GoodsName  string  `json:"-"`
-	Price      int     `json:"-"`
-	IsSelected bool    `json:"isSelected"`
-	Quantity   int     `json:"quantity"`
-	SpuId      string  `json:"spuId"`
-	StoreId    string  `json:"storeId"`
-	Weight     float64 `json:"-"`
+	GoodsName  string   `json:"-"`
+	Price      int      `json:"-"`
+	IsSelected bool     `json:"isSelected"`
+	Quantity   int      `json:"quantity"`
+	SpuId      string   `json:"spuId"`
+	StoreId    string   `json:"storeId"`
+	Weight     float64  `json:"-"`
+	Priority   Priority `json:"-"`
+
+	MinQuantity int `json:"-"` //减少商品时至少保留的数量，不足时移除该商品
+}
+
+// ExcludedGoods 未加入本次下单的商品及原因，Quantity为购物车中的数量
+type ExcludedGoods struct {
+	SpuId     string   `json:"spuId"`
+	GoodsName string   `json:"goodsName"`
+	Price     int      `json:"price"`
+	Quantity  int      `json:"quantity"`
+	Priority  Priority `json:"priority"`
+	Reason    string   `json:"reason"`
 }
 
 type NormalGoods struct {
@@ -51,6 +63,16 @@ func (this NormalGoods) ToGoods() Goods {
 	}
 }
 
+// Exclude 以reason排除该商品
+func (this NormalGoods) Exclude(reason string) ExcludedGoods {
+	return ExcludedGoods{SpuId: this.SpuId, GoodsName: this.GoodsName, Price: this.Price, Quantity: this.Quantity, Reason: reason}
+}
+
+// Exclude 以reason排除该商品
+func (this Goods) Exclude(reason string) ExcludedGoods {
+	return ExcludedGoods{SpuId: this.SpuId, GoodsName: this.GoodsName, Price: this.Price, Quantity: this.Quantity, Priority: this.Priority, Reason: reason}
+}
+
 func parseNormalGoods(g gjson.Result) NormalGoods {
 	return NormalGoods{
 		StoreId:            g.Get("storeId").Str,
@@ -73,50 +95,34 @@ func parseNormalGoods(g gjson.Result) NormalGoods {
 	}
 }
 
-func (s *DingdongSession) CheckGoods() (map[string]NormalGoods, error) {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/trade/settlement/checkGoodsInfo"
+func (s *DingdongSession) CheckGoods(ctx context.Context) (map[string]NormalGoods, error) {
+	urlPath := s.Conf.EndpointURL(EndpointCheckGoods)
 
 	data := make(map[string]interface{})
-	data["floorId"] = 1
-	data["storeId"] = ""
-	for _, v := range s.Cart.FloorInfoList {
-		if v.FloorId == s.Conf.FloorId {
-			data["storeId"] = v.StoreId
-		}
-	}
+	data["floorId"] = s.Conf.FloorId
+	data["storeId"] = s.FloorInfo.StoreId
 	data["goodsList"] = s.GoodsList
 	dataStr, _ := json.Marshal(data)
-	req := s.NewRequest("POST", urlPath, dataStr)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
 
-	resp, err := s.Client.Do(req)
+	result, err := s.doRequest(EndpointCheckGoods, req)
 	if err != nil {
 		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if result.Get("data.isHasException").Bool() == false {
+		return nil, nil
 	}
-
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			if result.Get("data.isHasException").Bool() == false {
-				return nil, nil
-			} else {
-				fmt.Println(result.Get("data.popUpInfo.desc").Str)
-				var goods = make(map[string]NormalGoods, 0)
-				for _, v := range result.Get("data.popUpInfo.goodsList").Array() {
-					g := parseNormalGoods(v)
-					goods[g.SpuId] = g
-				}
-				return goods, OOSErr
-			}
-		default:
-			return nil, errors.New(result.Get("msg").Str)
-		}
-	} else {
-		return nil, errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body))
+	var goods = make(map[string]NormalGoods, 0)
+	for _, v := range result.Get("data.popUpInfo.goodsList").Array() {
+		g := parseNormalGoods(v)
+		goods[g.SpuId] = g
+	}
+	return goods, &APIError{
+		Endpoint:   EndpointCheckGoods,
+		StatusCode: http.StatusOK,
+		Code:       result.Get("code").Str,
+		Msg:        result.Get("data.popUpInfo.desc").Str,
+		Class:      ClassRefreshCart,
+		Err:        OOSErr,
 	}
 }
@@ -0,0 +1,204 @@
+package dd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backoff 被限流(LIMITED)后的指数退避，第n次连续限流后等待 Base*2^(n-1)，不超过Max，
+// 并在 ±Jitter 比例内随机浮动。请求成功后退避级别减半，直到恢复为0
+type Backoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+var DefaultBackoff = Backoff{Base: 500 * time.Millisecond, Max: 10 * time.Second, Jitter: 0.2}
+
+// Delay 第level次连续限流后的等待时长，不含随机浮动
+func (b Backoff) Delay(level int) time.Duration {
+	if level <= 0 {
+		return 0
+	}
+	d := b.Base
+	for i := 1; i < level && d < b.Max; i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// EndpointStats 单个接口的请求统计
+type EndpointStats struct {
+	Requests  int64         `json:"requests"`  //请求次数
+	Limited   int64         `json:"limited"`   //被限流次数
+	Failed    int64         `json:"failed"`    //其他失败次数
+	Throttled int64         `json:"throttled"` //因频率限制或退避而等待的次数
+	Waited    time.Duration `json:"-"`         //累计等待时长，JSON中为毫秒数waitedMs
+	Level     int           `json:"level"`     //当前退避级别，0表示未退避
+}
+
+// MarshalJSON 累计等待时长输出为毫秒数waitedMs
+func (s EndpointStats) MarshalJSON() ([]byte, error) {
+	type stats EndpointStats
+	return json.Marshal(struct {
+		stats
+		WaitedMs int64 `json:"waitedMs"`
+	}{stats(s), s.Waited.Milliseconds()})
+}
+
+func (s EndpointStats) String() string {
+	return fmt.Sprintf("请求%d次 限流%d次 失败%d次 等待%d次共%v 退避级别%d", s.Requests, s.Limited, s.Failed, s.Throttled, s.Waited.Round(time.Millisecond), s.Level)
+}
+
+type endpointState struct {
+	next  time.Time
+	stats EndpointStats
+}
+
+// Limiter 按接口限制请求频率，并在被限流时退避
+type Limiter struct {
+	// Intervals 接口两次请求的最小间隔，key为接口名称，"*"为未配置接口的默认值
+	Intervals map[string]time.Duration
+	Backoff   Backoff
+
+	mu        sync.Mutex
+	rand      *rand.Rand
+	endpoints map[string]*endpointState
+}
+
+func NewLimiter(intervals map[string]time.Duration, backoff Backoff) *Limiter {
+	return &Limiter{
+		Intervals: intervals,
+		Backoff:   backoff,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		endpoints: map[string]*endpointState{},
+	}
+}
+
+func (l *Limiter) state(endpoint string) *endpointState {
+	st, ok := l.endpoints[endpoint]
+	if !ok {
+		st = &endpointState{}
+		l.endpoints[endpoint] = st
+	}
+	return st
+}
+
+func (l *Limiter) interval(endpoint string) time.Duration {
+	if d, ok := l.Intervals[endpoint]; ok {
+		return d
+	}
+	return l.Intervals["*"]
+}
+
+// Wait 等待到允许请求endpoint的时间，ctx取消时返回ctx.Err()
+func (l *Limiter) Wait(ctx context.Context, endpoint string) error {
+	l.mu.Lock()
+	st := l.state(endpoint)
+	now := time.Now()
+	wait := st.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	st.next = now.Add(wait + l.interval(endpoint))
+	st.stats.Requests++
+	if wait > 0 {
+		st.stats.Throttled++
+		st.stats.Waited += wait
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	return Sleep(ctx, wait)
+}
+
+// Done 记录请求结果，被限流时提高退避级别，成功时降低
+func (l *Limiter) Done(endpoint string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.state(endpoint)
+	switch {
+	case err == nil:
+		st.stats.Level /= 2
+	case IsLimited(err):
+		st.stats.Limited++
+		st.stats.Level++
+		d := l.Backoff.Delay(st.stats.Level)
+		if l.Backoff.Jitter > 0 {
+			d += time.Duration((l.rand.Float64()*2 - 1) * l.Backoff.Jitter * float64(d))
+		}
+		if next := time.Now().Add(d); next.After(st.next) {
+			st.next = next
+		}
+	default:
+		st.stats.Failed++
+	}
+}
+
+// Stats 各接口的请求统计，key为接口名称
+func (l *Limiter) Stats() map[string]EndpointStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make(map[string]EndpointStats, len(l.endpoints))
+	for k, v := range l.endpoints {
+		stats[k] = v.stats
+	}
+	return stats
+}
+
+// IsLimited 是否为服务器限流
+func IsLimited(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return errors.Is(err, LimitedErr) || errors.Is(err, LimitedErr1)
+}
+
+// ParseIntervals 解析接口请求间隔，格式为 "commitPay=200ms,getCapacityData=1s,*=100ms"
+func ParseIntervals(s string) (map[string]time.Duration, error) {
+	intervals := map[string]time.Duration{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("请求间隔格式有误: %s", item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("请求间隔格式有误: %s", item)
+		}
+		intervals[strings.TrimSpace(kv[0])] = d
+	}
+	return intervals, nil
+}
+
+// FormatStats 按接口名称排序输出统计
+func FormatStats(stats map[string]EndpointStats) []string {
+	names := make([]string, 0, len(stats))
+	for k := range stats {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %s", name, stats[name]))
+	}
+	return lines
+}
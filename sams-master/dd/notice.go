@@ -1,15 +1,21 @@
 package dd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 )
 
-func (s *DingdongSession) PushSuccess(msg string) error {
-	urlPath := fmt.Sprintf("https://api.day.app/%s/%s?sound=minuet", s.Conf.BarkId, msg)
-	req, _ := http.NewRequest("GET", urlPath, nil)
+// PushSuccess 推送bark通知，消息中的%、/、?等字符会被转义
+func (s *DingdongSession) PushSuccess(ctx context.Context, msg string) error {
+	urlPath := fmt.Sprintf("https://api.day.app/%s/%s?sound=minuet", url.PathEscape(s.Conf.BarkId), url.PathEscape(msg))
+	req, err := http.NewRequestWithContext(ctx, "GET", urlPath, nil)
+	if err != nil {
+		return err
+	}
 	resp, err := s.Client.Do(req)
 	if err != nil {
 		return err
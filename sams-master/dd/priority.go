@@ -0,0 +1,102 @@
+package dd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Priority 商品优先级，需要减少商品时优先级低的先减少
+type Priority int
+
+const (
+	PriorityOptional  Priority = -1 //可选
+	PriorityPreferred Priority = 0  //优先，未配置的商品默认为此级别
+	PriorityMustHave  Priority = 1  //必需，缺货或数量不足时不下单，不会被减少
+)
+
+// ErrMustHaveMissing 必需商品缺货或数量不足
+var ErrMustHaveMissing = errors.New("必需商品缺货")
+
+var priorityNames = map[Priority]string{
+	PriorityOptional:  "optional",
+	PriorityPreferred: "preferred",
+	PriorityMustHave:  "must",
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// Title 中文名称，用于日志和界面
+func (p Priority) Title() string {
+	switch p {
+	case PriorityMustHave:
+		return "必需"
+	case PriorityOptional:
+		return "可选"
+	default:
+		return "优先"
+	}
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Priorities 按SPU配置的商品优先级
+type Priorities map[string]Priority
+
+// Of 返回SPU的优先级，未配置时为PriorityPreferred
+func (p Priorities) Of(spuId string) Priority {
+	return p[spuId]
+}
+
+// Assign 按配置设置商品的优先级
+func (p Priorities) Assign(goodsList []Goods) {
+	for i := range goodsList {
+		goodsList[i].Priority = p.Of(goodsList[i].SpuId)
+	}
+}
+
+// MustHave 按SPU排序返回全部必需商品
+func (p Priorities) MustHave() []string {
+	spuIds := make([]string, 0)
+	for spuId, priority := range p {
+		if priority == PriorityMustHave {
+			spuIds = append(spuIds, spuId)
+		}
+	}
+	sort.Strings(spuIds)
+	return spuIds
+}
+
+// ParsePriorities 解析商品优先级，如 spu1:must,spu2:optional，优先级为 must、preferred 或 optional
+func ParsePriorities(s string) (Priorities, error) {
+	priorities := Priorities{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		spuId := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || spuId == "" {
+			return nil, fmt.Errorf("商品优先级格式有误，应为 spuId:优先级: %s", item)
+		}
+		found := false
+		for priority, name := range priorityNames {
+			if strings.TrimSpace(kv[1]) == name {
+				priorities[spuId], found = priority, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("商品优先级只能为must、preferred或optional: %s", item)
+		}
+	}
+	return priorities, nil
+}
@@ -1,14 +1,17 @@
 package dd
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/tidwall/gjson"
 )
 
 type Config struct {
@@ -26,25 +29,60 @@ type Config struct {
 	DeliveryFee  bool
 	StoreConf    string
 	IsSelected   bool
+	BaseURL      string            //接口地址，默认 https://api-sams.walmartmobile.cn
+	Endpoints    map[string]string //覆盖接口路径，key见EndpointXXX
+
+	Device          DeviceProfile            //请求头中的客户端信息，未填写的字段使用DefaultDeviceProfile
+	Intervals       map[string]time.Duration //接口两次请求的最小间隔，key为接口名称，"*"为默认值
+	Backoff         Backoff                  //被限流后的退避策略，零值时使用DefaultBackoff
+	AddressKeyword  string                   //按区县或地址关键字选择第一个匹配的地址
+	AddressSelector AddressSelector          //收货地址选择策略，默认依次按AddressId、AddressIds、AddressKeyword选择，都未匹配时从标准输入选择
+	AddressIds      []string                 //备选收货地址id，当前地址不支持配送或门店已打烊时按顺序切换
+	SlotPolicy      SlotPolicy               //配送时段偏好，决定尝试时段的顺序及排除的时段
+	CapacityDays    int                      //从今天起查询配送时间的天数，默认2(今明两天)
+	CapacityDates   []string                 //指定查询配送时间的日期，格式 2006-01-02，优先于CapacityDays
+	Floors          []Floor                  //一次运行中下单的多个楼层，为空时只下单FloorId
+	Budget          Budget                   //订单商品总价上限及超出时减少商品的顺序
+	Priorities      Priorities               //按SPU配置的商品优先级，必需商品缺货时不下单，需要减少商品时可选商品先减少
+	MaxWeight       float64                  //单笔订单限重(kg)，0时急速达为30kg，其他配送方式不限
+	MinQuantities   map[string]int           //按SPU配置可接受的最少数量，可购买数量更少时不下单该商品
+	PartialStock    PartialStock             //库存不足购物车中的数量时的处理方式，未配置最少数量的商品使用
+	Substitutions   Substitutions            //按SPU配置的替代商品，缺货时按顺序将第一个有货的替代商品加入购物车
 }
 
 type DingdongSession struct {
 	Conf               Config
 	Address            Address                    `json:"address"`
+	AddressList        []Address                  `json:"addressList"`
 	Uid                string                     `json:"uid"`
 	Capacity           Capacity                   `json:"capacity"`
-	SettleDeliveryInfo map[int]SettleDeliveryInfo `json:"settleDeliveryInfo"`
+	SettleDeliveryInfo map[int]SettleDeliveryInfo `json:"settleDeliveryInfo"` //待尝试的配送时段，key为排序后的顺序
+	Slots              []Slot                     `json:"slots"`              //按偏好排序的全部配送时段
 	GoodsList          []Goods                    `json:"goods"`
+	Excluded           []ExcludedGoods            `json:"excluded"`      //最近一次获取购物车时未加入下单的商品
+	Substitutions      []Substitution             `json:"substitutions"` //本次下单中替换的缺货商品
 	FloorInfo          FloorInfo                  `json:"floorInfo"`
 	StoreList          map[string]Store           `json:"store"`
 	Client             *http.Client               `json:"client"`
 	Cart               Cart                       `json:"cart"`
+	Limiter            *Limiter                   `json:"-"`
+	Clock              *ServerClock               `json:"-"`
 }
 
-func (s *DingdongSession) InitSession(conf Config) error {
+func (s *DingdongSession) InitSession(ctx context.Context, conf Config) error {
 	fmt.Println("########## 初始化 ##########")
 	s.Client = &http.Client{Timeout: 60 * time.Second}
 	s.Conf = conf
+	if s.Limiter == nil {
+		backoff := s.Conf.Backoff
+		if backoff == (Backoff{}) {
+			backoff = DefaultBackoff
+		}
+		s.Limiter = NewLimiter(s.Conf.Intervals, backoff)
+	}
+	if s.Clock == nil {
+		s.Clock = &ServerClock{}
+	}
 
 	if len(s.Conf.PromotionId) > 0 {
 		fmt.Println("########## 当前选择优惠券 ##########")
@@ -54,43 +92,6 @@ func (s *DingdongSession) InitSession(conf Config) error {
 	} else {
 		fmt.Println("########## 当前没有选择优惠券 ##########")
 	}
-	stdin := bufio.NewReader(os.Stdin)
-
-	err, addrList := s.GetAddress()
-	if err != nil {
-		return err
-	}
-	if len(addrList) == 0 {
-		return errors.New("未查询到有效收货地址，请前往app添加或检查cookie是否正确！")
-	}
-	if s.Conf.AddressId != "" {
-		for _, v := range addrList {
-			if v.AddressId == s.Conf.AddressId {
-				s.Address = v
-				fmt.Printf("收货地址 :  %s %s %s %s %s \n", s.Address.Name, s.Address.DistrictName, s.Address.ReceiverAddress, s.Address.DetailAddress, s.Address.Mobile)
-			}
-		}
-	}
-	if s.Address.AddressId == "" {
-		fmt.Println("########## 选择收货地址 ##########")
-		for i, addr := range addrList {
-			fmt.Printf("[%v] Id: %s %s %s %s %s %s \n", i, addr.AddressId, addr.Name, addr.DistrictName, addr.ReceiverAddress, addr.DetailAddress, addr.Mobile)
-		}
-
-		var index int
-		for true {
-			fmt.Println("请输入地址序号（0, 1, 2...)：")
-			_, err := fmt.Fscanln(stdin, &index)
-			if err != nil {
-				fmt.Printf("输入有误：%s!\n", err)
-			} else if index >= len(addrList) {
-				fmt.Println("输入有误：超过最大序号！")
-			} else {
-				break
-			}
-		}
-		s.Address = addrList[index]
-	}
 
 	fmt.Println("########## 选择支付方式 ##########")
 	switch s.Conf.PayMethod {
@@ -102,33 +103,95 @@ func (s *DingdongSession) InitSession(conf Config) error {
 		return errors.New("选择支付方式有误！")
 	}
 
+	err, addrList := s.GetAddress(ctx)
+	if err != nil {
+		return err
+	}
+	if len(addrList) == 0 {
+		return errors.New("未查询到有效收货地址，请前往app添加或检查cookie是否正确！")
+	}
+	s.AddressList = addrList
+
+	selector := s.Conf.AddressSelector
+	if selector == nil {
+		selector = FirstAddress(SelectAddressById(s.Conf.AddressId), SelectAddressById(s.Conf.AddressIds...), SelectAddressByKeyword(s.Conf.AddressKeyword), PromptAddress(os.Stdin, os.Stdout))
+	}
+	addr, err := selector.Select(addrList)
+	if err != nil {
+		return err
+	}
+	if addr == nil {
+		return ErrAddressNotSelected
+	}
+	s.Address = *addr
+	fmt.Printf("收货地址 :  %s %s %s %s %s \n", s.Address.Name, s.Address.DistrictName, s.Address.ReceiverAddress, s.Address.DetailAddress, s.Address.Mobile)
+
 	return nil
 }
 
-func (s *DingdongSession) NewRequest(method, url string, dataStr []byte) *http.Request {
+func (s *DingdongSession) NewRequest(ctx context.Context, method, url string, dataStr []byte) *http.Request {
 
 	var body io.Reader = nil
 	if dataStr != nil {
 		body = bytes.NewReader(dataStr)
 	}
-	req, _ := http.NewRequest(method, url, body)
+	req, _ := http.NewRequestWithContext(ctx, method, url, body)
 
-	req.Header.Set("Host", "api-sams.walmartmobile.cn")
 	req.Header.Set("content-type", "application/json;charset=UTF-8")
 	//req.Header.Set("accept", "*/*")
 	req.Header.Set("auth-token", s.Conf.AuthToken)
 	req.Header.Set("longitude", s.Conf.Longitude)
 	req.Header.Set("latitude", s.Conf.Latitude)
 	req.Header.Set("device-id", s.Conf.Deviceid)
-	req.Header.Set("app-version", "5.0.47.0")
-	req.Header.Set("device-type", "ios")
-	req.Header.Set("Accept-Language", "zh-Hans-CN;q=1")
-	//req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("apptype", "ios")
-	req.Header.Set("device-name", "iPhone14,5")
-	req.Header.Set("device-os-version", "15.4.1")
-	req.Header.Set("User-Agent", "SamClub/5.0.47 (iPhone; iOS 15.4.1; Scale/3.00)")
-	req.Header.Set("system-language", "CN")
+	s.Conf.Device.Apply(req.Header)
 
 	return req
 }
+
+// doRequest 发送请求并解析响应，HTTP状态码不为200或code不为Success时返回*APIError
+func (s *DingdongSession) doRequest(endpoint string, req *http.Request) (result gjson.Result, err error) {
+	if s.Limiter != nil {
+		if err := s.Limiter.Wait(req.Context(), endpoint); err != nil {
+			return gjson.Result{}, err
+		}
+		defer func() {
+			if req.Context().Err() == nil {
+				s.Limiter.Done(endpoint, err)
+			}
+		}()
+	}
+
+	sent := time.Now()
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	if s.Clock != nil {
+		s.Clock.Observe(sent, time.Now(), resp.Header.Get("Date"))
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return gjson.Result{}, newHTTPError(endpoint, resp.StatusCode, body)
+	}
+	result = gjson.ParseBytes(body)
+	if result.Get("code").Str != "Success" {
+		return result, newAPIError(endpoint, result)
+	}
+	return result, nil
+}
+
+// Sleep 等待d时长，ctx取消时立即返回ctx.Err()
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
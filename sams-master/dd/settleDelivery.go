@@ -1,11 +1,9 @@
 package dd
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"github.com/tidwall/gjson"
-	"io/ioutil"
 )
 
 type SettleDelivery struct {
@@ -91,8 +89,8 @@ type SettleParam struct {
 	GoodsList      []Goods        `json:"goodsList"`
 }
 
-func (s *DingdongSession) CheckSettleInfo() (*SettleInfo, error) {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/trade/settlement/getSettleInfo"
+func (s *DingdongSession) CheckSettleInfo(ctx context.Context) (*SettleInfo, error) {
+	urlPath := s.Conf.EndpointURL(EndpointSettleInfo)
 
 	data := SettleParam{
 		Uid:       s.Uid,
@@ -116,32 +114,11 @@ func (s *DingdongSession) CheckSettleInfo() (*SettleInfo, error) {
 		}
 	}
 	dataStr, _ := json.Marshal(data)
-	req := s.NewRequest("POST", urlPath, dataStr)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
 
-	resp, err := s.Client.Do(req)
+	result, err := s.doRequest(EndpointSettleInfo, req)
 	if err != nil {
 		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			return parseSettleInfo(result), nil
-		case "LIMITED":
-			return nil, LimitedErr
-		case "NO_MATCH_DELIVERY_MODE":
-			return nil, NoMatchDeliverMode
-		case "CART_GOOD_CHANGE":
-			return nil, CartGoodChangeErr
-		default:
-			return nil, errors.New(result.Get("msg").Str)
-		}
-	} else {
-		return nil, errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body))
-	}
+	return parseSettleInfo(result), nil
 }
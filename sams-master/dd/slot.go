@@ -0,0 +1,237 @@
+package dd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slot 配送时段，Start、End由startRealTime、endRealTime(毫秒时间戳)解析
+type Slot struct {
+	Date           string    `json:"date"`
+	ArrivalTimeStr string    `json:"arrivalTimeStr"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Full           bool      `json:"full"`     //已约满或不可用
+	Rank           int       `json:"rank"`     //按偏好排序后的尝试顺序，从1开始，被排除的时段为0
+	Excluded       string    `json:"excluded"` //被排除的原因
+}
+
+// ParseSlot 解析capcityResponseList中的一个时段
+func ParseSlot(date string, v List) (Slot, error) {
+	start, err := parseMillis(v.StartRealTime)
+	if err != nil {
+		return Slot{}, fmt.Errorf("配送时段%s %s开始时间有误: %w", date, v.StartTime, err)
+	}
+	end, err := parseMillis(v.EndRealTime)
+	if err != nil {
+		return Slot{}, fmt.Errorf("配送时段%s %s结束时间有误: %w", date, v.StartTime, err)
+	}
+	return Slot{
+		Date:           date,
+		ArrivalTimeStr: fmt.Sprintf("%s %s - %s", date, v.StartTime, v.EndTime),
+		Start:          start,
+		End:            end,
+		Full:           v.TimeISFull || v.Disabled,
+	}, nil
+}
+
+func parseMillis(s string) (time.Time, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).In(Shanghai), nil
+}
+
+func formatMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// DeliveryInfo 提交订单时使用的配送时间
+func (s Slot) DeliveryInfo() SettleDeliveryInfo {
+	return SettleDeliveryInfo{
+		ExpectArrivalTime:    formatMillis(s.Start),
+		ExpectArrivalEndTime: formatMillis(s.End),
+		ArrivalTimeStr:       s.ArrivalTimeStr,
+	}
+}
+
+// Slots 解析全部配送时段并按开始时间排序，时间戳有误的时段被忽略。
+// 跨天的时段可能在相邻两天的列表中重复出现，按开始和结束时间合并，任一天可用即视为可用
+func (c *Capacity) Slots() []Slot {
+	slots := make([]Slot, 0)
+	index := map[[2]int64]int{}
+	for _, caps := range c.CapCityResponseList {
+		for _, v := range caps.List {
+			slot, err := ParseSlot(caps.StrDate, v)
+			if err != nil {
+				continue
+			}
+			key := [2]int64{slot.Start.UnixNano(), slot.End.UnixNano()}
+			if i, ok := index[key]; ok {
+				if slots[i].Full && !slot.Full {
+					slots[i] = slot
+				}
+				continue
+			}
+			index[key] = len(slots)
+			slots = append(slots, slot)
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Start.Before(slots[j].Start)
+	})
+	return slots
+}
+
+const (
+	SlotEarliest = "earliest" //最早的时段优先
+	SlotLatest   = "latest"   //最晚的时段优先
+)
+
+// HourWindow 每天允许配送的时间窗口 [From, To) 点，时段需完整落在窗口内
+type HourWindow struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// SlotPolicy 配送时段偏好，零值表示不过滤并按最早时段优先
+type SlotPolicy struct {
+	Order        string         `json:"order"`        //earliest(默认)或latest
+	Weekdays     []time.Weekday `json:"weekdays"`     //允许的星期，为空时不限
+	Hours        []HourWindow   `json:"hours"`        //允许的时间窗口，为空时不限
+	ExcludeDates []string       `json:"excludeDates"` //排除的日期，格式 2006-01-02
+	MinLead      time.Duration  `json:"minLead"`      //时段开始时间距当前的最短时长
+}
+
+// Check 返回时段被排除的原因，可用时返回空字符串。now为服务器当前时间
+func (p SlotPolicy) Check(slot Slot, now time.Time) string {
+	start, end := slot.Start.In(Shanghai), slot.End.In(Shanghai)
+	if slot.Full {
+		return "已约满"
+	}
+	if p.MinLead > 0 && start.Sub(now) < p.MinLead {
+		return fmt.Sprintf("距开始不足%v", p.MinLead)
+	}
+	date := start.Format("2006-01-02")
+	for _, d := range p.ExcludeDates {
+		if d == date {
+			return "日期已排除"
+		}
+	}
+	if len(p.Weekdays) > 0 {
+		allowed := false
+		for _, d := range p.Weekdays {
+			allowed = allowed || d == start.Weekday()
+		}
+		if !allowed {
+			return "星期不在允许范围"
+		}
+	}
+	if len(p.Hours) > 0 {
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, Shanghai)
+		allowed := false
+		for _, w := range p.Hours {
+			from, to := day.Add(time.Duration(w.From)*time.Hour), day.Add(time.Duration(w.To)*time.Hour)
+			allowed = allowed || (!start.Before(from) && !end.After(to))
+		}
+		if !allowed {
+			return "时间不在允许范围"
+		}
+	}
+	return ""
+}
+
+// Rank 按偏好排序：可用的时段在前并从1开始编号，被排除的时段在后并记录原因
+func (p SlotPolicy) Rank(slots []Slot, now time.Time) []Slot {
+	ranked := make([]Slot, len(slots))
+	copy(ranked, slots)
+	for i := range ranked {
+		ranked[i].Rank = 0
+		ranked[i].Excluded = p.Check(ranked[i], now)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if (a.Excluded == "") != (b.Excluded == "") {
+			return a.Excluded == ""
+		}
+		if p.Order == SlotLatest {
+			return a.Start.After(b.Start)
+		}
+		return a.Start.Before(b.Start)
+	})
+	for i := range ranked {
+		if ranked[i].Excluded == "" {
+			ranked[i].Rank = i + 1
+		}
+	}
+	return ranked
+}
+
+// ParseWeekdays 解析星期，1-7表示周一到周日，支持范围，如 "1-5,7"
+func ParseWeekdays(s string) ([]time.Weekday, error) {
+	days := make([]time.Weekday, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, err := parseRange(item)
+		if err != nil || from < 1 || to > 7 || from > to {
+			return nil, fmt.Errorf("星期格式有误: %s", item)
+		}
+		for d := from; d <= to; d++ {
+			days = append(days, time.Weekday(d%7))
+		}
+	}
+	return days, nil
+}
+
+// ParseHourWindows 解析时间窗口，如 "9-12,18-21" 表示9点到12点及18点到21点
+func ParseHourWindows(s string) ([]HourWindow, error) {
+	windows := make([]HourWindow, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, err := parseRange(item)
+		if err != nil || !strings.Contains(item, "-") || from < 0 || to > 24 || from >= to {
+			return nil, fmt.Errorf("时间窗口格式有误: %s", item)
+		}
+		windows = append(windows, HourWindow{From: from, To: to})
+	}
+	return windows, nil
+}
+
+// ParseDates 解析日期列表，如 "2022-04-20,2022-04-21"
+func ParseDates(s string) ([]string, error) {
+	dates := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", item); err != nil {
+			return nil, fmt.Errorf("日期格式有误: %s", item)
+		}
+		dates = append(dates, item)
+	}
+	return dates, nil
+}
+
+func parseRange(s string) (int, int, error) {
+	kv := strings.SplitN(s, "-", 2)
+	from, err := strconv.Atoi(strings.TrimSpace(kv[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(kv) == 1 {
+		return from, from, nil
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+	return from, to, err
+}
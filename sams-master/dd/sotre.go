@@ -1,9 +1,8 @@
 package dd
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"github.com/tidwall/gjson"
 	"io/ioutil"
 )
@@ -42,8 +41,8 @@ func (s *DingdongSession) GetStoreList(result gjson.Result) []Store {
 	return c
 }
 
-func (s *DingdongSession) CheckStore() ([]Store, error) {
-	urlPath := "https://api-sams.walmartmobile.cn/api/v1/sams/merchant/storeApi/getRecommendStoreListByLocation"
+func (s *DingdongSession) CheckStore(ctx context.Context) ([]Store, error) {
+	urlPath := s.Conf.EndpointURL(EndpointStoreList)
 
 	data := StoreListParam{
 		Longitude: s.Address.Longitude,
@@ -51,26 +50,39 @@ func (s *DingdongSession) CheckStore() ([]Store, error) {
 	}
 	dataStr, _ := json.Marshal(data)
 
-	req := s.NewRequest("POST", urlPath, dataStr)
+	req := s.NewRequest(ctx, "POST", urlPath, dataStr)
 
-	resp, err := s.Client.Do(req)
+	result, err := s.doRequest(EndpointStoreList, req)
 	if err != nil {
 		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
+	return s.GetStoreList(result), nil
+}
+
+// MergeStores 合并门店列表，返回新增或配送信息发生变化的门店
+func (s *DingdongSession) MergeStores(stores []Store) []Store {
+	changed := make([]Store, 0)
+	for _, store := range stores {
+		if oStore, ok := s.StoreList[store.StoreId]; !ok || oStore.StoreDeliveryTemplateId != store.StoreDeliveryTemplateId || oStore.AreaBlockId != store.AreaBlockId {
+			s.StoreList[store.StoreId] = store
+			changed = append(changed, store)
+		}
+	}
+	return changed
+}
+
+// LoadStoreConf 预加载商店信息文件，返回新增的门店
+func (s *DingdongSession) LoadStoreConf(path string) ([]Store, error) {
+	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	resp.Body.Close()
-	if resp.StatusCode == 200 {
-		result := gjson.Parse(string(body))
-		switch result.Get("code").Str {
-		case "Success":
-			return s.GetStoreList(result), nil
-		default:
-			return nil, errors.New(result.Get("msg").Str)
+	added := make([]Store, 0)
+	for _, store := range s.GetStoreList(gjson.ParseBytes(bytes)) {
+		if _, ok := s.StoreList[store.StoreId]; !ok {
+			s.StoreList[store.StoreId] = store
+			added = append(added, store)
 		}
-	} else {
-		return nil, errors.New(fmt.Sprintf("[%v] %s", resp.StatusCode, body))
 	}
+	return added, nil
 }
@@ -0,0 +1,103 @@
+package dd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 库存不足购物车中的数量时的处理方式
+const (
+	PartialAccept  = "accept"  //接受可购买的数量
+	PartialFull    = "full"    //要求购物车中的全部数量
+	PartialAtLeast = "atleast" //至少AtLeast件，购物车中的数量更少时要求全部数量
+)
+
+// PartialStock 库存不足时的处理方式，零值为PartialAccept
+type PartialStock struct {
+	Mode    string
+	AtLeast int
+}
+
+// MinQuantity 购物车中为wanted件时可接受的最少数量
+func (p PartialStock) MinQuantity(wanted int) int {
+	switch p.Mode {
+	case PartialFull:
+		return wanted
+	case PartialAtLeast:
+		if p.AtLeast < wanted {
+			return p.AtLeast
+		}
+		return wanted
+	default:
+		return 1
+	}
+}
+
+func (p PartialStock) String() string {
+	if p.Mode == PartialAtLeast {
+		return fmt.Sprintf("%s:%d", p.Mode, p.AtLeast)
+	}
+	if p.Mode == "" {
+		return PartialAccept
+	}
+	return p.Mode
+}
+
+// ParsePartialStock 解析库存不足时的处理方式，如 accept、full 或 atleast:2
+func ParsePartialStock(s string) (PartialStock, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "" || s == PartialAccept:
+		return PartialStock{}, nil
+	case s == PartialFull:
+		return PartialStock{Mode: PartialFull}, nil
+	case strings.HasPrefix(s, PartialAtLeast+":"):
+		n, err := strconv.Atoi(strings.TrimPrefix(s, PartialAtLeast+":"))
+		if err != nil || n < 1 {
+			return PartialStock{}, fmt.Errorf("partialStock格式有误，至少的数量应为正整数: %s", s)
+		}
+		return PartialStock{Mode: PartialAtLeast, AtLeast: n}, nil
+	default:
+		return PartialStock{}, fmt.Errorf("partialStock只能为%s、%s或%s:N: %s", PartialAccept, PartialFull, PartialAtLeast, s)
+	}
+}
+
+// ParseMinQuantities 解析按SPU配置的最少数量，如 spu1:6,spu2:2
+func ParseMinQuantities(s string) (map[string]int, error) {
+	quantities := map[string]int{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		spuId := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || spuId == "" {
+			return nil, fmt.Errorf("最少数量格式有误，应为 spuId:数量: %s", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("最少数量应为正整数: %s", item)
+		}
+		quantities[spuId] = n
+	}
+	return quantities, nil
+}
+
+// MinQuantity 商品可接受的最少数量，可购买数量更少时不加入下单：
+// 按SPU配置了最少数量时使用配置值，否则必需商品要求购物车中的全部数量，其他商品按PartialStock处理。
+// 最少数量不超过购物车中的数量
+func (c Config) MinQuantity(goods NormalGoods) int {
+	wanted := goods.Quantity
+	if n, ok := c.MinQuantities[goods.SpuId]; ok {
+		if n < wanted {
+			return n
+		}
+		return wanted
+	}
+	if c.Priorities.Of(goods.SpuId) == PriorityMustHave {
+		return wanted
+	}
+	return c.PartialStock.MinQuantity(wanted)
+}
@@ -0,0 +1,71 @@
+package dd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Alternative 缺货商品的一个替代商品，Ratio为原商品每件对应的替代商品数量
+type Alternative struct {
+	SpuId string
+	Ratio int
+}
+
+// Quantity 原商品为quantity件时替代商品的数量
+func (a Alternative) Quantity(quantity int) int {
+	return quantity * a.Ratio
+}
+
+// Substitutions 按SPU配置的替代商品，缺货时按顺序尝试
+type Substitutions map[string][]Alternative
+
+// Substitution 一次替换：缺货的商品由替代商品代替下单
+type Substitution struct {
+	SpuId              string `json:"spuId"`
+	GoodsName          string `json:"goodsName"`
+	Quantity           int    `json:"quantity"`
+	Substitute         string `json:"substitute"`
+	SubstituteName     string `json:"substituteName"`
+	SubstituteQuantity int    `json:"substituteQuantity"`
+}
+
+func (s Substitution) String() string {
+	name := s.SubstituteName
+	if name == "" {
+		name = s.Substitute
+	}
+	return fmt.Sprintf("%s x%d → %s x%d", s.GoodsName, s.Quantity, name, s.SubstituteQuantity)
+}
+
+// ParseSubstitutions 解析替代规则，如 spuA:spuB*2|spuC,spuX:spuY，
+// 表示spuA缺货时先尝试spuB(每件换2件)，再尝试spuC(每件换1件)
+func ParseSubstitutions(s string) (Substitutions, error) {
+	substitutions := Substitutions{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		spuId := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || spuId == "" {
+			return nil, fmt.Errorf("替代规则格式有误，应为 spuId:替代spuId[*数量]|...: %s", item)
+		}
+		for _, v := range strings.Split(kv[1], "|") {
+			alt := Alternative{SpuId: strings.TrimSpace(v), Ratio: 1}
+			if i := strings.Index(alt.SpuId, "*"); i >= 0 {
+				ratio, err := strconv.Atoi(strings.TrimSpace(alt.SpuId[i+1:]))
+				if err != nil || ratio < 1 {
+					return nil, fmt.Errorf("替代商品数量应为正整数: %s", item)
+				}
+				alt.SpuId, alt.Ratio = strings.TrimSpace(alt.SpuId[:i]), ratio
+			}
+			if alt.SpuId == "" || alt.SpuId == spuId {
+				return nil, fmt.Errorf("替代商品有误: %s", item)
+			}
+			substitutions[spuId] = append(substitutions[spuId], alt)
+		}
+	}
+	return substitutions, nil
+}
@@ -0,0 +1,99 @@
+package dd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ExpressWeightLimit 急速达单笔订单限重(kg)
+const ExpressWeightLimit = 30.0
+
+// weightEpsilon 比较重量时忽略浮点误差
+const weightEpsilon = 1e-6
+
+// ErrOverWeight 只保留必需商品仍超过限重
+var ErrOverWeight = errors.New("必需商品超过限重")
+
+// WeightLimit 单笔订单限重(kg)，MaxWeight大于0时使用配置值，否则急速达为ExpressWeightLimit，其他配送方式不限重(返回0)
+func (c Config) WeightLimit() float64 {
+	if c.MaxWeight > 0 {
+		return c.MaxWeight
+	}
+	if c.DeliveryType == 1 {
+		return ExpressWeightLimit
+	}
+	return 0
+}
+
+// GoodsWeight 商品总重量(kg)
+func GoodsWeight(goodsList []Goods) float64 {
+	weight := 0.0
+	for _, goods := range goodsList {
+		weight += goods.Weight * float64(goods.Quantity)
+	}
+	return weight
+}
+
+// ReduceWeight 总重量超过limit时一次性减少商品：先按优先级从低到高、同一优先级中单件从重到轻逐件减少，
+// 直到不超过限重，尽量少减少商品；再按相反的顺序放回减少过多的商品。
+// 必需商品不会被减少，数量减少到MinQuantity以下时移除该商品。
+// 返回调整后的商品及被调整的商品；只保留必需商品仍超重或没有可下单的商品时返回ErrOverWeight
+func ReduceWeight(goodsList []Goods, limit float64) ([]Goods, []GoodsTrim, error) {
+	weight := GoodsWeight(goodsList)
+	if limit <= 0 || weight <= limit+weightEpsilon {
+		return goodsList, nil, nil
+	}
+
+	goods := append([]Goods(nil), goodsList...)
+	order := make([]int, 0, len(goods))
+	for i, g := range goods {
+		if g.Priority != PriorityMustHave && g.Weight > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		gi, gj := goods[order[i]], goods[order[j]]
+		if gi.Priority != gj.Priority {
+			return gi.Priority < gj.Priority
+		}
+		return gi.Weight > gj.Weight
+	})
+
+	for _, i := range order {
+		for goods[i].Quantity > 0 && weight > limit+weightEpsilon {
+			weight -= goods[i].Weight * float64(goods[i].reduce())
+		}
+		if weight <= limit+weightEpsilon {
+			break
+		}
+	}
+	if weight > limit+weightEpsilon {
+		_, trims := trimResult(goodsList, goods)
+		return nil, trims, fmt.Errorf("%w: 总重%.1fkg，限重%.1fkg", ErrOverWeight, GoodsWeight(goodsList), limit)
+	}
+
+	putBack(goodsList, goods, order, limit-weight, func(g Goods) float64 {
+		return g.Weight
+	})
+
+	result, trims := trimResult(goodsList, goods)
+	if len(result) == 0 {
+		return nil, trims, fmt.Errorf("%w: 总重%.1fkg，限重%.1fkg，减少后没有可下单的商品", ErrOverWeight, GoodsWeight(goodsList), limit)
+	}
+	return result, trims, nil
+}
+
+// ReduceWeightOnce 提交订单时服务器仍提示超重(商品重量缺失或与服务器计算不一致)时，以略低于当前总重的限重调用ReduceWeight，
+// 即减少优先级最低的商品中最重的一件(数量不超过MinQuantity时移除)；没有可减少的商品时返回ErrOverWeight
+func ReduceWeightOnce(goodsList []Goods) ([]Goods, []GoodsTrim, error) {
+	weight := GoodsWeight(goodsList)
+	if weight <= 2*weightEpsilon {
+		return nil, nil, fmt.Errorf("%w: 商品重量未知，无法减少商品", ErrOverWeight)
+	}
+	goods, trims, err := ReduceWeight(goodsList, weight-2*weightEpsilon)
+	if err != nil {
+		return nil, trims, fmt.Errorf("%w: 提交订单时提示超重，总重%.1fkg，没有可减少的商品", ErrOverWeight, weight)
+	}
+	return goods, trims, nil
+}
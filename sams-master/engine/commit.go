@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+type commitResult struct {
+	key   int
+	order *dd.Order
+	err   error
+}
+
+// DefaultStagger 并发提交时相邻两次提交的默认间隔
+const DefaultStagger = 100 * time.Millisecond
+
+// commitPayConcurrent 为前Concurrency个配送时段按Stagger错开提交订单，每次提交前检查是否已有订单成功，
+// 已成功时不再提交其余时段，并取消未返回的请求；间隔内有时段提交失败时不再等待，立即提交下一个时段。
+// 错开提交只能减少重复下单：前一个请求在间隔内未返回时仍会提交下一个时段，
+// 已发出的请求也可能在取消前已被服务器受理，此类订单通过DuplicateOrder事件报告
+func (e *Engine) commitPayConcurrent(ctx context.Context, keys []int) (State, error) {
+	session := e.Session
+	if len(keys) > e.Options.Concurrency {
+		keys = keys[:e.Options.Concurrency]
+	}
+	commitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan commitResult, len(keys))
+	var firstErr error
+	handle := func(r commitResult) {
+		switch {
+		case r.err == nil && e.order == nil:
+			cancel()
+			e.order = r.order
+			e.publish(OrderPlaced{Order: r.order, Substitutions: session.Substitutions})
+		case r.err == nil:
+			e.publish(DuplicateOrder{Order: r.order, First: e.order})
+		case commitCtx.Err() != nil && ctx.Err() == nil:
+			// 其他时段已下单成功后被取消的请求
+		default:
+			if dd.ClassOf(r.err) == dd.ClassSlotExhausted {
+				e.dropSlot(r.key)
+			}
+			if firstErr == nil || moreUrgent(r.err, firstErr) {
+				e.slotKey = r.key
+				firstErr = r.err
+			}
+		}
+	}
+
+	pending := 0
+	for i, k := range keys {
+		if i > 0 && e.Options.Stagger > 0 {
+			// 等待间隔期间处理已返回的结果
+			timer := time.NewTimer(e.Options.Stagger)
+			for waiting := true; waiting && e.order == nil && ctx.Err() == nil; {
+				select {
+				case r := <-results:
+					pending--
+					handle(r)
+					waiting = r.err == nil
+				case <-timer.C:
+					waiting = false
+				case <-ctx.Done():
+				}
+			}
+			timer.Stop()
+		}
+		if e.order != nil || ctx.Err() != nil {
+			break
+		}
+		slot := session.SettleDeliveryInfo[k]
+		e.publish(CommitAttempted{Slot: slot})
+		pending++
+		go func(k int, slot dd.SettleDeliveryInfo) {
+			order, err := session.CommitPay(commitCtx, slot)
+			results <- commitResult{key: k, order: order, err: err}
+		}(k, slot)
+	}
+	for ; pending > 0; pending-- {
+		handle(<-results)
+	}
+
+	if e.order != nil {
+		return StateDone, nil
+	}
+	if ctx.Err() != nil {
+		return StateOrder, ctx.Err()
+	}
+	return StateOrder, firstErr
+}
+
+// moreUrgent 多个时段同时失败时，需要刷新购物车或门店的错误优先于其他错误决定下一步
+func moreUrgent(err, than error) bool {
+	rank := func(err error) int {
+		switch dd.ClassOf(err) {
+		case dd.ClassAuthExpired, dd.ClassFatal:
+			return 4
+		case dd.ClassRefreshStore:
+			return 3
+		case dd.ClassRefreshCart:
+			return 2
+		case dd.ClassRetryable, dd.ClassUnknown:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return rank(err) > rank(than)
+}
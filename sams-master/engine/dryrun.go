@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"github.com/robGoods/sams/dd"
+)
+
+// DryRunPlan 演练模式下构造的提交订单参数，Payload与实际提交时发送的内容一致
+type DryRunPlan struct {
+	Payload dd.CommitPayPram `json:"payload"` //排名第一的配送时段的提交参数
+	Slots   []dd.Slot        `json:"slots"`   //按偏好排序的全部配送时段
+	Coupons []dd.CouponInfo  `json:"coupons"`
+	Goods   []dd.Goods       `json:"goods"` //本次下单的商品及数量
+}
+
+// Plan 演练模式下构造的提交订单参数，未执行到提交订单时为nil；多楼层下单时见Results
+func (e *Engine) Plan() *DryRunPlan {
+	return e.plan
+}
+
+// dryRun 为排名第一的配送时段构造提交订单的参数，不提交
+func (e *Engine) dryRun(keys []int) (State, error) {
+	session := e.Session
+	payload := session.NewCommitPayPram(session.SettleDeliveryInfo[keys[0]])
+	payload.GoodsList = append([]dd.Goods(nil), payload.GoodsList...)
+
+	e.plan = &DryRunPlan{
+		Payload: payload,
+		Slots:   append([]dd.Slot(nil), session.Slots...),
+		Coupons: payload.CouponList,
+		Goods:   payload.GoodsList,
+	}
+	e.publish(DryRunReady{Floor: e.floor, Plan: e.plan})
+	return StateDone, nil
+}
@@ -0,0 +1,497 @@
+// Package engine 实现下单流程的状态机：
+// 切换地址 → 获取门店 → 获取购物车 → 校验商品 → 结算 → 获取配送时间 → 提交订单。
+// 步骤之间的跳转由错误分类(dd.ErrorClass)决定，命令行和Web服务共用同一套流程。
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+var ErrNoGoods = errors.New("当前购物车中无有效商品")
+var ErrNoSlots = errors.New("当前无可用配送时间段")
+var ErrDeliveryFee = errors.New("当前订单需要运费")
+
+// Options 引擎配置，零值可用
+type Options struct {
+	Sleep SleepFunc   //等待函数，默认dd.Sleep
+	Retry RetryPolicy //失败后的等待策略，默认DefaultRetry
+
+	StartAt  time.Time     //开抢时间(服务器时间)，零值表示立即开始；获取配送时间和提交订单在此时间之后执行
+	LeadTime time.Duration //准备步骤提前于StartAt执行的时长
+
+	Concurrency int           //为前N个配送时段错开提交订单，小于2时逐个提交
+	Stagger     time.Duration //并发提交时相邻两次提交的间隔，不大于0时同时提交，建议使用DefaultStagger
+	MaxFailures int           //失败的累计次数上限，达到后放弃(多楼层时只放弃该楼层)，0表示不限
+	DryRun      bool          //演练模式，获取配送时间后只构造提交订单的参数，不提交
+
+	Subscribers []Subscriber //事件订阅者，也可通过Engine.Subscribe添加
+}
+
+// Engine 下单流程状态机
+type Engine struct {
+	Session *dd.DingdongSession
+	Options Options
+
+	bus      Bus
+	state    State
+	attempt  int
+	failures int
+	released bool
+	slotKey  int
+	order    *dd.Order
+	plan     *DryRunPlan
+
+	replacements map[string]*replacement //缺货商品当前使用的替代商品，key为原商品SPU
+	added        map[string]int          //为替换加入购物车的商品及数量
+	planned      map[string]bool         //演练模式下已发布替换计划的原商品
+	unavailable  map[string]bool         //商品校验判定为缺货的商品
+
+	parent   *Engine       //多楼层下单时，各楼层的引擎通过parent发布事件和切换地址
+	floor    dd.Floor      //楼层引擎负责的楼层，单楼层时为零值
+	children []*Engine     //多楼层下单时各楼层的引擎
+	results  []FloorResult //多楼层下单时各楼层的结果
+}
+
+// New 创建引擎，session需已完成InitSession
+func New(session *dd.DingdongSession, opts Options) *Engine {
+	if opts.Sleep == nil {
+		opts.Sleep = dd.Sleep
+	}
+	if opts.Retry == nil {
+		opts.Retry = DefaultRetry
+	}
+	e := &Engine{Session: session, Options: opts}
+	for _, s := range opts.Subscribers {
+		e.bus.Subscribe(s)
+	}
+	return e
+}
+
+// Subscribe 订阅引擎事件
+func (e *Engine) Subscribe(s Subscriber) {
+	e.bus.Subscribe(s)
+}
+
+// State 当前步骤
+func (e *Engine) State() State {
+	return e.state
+}
+
+// Run 执行下单流程直到下单成功、ctx取消或遇到无法继续的错误。
+// Session.Conf.Floors包含多个楼层时，各楼层分别下单，见runFloors。
+// 演练模式下不提交订单，返回的订单为nil，构造的参数见Plan
+func (e *Engine) Run(ctx context.Context) (*dd.Order, error) {
+	if floors := e.Session.Conf.Floors; len(floors) > 1 {
+		return e.runFloors(ctx, floors)
+	} else if len(floors) == 1 {
+		e.Session.Conf.FloorId, e.Session.Conf.DeliveryType = floors[0].FloorId, floors[0].DeliveryType
+	}
+
+	if err := e.start(ctx); err != nil {
+		return nil, err
+	}
+	for e.state != StateDone {
+		if err := e.advance(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return e.order, nil
+}
+
+// start 重置状态，指定开抢时间时等待到准备步骤开始
+func (e *Engine) start(ctx context.Context) error {
+	e.state = StateSaveAddress
+	e.failures = 0
+	e.released = e.Options.StartAt.IsZero()
+	if e.released {
+		return nil
+	}
+	return e.waitUntil(ctx, e.Options.StartAt.Add(-e.Options.LeadTime), PhasePrepare)
+}
+
+// gated 是否需要等待开抢时间后才能执行当前步骤
+func (e *Engine) gated() bool {
+	return !e.released && (e.state == StateCapacity || e.state == StateOrder)
+}
+
+// advance 执行当前步骤并跳转到下一步，返回无法继续的错误
+func (e *Engine) advance(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.gated() {
+		if err := e.waitUntil(ctx, e.Options.StartAt, PhaseStart); err != nil {
+			return err
+		}
+		e.released = true
+	}
+	e.publish(StepEntered{State: e.state, Floor: e.floor})
+
+	next, err := e.step(ctx, e.state)
+	if err == nil {
+		e.attempt = 0
+		e.state = next
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	class := dd.ClassOf(err)
+	if class == dd.ClassAuthExpired || class == dd.ClassFatal {
+		e.publish(ErrorClassified{State: e.state, Err: err, Class: class, Next: e.state, Fatal: true})
+		return err
+	}
+	e.attempt++
+	e.failures++
+	if max := e.Options.MaxFailures; max > 0 && e.failures >= max {
+		err = fmt.Errorf("累计失败%d次，最后一次%s失败: %w", e.failures, e.state.Title(), err)
+		e.publish(ErrorClassified{State: e.state, Err: err, Class: class, Next: e.state, Fatal: true})
+		return err
+	}
+	delay := e.Options.Retry.Delay(e.state, err, e.attempt)
+	next = e.transition(e.state, err)
+	e.publish(ErrorClassified{State: e.state, Err: err, Class: class, Next: next})
+	if e.canSwitchAddress(err) {
+		if switchErr := e.switchAddress(err); switchErr != nil {
+			e.publish(ErrorClassified{State: e.state, Err: switchErr, Class: dd.ClassFatal, Next: e.state, Fatal: true})
+			return switchErr
+		}
+	}
+	e.state = next
+	if delay > 0 {
+		return e.Options.Sleep(ctx, delay)
+	}
+	return nil
+}
+
+func (e *Engine) publish(ev Event) {
+	if e.parent != nil {
+		e.parent.publish(ev)
+		return
+	}
+	e.bus.Publish(ev)
+}
+
+func (e *Engine) step(ctx context.Context, state State) (State, error) {
+	switch state {
+	case StateSaveAddress:
+		return e.saveAddress(ctx)
+	case StateStores:
+		return e.checkStores(ctx)
+	case StateCart:
+		return e.checkCart(ctx)
+	case StateGoods:
+		return e.checkGoods(ctx)
+	case StateSettle:
+		return e.checkSettle(ctx)
+	case StateCapacity:
+		return e.checkCapacity(ctx)
+	case StateOrder:
+		return e.commitPay(ctx)
+	default:
+		return StateDone, nil
+	}
+}
+
+// transition 根据失败的步骤和错误分类决定下一步
+func (e *Engine) transition(state State, err error) State {
+	if errors.Is(err, dd.NoMatchDeliverMode) || e.canSwitchAddress(err) {
+		return StateSaveAddress
+	}
+	switch dd.ClassOf(err) {
+	case dd.ClassRefreshCart:
+		return StateCart
+	case dd.ClassRefreshStore:
+		return StateStores
+	case dd.ClassSlotExhausted:
+		e.dropSlot(e.slotKey)
+		if len(e.Session.SettleDeliveryInfo) == 0 {
+			return StateCapacity
+		}
+		return StateOrder
+	}
+
+	switch state {
+	case StateCart:
+		return StateStores
+	case StateGoods:
+		return StateCart
+	case StateSettle:
+		if errors.Is(err, ErrDeliveryFee) {
+			return StateCart
+		}
+		return StateGoods
+	case StateOrder:
+		switch {
+		case errors.Is(err, dd.LimitedErr1):
+			return StateOrder
+		case errors.Is(err, dd.CloudGoodsOverWightErr):
+			return StateOrder
+		default:
+			return StateCapacity
+		}
+	default:
+		return state
+	}
+}
+
+// canSwitchAddress 配置了备选地址，且错误为当前地址不支持配送或门店已打烊
+func (e *Engine) canSwitchAddress(err error) bool {
+	return len(e.Session.Conf.AddressIds) > 0 && (errors.Is(err, dd.NoMatchDeliverMode) || errors.Is(err, dd.StoreHasClosedError))
+}
+
+// switchAddress 切换到下一个备选地址并清空门店，之后重新保存地址、获取门店。备选地址用完时返回错误。
+// 多楼层下单时由主引擎为所有楼层切换，见switchFloorsAddress
+func (e *Engine) switchAddress(reason error) error {
+	if e.parent != nil {
+		return e.parent.switchFloorsAddress(reason)
+	}
+	session := e.Session
+	from := session.Address
+	to, err := session.NextAddress()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, reason)
+	}
+	session.StoreList = map[string]dd.Store{}
+	e.publish(AddressSwitched{From: from, To: to, Reason: reason})
+	return nil
+}
+
+func (e *Engine) saveAddress(ctx context.Context) (State, error) {
+	session := e.Session
+	if err := session.SaveDeliveryAddress(ctx); err != nil {
+		return StateSaveAddress, err
+	}
+	e.publish(AddressSaved{Address: session.Address})
+
+	if session.Conf.StoreConf != "" {
+		stores, err := session.LoadStoreConf(session.Conf.StoreConf)
+		if err != nil {
+			e.publish(Notice{Level: "warning", Message: "预加载商店配置失败: " + err.Error()})
+		}
+		if len(stores) > 0 {
+			e.publish(StoresDiscovered{Stores: stores, Source: "conf"})
+		}
+	}
+	return StateStores, nil
+}
+
+func (e *Engine) checkStores(ctx context.Context) (State, error) {
+	stores, err := e.Session.CheckStore(ctx)
+	if err != nil {
+		return StateStores, err
+	}
+	if changed := e.Session.MergeStores(stores); len(changed) > 0 {
+		e.publish(StoresDiscovered{Stores: changed, Source: "api"})
+	}
+	return StateCart, nil
+}
+
+func (e *Engine) checkCart(ctx context.Context) (State, error) {
+	session := e.Session
+	if err := session.CheckCart(ctx); err != nil {
+		return StateCart, err
+	}
+
+	e.selectFloor()
+	for {
+		added, err := e.substitute(ctx)
+		if err != nil {
+			return StateCart, err
+		}
+		if !added {
+			break
+		}
+		e.selectFloor()
+	}
+	//商品校验的结果只用于校验后的这一次刷新，之后按购物车中的库存判断，补货后可以重新下单原商品
+	e.unavailable = nil
+
+	session.GoodsList = make([]dd.Goods, 0)
+	session.Excluded = make([]dd.ExcludedGoods, 0)
+	for _, list := range [][]dd.NormalGoods{session.FloorInfo.NormalGoodsList, session.FloorInfo.ShortageStockGoodsList, session.FloorInfo.AllOutOfStockGoodsList} {
+		for _, goods := range list {
+			if sub, ok := e.substitution(goods.SpuId); ok {
+				e.exclude(goods.Exclude(fmt.Sprintf("缺货，已替换为%s", sub.SubstituteName)))
+				continue
+			}
+			if unused := e.unusedQuantity(goods.SpuId); unused > 0 {
+				if goods.Quantity <= unused {
+					e.exclude(goods.Exclude("未使用的替代商品"))
+					continue
+				}
+				goods.Quantity -= unused
+			}
+			quantity, min := goods.AvailableQuantity(), session.Conf.MinQuantity(goods)
+			switch {
+			case quantity == 0:
+				reason := goods.InvalidReason
+				if reason == "" {
+					reason = "无库存"
+				}
+				e.exclude(goods.Exclude(reason))
+			case session.Conf.IsSelected && !goods.IsSelected:
+				e.exclude(goods.Exclude("未勾选"))
+			case quantity < min:
+				e.exclude(goods.Exclude(fmt.Sprintf("库存不足，可购买%d件，少于最少%d件", quantity, min)))
+			default:
+				goods.Quantity = quantity
+				g := goods.ToGoods()
+				g.MinQuantity = min
+				session.GoodsList = append(session.GoodsList, g)
+			}
+		}
+	}
+
+	session.Conf.Priorities.Assign(session.GoodsList)
+	e.applySubstitutions()
+	if err := e.applyBudget(); err != nil {
+		return StateCart, err
+	}
+	if err := e.applyWeightLimit(); err != nil {
+		return StateCart, err
+	}
+	missing := e.missingMustHave()
+	e.publish(CartLoaded{FloorInfo: session.FloorInfo, Goods: session.GoodsList, Excluded: session.Excluded})
+
+	if len(missing) > 0 {
+		return StateCart, fmt.Errorf("%w: %s", dd.ErrMustHaveMissing, strings.Join(missing, "、"))
+	}
+	if len(session.GoodsList) == 0 {
+		return StateCart, ErrNoGoods
+	}
+	return StateGoods, nil
+}
+
+// selectFloor 从购物车中选出当前下单的楼层
+func (e *Engine) selectFloor() {
+	session := e.Session
+	for _, v := range session.Cart.FloorInfoList {
+		if v.FloorId == session.Conf.FloorId && v.DeliveryType == session.Conf.DeliveryType {
+			session.FloorInfo = v
+		}
+	}
+}
+
+func (e *Engine) checkGoods(ctx context.Context) (State, error) {
+	goods, err := e.Session.CheckGoods(ctx)
+	for _, g := range goods {
+		e.markUnavailable(g.SpuId)
+		e.exclude(g.Exclude("商品校验未通过"))
+	}
+	if err != nil {
+		return StateGoods, err
+	}
+	return StateSettle, nil
+}
+
+func (e *Engine) checkSettle(ctx context.Context) (State, error) {
+	session := e.Session
+	settleInfo, err := session.CheckSettleInfo(ctx)
+	if err != nil {
+		return StateSettle, err
+	}
+	e.publish(SettleChecked{SettleInfo: settleInfo})
+
+	if store, ok := session.StoreList[session.FloorInfo.StoreId]; ok && store.StoreDeliveryTemplateId != settleInfo.SettleDelivery.StoreDeliveryTemplateId {
+		store.StoreDeliveryTemplateId = settleInfo.SettleDelivery.StoreDeliveryTemplateId
+		store.AreaBlockId = settleInfo.SettleDelivery.AreaBlockId
+		session.StoreList[session.FloorInfo.StoreId] = store
+	}
+
+	if session.Conf.DeliveryFee && settleInfo.DeliveryFee != "0" {
+		return StateSettle, ErrDeliveryFee
+	}
+	return StateCapacity, nil
+}
+
+func (e *Engine) checkCapacity(ctx context.Context) (State, error) {
+	session := e.Session
+	capacity, err := session.GetCapacity(ctx, session.StoreList[session.FloorInfo.StoreId].StoreDeliveryTemplateId)
+	if err != nil {
+		//刷新可用配送时间， 会出现“服务器正忙,请稍后再试”， 可以忽略。
+		return StateCapacity, err
+	}
+
+	session.Slots = session.Conf.SlotPolicy.Rank(capacity.Slots(), e.serverNow())
+	session.SettleDeliveryInfo = map[int]dd.SettleDeliveryInfo{}
+	for _, slot := range session.Slots {
+		if slot.Rank > 0 {
+			session.SettleDeliveryInfo[slot.Rank-1] = slot.DeliveryInfo()
+		}
+	}
+
+	e.publish(SlotsFound{Slots: session.Slots})
+	if len(session.SettleDeliveryInfo) == 0 {
+		return StateCapacity, ErrNoSlots
+	}
+	return StateOrder, nil
+}
+
+func (e *Engine) commitPay(ctx context.Context) (State, error) {
+	keys := e.slotKeys()
+	if len(keys) == 0 {
+		return StateCapacity, nil
+	}
+	if e.Options.DryRun {
+		return e.dryRun(keys)
+	}
+
+	var next State
+	var err error
+	if e.Options.Concurrency > 1 && len(keys) > 1 {
+		next, err = e.commitPayConcurrent(ctx, keys)
+	} else {
+		next, err = e.commitPayOnce(ctx, keys[0])
+	}
+	if errors.Is(err, dd.CloudGoodsOverWightErr) {
+		if reduceErr := e.reduceWeight(); reduceErr != nil {
+			return StateOrder, reduceErr
+		}
+	}
+	return next, err
+}
+
+// commitPayOnce 为一个配送时段提交订单
+func (e *Engine) commitPayOnce(ctx context.Context, key int) (State, error) {
+	session := e.Session
+	e.slotKey = key
+	v := session.SettleDeliveryInfo[e.slotKey]
+	e.publish(CommitAttempted{Slot: v})
+	order, err := session.CommitPay(ctx, v)
+	if err != nil {
+		return StateOrder, err
+	}
+
+	e.order = order
+	e.publish(OrderPlaced{Order: order, Substitutions: session.Substitutions})
+	return StateDone, nil
+}
+
+// slotKeys 按偏好排序返回待尝试的配送时段
+func (e *Engine) slotKeys() []int {
+	keys := make([]int, 0, len(e.Session.SettleDeliveryInfo))
+	for k := range e.Session.SettleDeliveryInfo {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// dropSlot 提交时配送时段已约满，不再尝试
+func (e *Engine) dropSlot(key int) {
+	delete(e.Session.SettleDeliveryInfo, key)
+	for i, slot := range e.Session.Slots {
+		if slot.Rank == key+1 {
+			e.Session.Slots[i].Excluded = "提交时已约满"
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// Event 引擎发布的事件
+type Event interface {
+	EventName() string
+}
+
+// StepEntered 进入步骤
+type StepEntered struct {
+	State State
+	Floor dd.Floor //多楼层下单时为当前楼层，否则为零值
+}
+
+// AddressSaved 购物车收货地址已切换
+type AddressSaved struct {
+	Address dd.Address
+}
+
+// AddressSwitched 当前地址不支持配送或门店已打烊，切换到下一个备选地址
+type AddressSwitched struct {
+	From   dd.Address
+	To     dd.Address
+	Reason error
+}
+
+// StoresDiscovered 发现新增或配送信息变化的门店
+type StoresDiscovered struct {
+	Stores []dd.Store
+	Source string //"api" 接口返回，"conf" 商店配置文件
+}
+
+// CartLoaded 购物车已加载，Goods为本次下单的商品，Excluded为未加入下单的商品
+type CartLoaded struct {
+	FloorInfo dd.FloorInfo
+	Goods     []dd.Goods
+	Excluded  []dd.ExcludedGoods
+}
+
+// GoodsExcluded 商品未加入本次下单，原因见Goods.Reason
+type GoodsExcluded struct {
+	Goods dd.ExcludedGoods
+}
+
+// GoodsSubstituted 缺货商品已由替代商品代替下单
+type GoodsSubstituted struct {
+	Substitution dd.Substitution
+}
+
+// DryRunSubstitute 演练模式下缺货商品将由替代商品代替，未加入购物车；Quantity为需要加入购物车的数量
+type DryRunSubstitute struct {
+	Substitution dd.Substitution
+	Quantity     int
+}
+
+// GoodsTrimmed 商品总价超过预算，已按策略减少商品；Amount、Trimmed分别为调整前后的总价(分)
+type GoodsTrimmed struct {
+	Trims     []dd.GoodsTrim
+	Amount    int
+	Trimmed   int
+	MaxAmount int
+}
+
+// WeightReduced 商品总重量超过限重，提交订单前已减少商品；Weight、Reduced分别为调整前后的重量(kg)。
+// Server为true时是提交订单时服务器提示超重后减少的商品
+type WeightReduced struct {
+	Trims   []dd.GoodsTrim
+	Weight  float64
+	Reduced float64
+	Limit   float64
+	Server  bool
+}
+
+// SettleChecked 结算信息已获取
+type SettleChecked struct {
+	SettleInfo *dd.SettleInfo
+}
+
+// SlotsFound 获取到配送时段，Slots按偏好排序，包含被排除的时段
+type SlotsFound struct {
+	Slots []dd.Slot
+}
+
+// CommitAttempted 提交订单
+type CommitAttempted struct {
+	Slot dd.SettleDeliveryInfo
+}
+
+// OrderPlaced 下单成功
+type OrderPlaced struct {
+	Order         *dd.Order
+	Substitutions []dd.Substitution //本次下单中替换的缺货商品
+}
+
+// DuplicateOrder 并发提交时，第一个订单之后又成功提交的订单，需要在app中取消
+type DuplicateOrder struct {
+	Order *dd.Order
+	First *dd.Order
+}
+
+// DryRunReady 演练模式下已构造提交订单的参数，未提交
+type DryRunReady struct {
+	Floor dd.Floor //多楼层下单时为当前楼层，否则为零值
+	Plan  *DryRunPlan
+}
+
+// ErrorClassified 步骤失败，Next为根据错误分类决定的下一步
+type ErrorClassified struct {
+	State State
+	Err   error
+	Class dd.ErrorClass
+	Next  State
+	Fatal bool
+}
+
+// 定时开抢的等待阶段
+const (
+	PhasePrepare = "prepare" //等待执行准备步骤
+	PhaseStart   = "start"   //准备完成，等待开抢
+)
+
+// ScheduleWaiting 按服务器时间等待到Until，Offset为估算的服务器时间减本地时间
+type ScheduleWaiting struct {
+	Phase  string
+	Until  time.Time
+	Offset time.Duration
+}
+
+// Title 步骤名称，多楼层下单时带上楼层
+func (e StepEntered) Title() string {
+	if e.Floor.FloorId == 0 {
+		return e.State.Title()
+	}
+	return fmt.Sprintf("%s %s", e.Floor, e.State.Title())
+}
+
+// FloorFinished 多楼层下单时单个楼层结束，Order为空时Err为放弃的原因
+type FloorFinished struct {
+	Floor dd.Floor
+	Order *dd.Order
+	Err   error
+}
+
+// StockWatched 关注库存模式首次获取购物车后关注的商品及当前库存
+type StockWatched struct {
+	Goods []StockStatus
+}
+
+// BackInStock 关注的商品从无货变为有货
+type BackInStock struct {
+	Goods StockStatus
+}
+
+// OutOfStock 关注的商品从有货变为无货
+type OutOfStock struct {
+	Goods StockStatus
+}
+
+// Notice 其他提示信息
+type Notice struct {
+	Level   string
+	Message string
+}
+
+func (StepEntered) EventName() string      { return "step_entered" }
+func (AddressSaved) EventName() string     { return "address_saved" }
+func (AddressSwitched) EventName() string  { return "address_switched" }
+func (StoresDiscovered) EventName() string { return "stores_discovered" }
+func (CartLoaded) EventName() string       { return "cart_loaded" }
+func (GoodsExcluded) EventName() string    { return "goods_excluded" }
+func (GoodsSubstituted) EventName() string { return "goods_substituted" }
+func (DryRunSubstitute) EventName() string { return "dry_run_substitute" }
+func (GoodsTrimmed) EventName() string     { return "goods_trimmed" }
+func (WeightReduced) EventName() string    { return "weight_reduced" }
+func (SettleChecked) EventName() string    { return "settle_checked" }
+func (SlotsFound) EventName() string       { return "slots_found" }
+func (CommitAttempted) EventName() string  { return "commit_attempted" }
+func (OrderPlaced) EventName() string      { return "order_placed" }
+func (DuplicateOrder) EventName() string   { return "duplicate_order" }
+func (DryRunReady) EventName() string      { return "dry_run_ready" }
+func (ErrorClassified) EventName() string  { return "error_classified" }
+func (ScheduleWaiting) EventName() string  { return "schedule_waiting" }
+func (FloorFinished) EventName() string    { return "floor_finished" }
+func (StockWatched) EventName() string     { return "stock_watched" }
+func (BackInStock) EventName() string      { return "back_in_stock" }
+func (OutOfStock) EventName() string       { return "out_of_stock" }
+func (Notice) EventName() string           { return "notice" }
+
+// Subscriber 事件订阅者，Handle在引擎所在的goroutine中同步调用
+type Subscriber interface {
+	Handle(ev Event)
+}
+
+// SubscriberFunc 将函数转换为Subscriber
+type SubscriberFunc func(ev Event)
+
+func (f SubscriberFunc) Handle(ev Event) {
+	f(ev)
+}
+
+// Bus 事件分发
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []Subscriber
+}
+
+// Subscribe 添加订阅者
+func (b *Bus) Subscribe(s Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, s)
+}
+
+// Publish 将事件依次发送给所有订阅者
+func (b *Bus) Publish(ev Event) {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+	for _, s := range subscribers {
+		s.Handle(ev)
+	}
+}
+
+// Describe 返回事件的日志级别和描述，供命令行和Web日志使用
+func Describe(ev Event) (level, message string) {
+	switch e := ev.(type) {
+	case StepEntered:
+		return "info", fmt.Sprintf("%s【%s】", e.Title(), time.Now().Format("15:04:05"))
+	case AddressSaved:
+		a := e.Address
+		return "success", fmt.Sprintf("切换成功: %s %s %s %s %s", a.Name, a.DistrictName, a.ReceiverAddress, a.DetailAddress, a.Mobile)
+	case AddressSwitched:
+		return "warning", fmt.Sprintf("%s，切换备选地址: %s %s %s → %s %s %s", e.Reason, e.From.Name, e.From.DistrictName, e.From.DetailAddress, e.To.Name, e.To.DistrictName, e.To.DetailAddress)
+	case StoresDiscovered:
+		message = "发现商店:"
+		if e.Source == "conf" {
+			message = "预加载商店:"
+		}
+		for index, store := range e.Stores {
+			message += fmt.Sprintf("\n[%v] Id：%s 名称：%s, 类型 ：%s", index, store.StoreId, store.StoreName, store.StoreType)
+		}
+		return "info", message
+	case CartLoaded:
+		message = fmt.Sprintf("购物车有效商品%d件:", len(e.Goods))
+		for index, goods := range e.Goods {
+			message += fmt.Sprintf("\n[%v] %s 数量：%v 总价：%d * %d, 是否勾选： %v", index, goods.GoodsName, goods.Quantity, goods.Price, goods.Quantity, goods.IsSelected)
+		}
+		return "info", message
+	case GoodsExcluded:
+		if e.Goods.Priority == dd.PriorityMustHave {
+			return "error", fmt.Sprintf("排除%s商品: %s (%s)", e.Goods.Priority.Title(), e.Goods.GoodsName, e.Goods.Reason)
+		}
+		return "warning", fmt.Sprintf("排除商品: %s (%s)", e.Goods.GoodsName, e.Goods.Reason)
+	case GoodsSubstituted:
+		return "info", fmt.Sprintf("替换缺货商品: %s", e.Substitution)
+	case DryRunSubstitute:
+		return "warning", fmt.Sprintf("演练模式，未将替代商品加入购物车(%d件): %s", e.Quantity, e.Substitution)
+	case GoodsTrimmed:
+		message = fmt.Sprintf("商品总价%s元超过上限%s元，调整后为%s元:", dd.FormatAmount(e.Amount), dd.FormatAmount(e.MaxAmount), dd.FormatAmount(e.Trimmed))
+		return "warning", message + describeTrims(e.Trims)
+	case WeightReduced:
+		message = fmt.Sprintf("商品总重%.1fkg超过限重%.1fkg，调整后为%.1fkg:", e.Weight, e.Limit, e.Reduced)
+		if e.Server {
+			message = fmt.Sprintf("提交订单时提示超重，商品总重%.1fkg，调整后为%.1fkg:", e.Weight, e.Reduced)
+		}
+		return "warning", message + describeTrims(e.Trims)
+	case SettleChecked:
+		return "info", fmt.Sprintf("运费： %s", e.SettleInfo.DeliveryFee)
+	case SlotsFound:
+		level = "success"
+		if len(e.Slots) == 0 || e.Slots[0].Rank == 0 {
+			level, message = "warning", "没有符合偏好的配送时段"
+		}
+		for _, v := range e.Slots {
+			if v.Rank > 0 {
+				message += fmt.Sprintf("\n[%d] 发现可用的配送时段::%s!", v.Rank, v.ArrivalTimeStr)
+			} else {
+				message += fmt.Sprintf("\n[-] 排除配送时段::%s (%s)", v.ArrivalTimeStr, v.Excluded)
+			}
+		}
+		return level, strings.TrimPrefix(message, "\n")
+	case CommitAttempted:
+		return "info", fmt.Sprintf("配送时段: %s", e.Slot.ArrivalTimeStr)
+	case OrderPlaced:
+		message = fmt.Sprintf("抢购成功！订单号: %s，请前往app付款！", e.Order.OrderNo)
+		for _, sub := range e.Substitutions {
+			message += fmt.Sprintf("\n替换商品: %s", sub)
+		}
+		return "success", message
+	case DuplicateOrder:
+		return "warning", fmt.Sprintf("重复下单！订单号: %s（已成功订单: %s），请前往app取消多余订单！", e.Order.OrderNo, e.First.OrderNo)
+	case DryRunReady:
+		return "success", describeDryRun(e)
+	case ErrorClassified:
+		if e.Fatal {
+			return "error", fmt.Sprintf("无法继续执行[%s]: %s", e.Class, e.Err)
+		}
+		return "error", fmt.Sprintf("%s失败[%s]: %s", e.State.Title(), e.Class, e.Err)
+	case ScheduleWaiting:
+		action := "开始准备"
+		if e.Phase == PhaseStart {
+			action = "开抢"
+		}
+		return "info", fmt.Sprintf("等待%s: %s (服务器时间偏差 %v)", action, e.Until.In(dd.Shanghai).Format("2006-01-02 15:04:05"), e.Offset.Round(time.Millisecond))
+	case FloorFinished:
+		if e.Order != nil {
+			return "success", fmt.Sprintf("%s下单成功，订单号: %s", e.Floor, e.Order.OrderNo)
+		}
+		if e.Err == nil {
+			return "success", fmt.Sprintf("%s演练完成，未提交订单", e.Floor)
+		}
+		return "error", fmt.Sprintf("%s放弃下单: %s", e.Floor, e.Err)
+	case StockWatched:
+		message = fmt.Sprintf("关注%d件商品的库存:", len(e.Goods))
+		for _, g := range e.Goods {
+			message += "\n" + describeStock(g)
+		}
+		return "info", message
+	case BackInStock:
+		return "success", "商品到货: " + describeStock(e.Goods)
+	case OutOfStock:
+		return "warning", "商品售罄: " + describeStock(e.Goods)
+	case Notice:
+		return e.Level, e.Message
+	default:
+		return "info", ev.EventName()
+	}
+}
+
+// describeStock 商品的库存状态
+func describeStock(g StockStatus) string {
+	if g.Available == 0 {
+		return fmt.Sprintf("%s %s 无货 单价%s元", g.Floor, g.GoodsName, dd.FormatAmount(g.Price))
+	}
+	return fmt.Sprintf("%s %s 可购买%d件(库存%d) 单价%s元", g.Floor, g.GoodsName, g.Available, g.Stock, dd.FormatAmount(g.Price))
+}
+
+// describeTrims 列出被减少或移除的商品
+func describeTrims(trims []dd.GoodsTrim) string {
+	var b strings.Builder
+	for _, trim := range trims {
+		if trim.Quantity == 0 {
+			fmt.Fprintf(&b, "\n移除 %s 数量：%d", trim.Goods.GoodsName, trim.Goods.Quantity)
+		} else {
+			fmt.Fprintf(&b, "\n减少 %s 数量：%d → %d", trim.Goods.GoodsName, trim.Goods.Quantity, trim.Quantity)
+		}
+	}
+	return b.String()
+}
+
+// describeDryRun 列出演练模式构造的商品、优惠券、配送时段及提交参数
+func describeDryRun(e DryRunReady) string {
+	plan := e.Plan
+	var b strings.Builder
+	if e.Floor.FloorId != 0 {
+		b.WriteString(e.Floor.String())
+	}
+	b.WriteString("演练模式，未提交订单")
+	fmt.Fprintf(&b, "\n商品%d件:", len(plan.Goods))
+	for index, goods := range plan.Goods {
+		fmt.Fprintf(&b, "\n[%v] %s 数量：%v 单价：%d", index, goods.GoodsName, goods.Quantity, goods.Price)
+	}
+	if len(plan.Coupons) == 0 {
+		b.WriteString("\n优惠券: 无")
+	}
+	for _, coupon := range plan.Coupons {
+		fmt.Fprintf(&b, "\n优惠券: %s", coupon.PromotionId)
+	}
+	b.WriteString("\n配送时段:")
+	for _, v := range plan.Slots {
+		if v.Rank > 0 {
+			fmt.Fprintf(&b, "\n[%d] %s", v.Rank, v.ArrivalTimeStr)
+		} else {
+			fmt.Fprintf(&b, "\n[-] %s (%s)", v.ArrivalTimeStr, v.Excluded)
+		}
+	}
+	payload, err := json.MarshalIndent(plan.Payload, "", "  ")
+	if err != nil {
+		fmt.Fprintf(&b, "\n提交参数: %v", err)
+	} else {
+		fmt.Fprintf(&b, "\n提交参数:\n%s", payload)
+	}
+	return b.String()
+}
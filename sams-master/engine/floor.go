@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// FloorResult 多楼层下单时单个楼层的结果，Order为空时Err为放弃的原因；演练模式下Plan为该楼层构造的参数
+type FloorResult struct {
+	Floor dd.Floor
+	Order *dd.Order
+	Plan  *DryRunPlan
+	Err   error
+}
+
+// Results 多楼层下单时各楼层的结果，按Conf.Floors的顺序
+func (e *Engine) Results() []FloorResult {
+	results := make([]FloorResult, len(e.results))
+	copy(results, e.results)
+	return results
+}
+
+// runFloors 各楼层分别获取购物车、结算、配送时间并提交订单。
+// 每个楼层使用独立的会话副本(共享HTTP客户端、限流器、收货地址和门店列表)，轮流执行一个步骤；
+// 全部楼层下单成功或放弃(无法继续的错误、达到MaxFailures)后结束。
+// 返回第一个下单成功的订单，所有楼层都放弃时返回第一个楼层的错误；登录失效时立即返回
+func (e *Engine) runFloors(ctx context.Context, floors []dd.Floor) (*dd.Order, error) {
+	children := make([]*Engine, len(floors))
+	e.results = make([]FloorResult, len(floors))
+	for i, floor := range floors {
+		session := *e.Session
+		session.Conf.FloorId, session.Conf.DeliveryType = floor.FloorId, floor.DeliveryType
+		session.Conf.Floors = nil
+		e.resetFloor(&session)
+		children[i] = &Engine{Session: &session, Options: e.Options, parent: e, floor: floor}
+		e.results[i].Floor = floor
+	}
+	e.children = children
+
+	if err := e.start(ctx); err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		child.state, child.released = e.state, e.released
+	}
+
+	for {
+		active, advanced := 0, 0
+		for i, child := range children {
+			if child.state == StateDone || e.results[i].Err != nil {
+				continue
+			}
+			active++
+			// 准备完成的楼层等待其他楼层，全部准备完成后一起开抢
+			if child.gated() {
+				continue
+			}
+			advanced++
+			err := child.advance(ctx)
+			switch {
+			case ctx.Err() != nil:
+				return nil, ctx.Err()
+			case err != nil && dd.ClassOf(err) == dd.ClassAuthExpired:
+				return nil, err
+			case err != nil:
+				e.results[i].Err = err
+				e.publish(FloorFinished{Floor: child.floor, Err: err})
+			case child.state == StateDone:
+				e.results[i].Order = child.order
+				e.results[i].Plan = child.plan
+				if e.order == nil {
+					e.order = child.order
+				}
+				e.publish(FloorFinished{Floor: child.floor, Order: child.order})
+			}
+		}
+		if active == 0 {
+			break
+		}
+		if advanced == 0 {
+			if err := e.waitUntil(ctx, e.Options.StartAt, PhaseStart); err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				child.released = true
+			}
+		}
+	}
+
+	e.state = StateDone
+	if e.order == nil {
+		for _, result := range e.results {
+			if result.Plan != nil {
+				return nil, nil
+			}
+		}
+		return nil, fmt.Errorf("所有楼层均未下单: %w", e.results[0].Err)
+	}
+	return e.order, nil
+}
+
+// resetFloor 楼层会话改用主会话的收货地址和门店列表，并清空本楼层的商品和配送信息
+func (e *Engine) resetFloor(session *dd.DingdongSession) {
+	session.Address, session.Conf.AddressId = e.Session.Address, e.Session.Conf.AddressId
+	session.StoreList = e.Session.StoreList
+	session.FloorInfo = dd.FloorInfo{}
+	session.GoodsList = nil
+	session.SettleDeliveryInfo = map[int]dd.SettleDeliveryInfo{}
+	session.Slots = nil
+}
+
+// switchFloorsAddress 多楼层下单时切换备选地址。保存地址修改的是整个账号购物车的收货地址，
+// 因此由主引擎切换一次，所有未结束的楼层改用新的地址和门店列表，从保存地址重新开始
+func (e *Engine) switchFloorsAddress(reason error) error {
+	if err := e.switchAddress(reason); err != nil {
+		return err
+	}
+	for i, child := range e.children {
+		if child.state == StateDone || e.results[i].Err != nil {
+			continue
+		}
+		e.resetFloor(child.Session)
+		child.state = StateSaveAddress
+		child.attempt = 0
+	}
+	return nil
+}
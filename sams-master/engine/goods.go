@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// exclude 记录未加入本次下单的商品
+func (e *Engine) exclude(goods dd.ExcludedGoods) {
+	goods.Priority = e.Session.Conf.Priorities.Of(goods.SpuId)
+	e.Session.Excluded = append(e.Session.Excluded, goods)
+	e.publish(GoodsExcluded{Goods: goods})
+}
+
+// applyBudget 商品总价超过预算时按策略减少商品，并按调整后的商品更新订单金额
+func (e *Engine) applyBudget() error {
+	session := e.Session
+	budget := session.Conf.Budget
+	amount := dd.GoodsAmount(session.GoodsList)
+	goods, trims, err := budget.Apply(session.GoodsList)
+	if len(trims) > 0 {
+		e.publish(GoodsTrimmed{Trims: trims, Amount: amount, Trimmed: dd.GoodsAmount(goods), MaxAmount: budget.MaxAmount})
+	}
+	if err != nil {
+		return err
+	}
+	for _, trim := range trims {
+		if trim.Quantity == 0 {
+			e.exclude(trim.Goods.Exclude("超出金额上限"))
+		}
+	}
+	if len(trims) > 0 {
+		session.GoodsList = goods
+		session.FloorInfo.Amount = dd.FormatAmount(dd.GoodsAmount(goods))
+	}
+	return nil
+}
+
+// applyWeightLimit 商品总重量超过限重时提交订单前一次性减少商品，并按调整后的商品更新订单金额
+func (e *Engine) applyWeightLimit() error {
+	limit := e.Session.Conf.WeightLimit()
+	goods, trims, err := dd.ReduceWeight(e.Session.GoodsList, limit)
+	return e.reduceGoods(WeightReduced{Limit: limit}, goods, trims, err)
+}
+
+// reduceWeight 提交订单时服务器仍提示超重时按dd.ReduceWeightOnce减少一件商品后重新提交；
+// 没有可减少的商品时返回ErrOverWeight，停止下单
+func (e *Engine) reduceWeight() error {
+	goods, trims, err := dd.ReduceWeightOnce(e.Session.GoodsList)
+	return e.reduceGoods(WeightReduced{Limit: e.Session.Conf.WeightLimit(), Server: true}, goods, trims, err)
+}
+
+// reduceGoods 发布按重量减少商品的事件，成功时记录移除的商品，并按调整后的商品更新订单金额
+func (e *Engine) reduceGoods(ev WeightReduced, goods []dd.Goods, trims []dd.GoodsTrim, err error) error {
+	session := e.Session
+	if len(trims) > 0 {
+		ev.Trims, ev.Weight, ev.Reduced = trims, dd.GoodsWeight(session.GoodsList), dd.GoodsWeight(goods)
+		e.publish(ev)
+	}
+	if err != nil {
+		return err
+	}
+	for _, trim := range trims {
+		if trim.Quantity == 0 {
+			e.exclude(trim.Goods.Exclude("超出限重"))
+		}
+	}
+	if len(trims) > 0 {
+		session.GoodsList = goods
+		session.FloorInfo.Amount = dd.FormatAmount(dd.GoodsAmount(goods))
+	}
+	return nil
+}
+
+// missingMustHave 返回未加入本次下单的必需商品及原因
+func (e *Engine) missingMustHave() []string {
+	session := e.Session
+	included := map[string]bool{}
+	for _, goods := range session.GoodsList {
+		included[goods.SpuId] = true
+	}
+	reasons := map[string]string{}
+	for _, goods := range session.Excluded {
+		reasons[goods.SpuId] = fmt.Sprintf("%s(%s)", goods.GoodsName, goods.Reason)
+	}
+
+	missing := make([]string, 0)
+	for _, spuId := range session.Conf.Priorities.MustHave() {
+		if included[spuId] {
+			continue
+		}
+		if sub, ok := e.substitution(spuId); ok && included[sub.Substitute] {
+			continue
+		}
+		if e.planned[spuId] {
+			//演练模式下替代商品未加入购物车，按替换后可以下单处理
+			continue
+		}
+		if reason, ok := reasons[spuId]; ok {
+			missing = append(missing, reason)
+		} else {
+			missing = append(missing, fmt.Sprintf("%s(不在购物车中)", spuId))
+		}
+	}
+	return missing
+}
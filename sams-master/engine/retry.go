@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// SleepFunc 可取消的等待，默认为dd.Sleep
+type SleepFunc func(ctx context.Context, d time.Duration) error
+
+// RetryPolicy 决定某一步骤失败后等待多久再继续
+type RetryPolicy interface {
+	// Delay attempt为该步骤连续失败的次数，从1开始
+	Delay(state State, err error, attempt int) time.Duration
+}
+
+// RetryFunc 将函数转换为RetryPolicy
+type RetryFunc func(state State, err error, attempt int) time.Duration
+
+func (f RetryFunc) Delay(state State, err error, attempt int) time.Duration {
+	return f(state, err, attempt)
+}
+
+// FixedRetry 每次失败后等待固定时长
+type FixedRetry time.Duration
+
+func (d FixedRetry) Delay(state State, err error, attempt int) time.Duration {
+	return time.Duration(d)
+}
+
+// MaxUnknownDelay 未识别的接口错误连续失败时的最长等待
+const MaxUnknownDelay = 10 * time.Second
+
+// DefaultRetry 失败后等待1秒；被限流时立即继续，等待由会话的dd.Limiter按退避策略控制；
+// 下单超重和购物车为空时立即重试；未识别的接口错误每连续失败一次多等1秒，最多MaxUnknownDelay
+var DefaultRetry RetryPolicy = RetryFunc(func(state State, err error, attempt int) time.Duration {
+	switch {
+	case dd.IsLimited(err):
+		return 0
+	case dd.ClassOf(err) == dd.ClassUnknown:
+		if delay := time.Duration(attempt) * time.Second; delay < MaxUnknownDelay {
+			return delay
+		}
+		return MaxUnknownDelay
+	case state == StateOrder && errors.Is(err, dd.CloudGoodsOverWightErr):
+		return 0
+	case errors.Is(err, ErrNoGoods):
+		return 0
+	default:
+		return time.Second
+	}
+})
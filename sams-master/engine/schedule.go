@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// DefaultLeadTime 定时开抢时，准备步骤(地址、门店、购物车、结算)默认提前执行的时长
+const DefaultLeadTime = time.Minute
+
+// 最长单次等待，避免本地时间跳变后等待过久
+const maxScheduleSleep = time.Minute
+
+var startAtLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+var startAtClockLayouts = []string{
+	"15:04:05",
+	"15:04",
+}
+
+// ParseStartAt 解析开抢时间，支持 "2006-01-02 15:04:05"、"2006-01-02 15:04"、RFC3339，
+// 以及只有时间的 "15:04:05"、"15:04"，后者为now之后最近的该时刻。未指定时区时按上海时间
+func ParseStartAt(s string, now time.Time) (time.Time, error) {
+	for _, layout := range startAtLayouts {
+		if t, err := time.ParseInLocation(layout, s, dd.Shanghai); err == nil {
+			return t, nil
+		}
+	}
+	now = now.In(dd.Shanghai)
+	for _, layout := range startAtClockLayouts {
+		if t, err := time.ParseInLocation(layout, s, dd.Shanghai); err == nil {
+			at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, dd.Shanghai)
+			if !at.After(now) {
+				at = at.AddDate(0, 0, 1)
+			}
+			return at, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("开抢时间格式有误: %s，示例: 06:00 或 2022-04-20 06:00:00", s)
+}
+
+// serverNow 估算的服务器当前时间，尚未收到响应时为本地时间
+func (e *Engine) serverNow() time.Time {
+	if e.Session.Clock == nil {
+		return time.Now()
+	}
+	return e.Session.Clock.Now()
+}
+
+// waitUntil 按服务器时间等待到until
+func (e *Engine) waitUntil(ctx context.Context, until time.Time, phase string) error {
+	remaining := until.Sub(e.serverNow())
+	if remaining <= 0 {
+		return nil
+	}
+	var offset time.Duration
+	if e.Session.Clock != nil {
+		offset = e.Session.Clock.Offset()
+	}
+	e.publish(ScheduleWaiting{Phase: phase, Until: until, Offset: offset})
+	for remaining > 0 {
+		if remaining > maxScheduleSleep {
+			remaining = maxScheduleSleep
+		}
+		if err := e.Options.Sleep(ctx, remaining); err != nil {
+			return err
+		}
+		remaining = until.Sub(e.serverNow())
+	}
+	return nil
+}
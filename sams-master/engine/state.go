@@ -0,0 +1,55 @@
+package engine
+
+import "fmt"
+
+// State 下单流程的步骤
+type State int
+
+const (
+	StateSaveAddress State = iota //切换购物车收货地址
+	StateStores                   //获取地址附近可用商店
+	StateCart                     //获取购物车中有效商品
+	StateGoods                    //校验当前商品
+	StateSettle                   //获取结算信息
+	StateCapacity                 //获取可用配送时间
+	StateOrder                    //提交订单
+	StateDone                     //下单成功
+)
+
+var stateNames = map[State]string{
+	StateSaveAddress: "saving_address",
+	StateStores:      "checking_stores",
+	StateCart:        "checking_cart",
+	StateGoods:       "checking_goods",
+	StateSettle:      "checking_settle",
+	StateCapacity:    "checking_capacity",
+	StateOrder:       "submitting_order",
+	StateDone:        "order_success",
+}
+
+var stateTitles = map[State]string{
+	StateSaveAddress: "切换购物车收货地址",
+	StateStores:      "获取地址附近可用商店",
+	StateCart:        "获取购物车中有效商品",
+	StateGoods:       "开始校验当前商品",
+	StateSettle:      "获取结算信息",
+	StateCapacity:    "获取当前可用配送时间",
+	StateOrder:       "提交订单中",
+	StateDone:        "抢购成功",
+}
+
+// String 步骤名称，与Web界面的步骤一致
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Title 步骤中文描述
+func (s State) Title() string {
+	if title, ok := stateTitles[s]; ok {
+		return title
+	}
+	return s.String()
+}
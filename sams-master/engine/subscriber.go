@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// Printer 命令行输出
+func Printer(w io.Writer) Subscriber {
+	return SubscriberFunc(func(ev Event) {
+		if e, ok := ev.(StepEntered); ok {
+			fmt.Fprintf(w, "########## %s【%s】 ###########\n", e.Title(), time.Now().Format("15:04:05"))
+			return
+		}
+		_, message := Describe(ev)
+		fmt.Fprintln(w, message)
+	})
+}
+
+// BarkNotifier 下单成功、重复下单、切换备选地址或关注的商品到货时推送bark通知。
+// 下单相关的通知失败时每秒重试直到成功或ctx取消，其他通知只推送一次
+func BarkNotifier(ctx context.Context, session *dd.DingdongSession, onError func(err error)) Subscriber {
+	return SubscriberFunc(func(ev Event) {
+		var msg string
+		retry := true
+		switch e := ev.(type) {
+		case OrderPlaced:
+			msg = fmt.Sprintf("Smas抢单成功，订单号：%s", e.Order.OrderNo)
+			for _, sub := range e.Substitutions {
+				msg += fmt.Sprintf("，替换：%s", sub)
+			}
+		case DuplicateOrder:
+			msg = fmt.Sprintf("Smas重复下单，订单号：%s，请前往app取消", e.Order.OrderNo)
+		case BackInStock:
+			msg = fmt.Sprintf("Smas商品到货：%s %s 可购买%d件 单价%s元", e.Goods.Floor, e.Goods.GoodsName, e.Goods.Available, dd.FormatAmount(e.Goods.Price))
+			retry = false
+		case AddressSwitched:
+			msg = fmt.Sprintf("Smas切换收货地址：%s %s %s", e.To.Name, e.To.DistrictName, e.To.DetailAddress)
+			retry = false
+		}
+		if msg == "" || session.Conf.BarkId == "" {
+			return
+		}
+		for ctx.Err() == nil {
+			err := session.PushSuccess(ctx, msg)
+			if err == nil {
+				return
+			}
+			if onError != nil {
+				onError(err)
+			}
+			if !retry {
+				return
+			}
+			dd.Sleep(ctx, time.Second)
+		}
+	})
+}
+
+// Record 历史记录中的一条事件
+type Record struct {
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Event   Event     `json:"-"`
+}
+
+// Recorder 记录引擎发布的全部事件，可并发读取
+type Recorder struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (r *Recorder) Handle(ev Event) {
+	level, message := Describe(ev)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, Record{
+		Time:    time.Now(),
+		Name:    ev.EventName(),
+		Level:   level,
+		Message: message,
+		Event:   ev,
+	})
+}
+
+// Records 返回已记录事件的副本
+func (r *Recorder) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]Record, len(r.records))
+	copy(records, r.records)
+	return records
+}
+
+// Events 返回指定名称的事件，name为空时返回全部
+func (r *Recorder) Events(name string) []Event {
+	events := make([]Event, 0)
+	for _, record := range r.Records() {
+		if name == "" || record.Name == name {
+			events = append(events, record.Event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// replacement 一件缺货商品当前使用的替代商品
+type replacement struct {
+	dd.Substitution
+	active bool //替代商品在购物车中且有货
+}
+
+// available 商品有库存且未被商品校验判定为缺货
+func (e *Engine) available(goods dd.NormalGoods) bool {
+	return goods.AvailableQuantity() > 0 && !e.unavailable[goods.SpuId]
+}
+
+// substitute 为缺货且配置了替代规则的商品按顺序选择第一个有货的替代商品，购物车中的数量不足时加入差额，
+// 每个替代商品只加入一次；有商品加入购物车时返回true，需按重新获取的购物车再次检查。
+// 演练模式下不修改购物车，只发布DryRunSubstitute事件，原商品按缺货排除
+func (e *Engine) substitute(ctx context.Context) (bool, error) {
+	session := e.Session
+	rules := session.Conf.Substitutions
+	if len(rules) == 0 {
+		return false, nil
+	}
+	if e.replacements == nil {
+		e.replacements = map[string]*replacement{}
+		e.added = map[string]int{}
+		e.planned = map[string]bool{}
+	}
+
+	cart := map[string]dd.NormalGoods{}
+	goodsList := make([]dd.NormalGoods, 0)
+	for _, list := range [][]dd.NormalGoods{session.FloorInfo.NormalGoodsList, session.FloorInfo.ShortageStockGoodsList, session.FloorInfo.AllOutOfStockGoodsList} {
+		for _, goods := range list {
+			cart[goods.SpuId] = goods
+			goodsList = append(goodsList, goods)
+		}
+	}
+
+	added := false
+	for _, goods := range goodsList {
+		alternatives, ok := rules[goods.SpuId]
+		if !ok {
+			continue
+		}
+		delete(e.replacements, goods.SpuId)
+		if e.available(goods) {
+			continue
+		}
+		for _, alt := range alternatives {
+			g, inCart := cart[alt.SpuId]
+			if inCart && !e.available(g) {
+				continue
+			}
+			r := &replacement{Substitution: dd.Substitution{
+				SpuId:              goods.SpuId,
+				GoodsName:          goods.GoodsName,
+				Quantity:           goods.Quantity,
+				Substitute:         alt.SpuId,
+				SubstituteName:     g.GoodsName,
+				SubstituteQuantity: alt.Quantity(goods.Quantity),
+			}}
+			//购物车中已有足够的替代商品(如之前的流程加入的)时直接使用，不再加入
+			missing := r.SubstituteQuantity
+			if inCart {
+				missing -= g.Quantity
+			}
+			if _, ok := e.added[alt.SpuId]; ok || missing <= 0 {
+				if !inCart {
+					//加入购物车后仍未出现，视为不可用
+					continue
+				}
+				r.active = true
+			} else if e.Options.DryRun {
+				if !e.planned[goods.SpuId] {
+					e.planned[goods.SpuId] = true
+					e.publish(DryRunSubstitute{Substitution: r.Substitution, Quantity: missing})
+				}
+			} else {
+				_, err := session.AddCartGoods(ctx, dd.CartGoods{SpuId: alt.SpuId, StoreId: goods.StoreId, IncreaseQuantity: missing, IsSelected: true})
+				if err != nil {
+					return added, err
+				}
+				e.added[alt.SpuId] = missing
+				added = true
+			}
+			e.replacements[goods.SpuId] = r
+			break
+		}
+	}
+	return added, nil
+}
+
+// substitution 原商品已由有货的替代商品代替时返回该替换
+func (e *Engine) substitution(spuId string) (dd.Substitution, bool) {
+	if r, ok := e.replacements[spuId]; ok && r.active {
+		return r.Substitution, true
+	}
+	return dd.Substitution{}, false
+}
+
+// unusedQuantity 为替换加入购物车、但当前未用于替换的数量
+func (e *Engine) unusedQuantity(spuId string) int {
+	quantity, ok := e.added[spuId]
+	if !ok {
+		return 0
+	}
+	for _, r := range e.replacements {
+		if r.active && r.Substitute == spuId {
+			return 0
+		}
+	}
+	return quantity
+}
+
+// markUnavailable 记录商品校验判定为缺货的商品，配置了替代规则时下次获取购物车后替换，替换后清除
+func (e *Engine) markUnavailable(spuId string) {
+	if e.unavailable == nil {
+		e.unavailable = map[string]bool{}
+	}
+	e.unavailable[spuId] = true
+}
+
+// applySubstitutions 记录本次下单中的替换，替代商品的优先级不低于原商品
+func (e *Engine) applySubstitutions() {
+	session := e.Session
+	session.Substitutions = make([]dd.Substitution, 0)
+	for i, goods := range session.GoodsList {
+		for _, r := range e.replacements {
+			if !r.active || r.Substitute != goods.SpuId {
+				continue
+			}
+			if priority := session.Conf.Priorities.Of(r.SpuId); priority > goods.Priority {
+				session.GoodsList[i].Priority = priority
+			}
+			r.SubstituteName = goods.GoodsName
+			session.Substitutions = append(session.Substitutions, r.Substitution)
+			e.publish(GoodsSubstituted{Substitution: r.Substitution})
+		}
+	}
+}
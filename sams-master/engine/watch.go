@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// DefaultWatchInterval 关注库存时两次获取购物车的默认间隔
+const DefaultWatchInterval = 30 * time.Second
+
+// WatchOptions 关注库存的配置
+type WatchOptions struct {
+	Spus     []string      //关注的商品，为空时关注购物车中的全部商品；必需商品始终关注
+	Interval time.Duration //两次获取购物车的间隔，默认DefaultWatchInterval
+	Handoff  bool          //必需商品全部有货后返回，由调用方执行下单流程；没有必需商品时为关注的商品全部有货
+}
+
+// StockStatus 商品的库存状态，Available为可购买数量，0表示无货
+type StockStatus struct {
+	Floor     dd.Floor `json:"floor"`
+	SpuId     string   `json:"spuId"`
+	GoodsName string   `json:"goodsName"`
+	Available int      `json:"available"`
+	Stock     int      `json:"stock"`
+	Price     int      `json:"price"`
+}
+
+// stockKey 同一商品在不同楼层的库存各自比较
+type stockKey struct {
+	Floor dd.Floor
+	SpuId string
+}
+
+// Watch 按Interval获取购物车，比较关注商品的库存状态，有货或售罄时发布事件，不会下单。
+// 第一次获取购物车前先保存收货地址并获取门店，购物车中的库存与收货地址对应。
+// Handoff为false时一直执行到ctx取消；为true时在必需商品全部有货后返回nil。
+// 登录失效等无法继续的错误直接返回，其他错误在下次获取购物车时重试
+func (e *Engine) Watch(ctx context.Context, opts WatchOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	prepared := false
+	var last map[stockKey]StockStatus
+	for {
+		var stocks map[stockKey]StockStatus
+		var err error
+		if !prepared {
+			err = e.prepareWatch(ctx)
+			prepared = err == nil
+		}
+		if err == nil {
+			stocks, err = e.checkStock(ctx)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			class := dd.ClassOf(err)
+			fatal := class == dd.ClassAuthExpired || class == dd.ClassFatal
+			e.publish(ErrorClassified{State: StateCart, Err: err, Class: class, Next: StateCart, Fatal: fatal})
+			if fatal {
+				return err
+			}
+		} else {
+			watched := e.watched(opts.Spus, stocks)
+			if last == nil {
+				e.publishWatched(opts.Spus, watched, stocks)
+			} else {
+				for _, key := range watched {
+					now := stocks[key]
+					was, ok := last[key]
+					switch {
+					case !ok:
+						//新出现的楼层，按无货处理
+						if now.Available > 0 {
+							e.publish(BackInStock{Goods: now})
+						}
+					case was.Available == 0 && now.Available > 0:
+						e.publish(BackInStock{Goods: now})
+					case was.Available > 0 && now.Available == 0:
+						e.publish(OutOfStock{Goods: now})
+					}
+				}
+			}
+			last = stocks
+			if opts.Handoff && e.readyToOrder(opts.Spus, stocks) {
+				e.publish(Notice{Level: "success", Message: "关注的商品已有货，开始下单"})
+				return nil
+			}
+		}
+		if err := e.Options.Sleep(ctx, opts.Interval); err != nil {
+			return err
+		}
+	}
+}
+
+// prepareWatch 保存收货地址并获取门店，与下单流程的前两步相同
+func (e *Engine) prepareWatch(ctx context.Context) error {
+	if _, err := e.saveAddress(ctx); err != nil {
+		return err
+	}
+	_, err := e.checkStores(ctx)
+	return err
+}
+
+// checkStock 获取购物车中全部楼层商品的库存状态
+func (e *Engine) checkStock(ctx context.Context) (map[stockKey]StockStatus, error) {
+	session := e.Session
+	if err := session.CheckCart(ctx); err != nil {
+		return nil, err
+	}
+	stocks := map[stockKey]StockStatus{}
+	for _, floor := range session.Cart.FloorInfoList {
+		f := dd.Floor{FloorId: floor.FloorId, DeliveryType: floor.DeliveryType}
+		for _, list := range [][]dd.NormalGoods{floor.NormalGoodsList, floor.ShortageStockGoodsList, floor.AllOutOfStockGoodsList} {
+			for _, goods := range list {
+				stocks[stockKey{Floor: f, SpuId: goods.SpuId}] = StockStatus{
+					Floor:     f,
+					SpuId:     goods.SpuId,
+					GoodsName: goods.GoodsName,
+					Available: goods.AvailableQuantity(),
+					Stock:     goods.StockQuantity,
+					Price:     goods.Price,
+				}
+			}
+		}
+	}
+	return stocks, nil
+}
+
+// watchedSpus 关注的SPU，spus为空时为购物车中的全部商品，必需商品始终关注
+func (e *Engine) watchedSpus(spus []string, stocks map[stockKey]StockStatus) map[string]bool {
+	set := map[string]bool{}
+	for _, spuId := range spus {
+		set[spuId] = true
+	}
+	if len(spus) == 0 {
+		for key := range stocks {
+			set[key.SpuId] = true
+		}
+	}
+	for _, spuId := range e.Session.Conf.Priorities.MustHave() {
+		set[spuId] = true
+	}
+	return set
+}
+
+// watched 按SPU、楼层排序返回购物车中关注的商品，同一商品在多个楼层时分别关注
+func (e *Engine) watched(spus []string, stocks map[stockKey]StockStatus) []stockKey {
+	set := e.watchedSpus(spus, stocks)
+	watched := make([]stockKey, 0, len(set))
+	for key := range stocks {
+		if set[key.SpuId] {
+			watched = append(watched, key)
+		}
+	}
+	sort.Slice(watched, func(i, j int) bool {
+		a, b := watched[i], watched[j]
+		if a.SpuId != b.SpuId {
+			return a.SpuId < b.SpuId
+		}
+		if a.Floor.FloorId != b.Floor.FloorId {
+			return a.Floor.FloorId < b.Floor.FloorId
+		}
+		return a.Floor.DeliveryType < b.Floor.DeliveryType
+	})
+	return watched
+}
+
+// publishWatched 首次获取购物车后发布关注的商品及当前库存，不在购物车中的商品无法关注
+func (e *Engine) publishWatched(spus []string, watched []stockKey, stocks map[stockKey]StockStatus) {
+	goods := make([]StockStatus, 0, len(watched))
+	found := map[string]bool{}
+	for _, key := range watched {
+		goods = append(goods, stocks[key])
+		found[key.SpuId] = true
+	}
+	missing := make([]string, 0)
+	for spuId := range e.watchedSpus(spus, stocks) {
+		if !found[spuId] {
+			missing = append(missing, spuId)
+		}
+	}
+	sort.Strings(missing)
+	e.publish(StockWatched{Goods: goods})
+	if len(missing) > 0 {
+		e.publish(Notice{Level: "warning", Message: "以下商品不在购物车中，请先加入购物车: " + strings.Join(missing, "、")})
+	}
+}
+
+// readyToOrder 下单楼层中必需商品的可购买数量均不少于最少数量；没有必需商品时为关注的商品全部有货
+func (e *Engine) readyToOrder(spus []string, stocks map[stockKey]StockStatus) bool {
+	session := e.Session
+	required := session.Conf.Priorities.MustHave()
+	if len(required) == 0 {
+		for spuId := range e.watchedSpus(spus, stocks) {
+			required = append(required, spuId)
+		}
+	}
+	floors := session.Conf.Floors
+	if len(floors) == 0 {
+		floors = []dd.Floor{{FloorId: session.Conf.FloorId, DeliveryType: session.Conf.DeliveryType}}
+	}
+	ready := map[string]bool{}
+	for _, floor := range session.Cart.FloorInfoList {
+		f := dd.Floor{FloorId: floor.FloorId, DeliveryType: floor.DeliveryType}
+		if !containsFloor(floors, f) {
+			continue
+		}
+		for _, list := range [][]dd.NormalGoods{floor.NormalGoodsList, floor.ShortageStockGoodsList, floor.AllOutOfStockGoodsList} {
+			for _, goods := range list {
+				if available := goods.AvailableQuantity(); available > 0 && available >= session.Conf.MinQuantity(goods) {
+					ready[goods.SpuId] = true
+				}
+			}
+		}
+	}
+	for _, spuId := range required {
+		if !ready[spuId] {
+			return false
+		}
+	}
+	return len(required) > 0
+}
+
+// containsFloor floors中是否包含楼层f
+func containsFloor(floors []dd.Floor, f dd.Floor) bool {
+	for _, floor := range floors {
+		if floor == f {
+			return true
+		}
+	}
+	return false
+}
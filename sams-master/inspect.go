@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// 查看类命令，只读取接口数据，不会修改购物车或提交订单
+
+func addressesCommand(args []string) error {
+	_, c, err := parseConfig("addresses", args, nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if c.AuthToken == "" {
+		return errors.New("authToken不能为空")
+	}
+	conf, err := c.Config()
+	if err != nil {
+		return err
+	}
+	session := &dd.DingdongSession{
+		Conf:   conf,
+		Client: &http.Client{Timeout: 60 * time.Second},
+	}
+	err, addrList := session.GetAddress(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("########## 收货地址 ##########")
+	for i, addr := range addrList {
+		fmt.Printf("[%v] Id: %s %s %s %s %s %s \n", i, addr.AddressId, addr.Name, addr.DistrictName, addr.ReceiverAddress, addr.DetailAddress, addr.Mobile)
+	}
+	return nil
+}
+
+func storesCommand(args []string) error {
+	return inspect("stores", args, nil, func(ctx context.Context, session *dd.DingdongSession) error {
+		fmt.Println("########## 可用商店 ##########")
+		index := 0
+		for _, store := range session.StoreList {
+			fmt.Printf("[%v] Id：%s 名称：%s, 类型 ：%s, 配送模板：%s\n", index, store.StoreId, store.StoreName, store.StoreType, store.StoreDeliveryTemplateId)
+			index++
+		}
+		return nil
+	})
+}
+
+func cartCommand(args []string) error {
+	return inspect("cart", args, nil, func(ctx context.Context, session *dd.DingdongSession) error {
+		if err := session.CheckCart(ctx); err != nil {
+			return err
+		}
+		printCart(session)
+		return nil
+	})
+}
+
+// printCart 输出购物车中各楼层的商品
+func printCart(session *dd.DingdongSession) {
+	for _, floor := range session.Cart.FloorInfoList {
+		fmt.Printf("########## 楼层 %d 配送方式 %d 商店 %s 金额 %s ##########\n", floor.FloorId, floor.DeliveryType, floor.StoreId, floor.Amount)
+		for _, list := range [][]dd.NormalGoods{floor.NormalGoodsList, floor.ShortageStockGoodsList, floor.AllOutOfStockGoodsList} {
+			for _, goods := range list {
+				fmt.Printf("[%s] %s 数量：%v 可购买：%v 库存：%v 单价：%d 是否勾选： %v 优先级：%s 最少：%v\n", goods.SpuId, goods.GoodsName, goods.Quantity, goods.AvailableQuantity(), goods.StockQuantity, goods.Price, goods.IsSelected, session.Conf.Priorities.Of(goods.SpuId).Title(), session.Conf.MinQuantity(goods))
+			}
+		}
+	}
+}
+
+func slotsCommand(args []string) error {
+	return inspect("slots", args, nil, func(ctx context.Context, session *dd.DingdongSession) error {
+		if err := session.CheckCart(ctx); err != nil {
+			return err
+		}
+		storeId := ""
+		for _, floor := range session.Cart.FloorInfoList {
+			if floor.FloorId == session.Conf.FloorId && floor.DeliveryType == session.Conf.DeliveryType {
+				storeId = floor.StoreId
+			}
+		}
+		store, ok := session.StoreList[storeId]
+		if !ok {
+			return fmt.Errorf("购物车中没有楼层%d的商品", session.Conf.FloorId)
+		}
+
+		capacity, err := session.GetCapacity(ctx, store.StoreDeliveryTemplateId)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("########## 配送时间 %s ##########\n", store.StoreName)
+		for _, slot := range session.Conf.SlotPolicy.Rank(capacity.Slots(), session.Clock.Now()) {
+			if slot.Rank > 0 {
+				fmt.Printf("[%d] %s 可用\n", slot.Rank, slot.ArrivalTimeStr)
+			} else {
+				fmt.Printf("[-] %s %s\n", slot.ArrivalTimeStr, slot.Excluded)
+			}
+		}
+		return nil
+	})
+}
+
+// inspect 初始化会话并获取附近商店后执行fn，extra用于添加命令自己的参数
+func inspect(name string, args []string, extra func(fs *flag.FlagSet), fn func(ctx context.Context, session *dd.DingdongSession) error) error {
+	_, c, err := parseConfig(name, args, extra)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	session, err := newSession(ctx, c)
+	if err != nil {
+		return err
+	}
+	stores, err := session.CheckStore(ctx)
+	if err != nil {
+		return err
+	}
+	session.MergeStores(stores)
+	return fn(ctx, session)
+}
@@ -1,364 +1,237 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/tidwall/gjson"
-	"io"
 	"os"
+	"os/signal"
 	"strings"
-	"time"
+	"syscall"
 
 	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
 )
 
-var (
-	showHelp     = flag.Bool("help", false, "show help")
-	version      = flag.Bool("version", false, "查看版本号")
-	authToken    = flag.String("authToken", "", "必选, Sam's App HTTP头部auth-token")
-	barkId       = flag.String("barkId", "", "可选，通知用的`bark` id, 可选参数")
-	floorId      = flag.Int("floorId", 1, "可选，1,普通商品 2,全球购保税 3,特殊订购自提 4,大件商品 5,厂家直供商品 6,特殊订购商品 7,失效商品")
-	deliveryType = flag.Int("deliveryType", 2, "可选，1 急速达，2， 全程配送")
-	longitude    = flag.String("longitude", "", "可选，HTTP头部longitude")
-	latitude     = flag.String("latitude", "", "可选，HTTP头部latitude")
-	deviceId     = flag.String("deviceId", "", "可选，HTTP头部device-id")
-	trackInfo    = flag.String("trackInfo", "", "可选，HTTP头部track-info")
-	promotionId  = flag.String("promotionId", "", "可选，优惠券id,多个用逗号隔开，山姆app优惠券列表接口中的'ruleId'字段")
-	addressId    = flag.String("addressId", "", "可选，地址id")
-	payMethod    = flag.Int("payMethod", 1, "可选，1,微信 2,支付宝")
-	deliveryFee  = flag.Bool("deliveryFee", false, "可选，是否免运费下单")
-	storeConf    = flag.String("storeConf", "", "可选，加载商店信息文件名")
-	isSelected   = flag.Bool("isSelected", false, "可选，是否只选择勾选商品")
-)
+const versionText = "Rob Sam's 1.7.0 GNU General Public License v3.0"
 
-func main() {
-	flag.Parse()
-	if *version {
-		fmt.Println("Rob Sam's 1.7.0 GNU General Public License v3.0")
-		return
-	}
+type command struct {
+	Name  string
+	Usage string
+	Run   func(args []string) error
+}
 
-	if *showHelp {
-		flag.Usage()
-		return
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "执行抢购流程（默认）", runCommand},
+		{"server", "启动Web服务器，用法: server [port] [参数]", serverCommand},
+		{"addresses", "查看收货地址列表", addressesCommand},
+		{"stores", "查看收货地址附近可用商店", storesCommand},
+		{"cart", "查看购物车中的商品及可购买数量", cartCommand},
+		{"cart-add", "将商品加入购物车，用法: cart-add -spu=spuId [-quantity=1]", cartAddCommand},
+		{"cart-update", "修改购物车中商品的数量，用法: cart-update -spu=spuId -quantity=2", cartUpdateCommand},
+		{"cart-select", "勾选购物车中的商品，用法: cart-select -spu=spu1,spu2 [-selected=false]", cartSelectCommand},
+		{"cart-remove", "从购物车中移除商品，用法: cart-remove -spu=spu1,spu2", cartRemoveCommand},
+		{"slots", "查看当前可用配送时间", slotsCommand},
+		{"watch-stock", "关注购物车中商品的库存，到货时通知，用法: watch-stock [-watch=spu1,spu2] [-handoff]", watchStockCommand},
+		{"version", "查看版本号", func(args []string) error {
+			fmt.Println(versionText)
+			return nil
+		}},
 	}
+}
 
-	if *authToken == "" {
-		flag.Usage()
-		return
+func usage() {
+	fmt.Println("用法: robSams [命令] [参数]")
+	fmt.Println()
+	fmt.Println("命令:")
+	for _, c := range commands {
+		fmt.Printf("  %-13s %s\n", c.Name, c.Usage)
 	}
+	fmt.Println()
+	fmt.Println("不指定命令时执行 run，各命令参数见 robSams <命令> -help")
+}
 
-	splitFn := func(c rune) bool {
-		return c == ','
+func main() {
+	if code := dispatch(os.Args[1:]); code != 0 {
+		os.Exit(code)
 	}
+}
 
-	session := dd.DingdongSession{
-		SettleDeliveryInfo: map[int]dd.SettleDeliveryInfo{},
-		StoreList:          map[string]dd.Store{},
+// dispatch 按第一个参数选择子命令执行，第一个参数为参数(以-开头)或未指定时执行run，返回进程退出码
+func dispatch(args []string) int {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	conf := dd.Config{
-		AuthToken:    *authToken,                                //HTTP头部auth-token
-		BarkId:       *barkId,                                   //通知用的bark id，下载bark后从app界面获取, 如果不需要可以填空字符串
-		FloorId:      *floorId,                                  //1,普通商品 2,全球购保税 3,特殊订购自提 4,大件商品 5,厂家直供商品 6,特殊订购商品 7,失效商品
-		DeliveryType: *deliveryType,                             //1 急速达，2， 全程配送
-		Longitude:    *longitude,                                //HTTP头部longitude,可选参数
-		Latitude:     *latitude,                                 //HTTP头部latitude,可选参数
-		Deviceid:     *deviceId,                                 //HTTP头部device-id,可选参数
-		Trackinfo:    *trackInfo,                                //HTTP头部track-info,可选参数
-		PromotionId:  strings.FieldsFunc(*promotionId, splitFn), //优惠券id
-		AddressId:    *addressId,                                //地址
-		PayMethod:    *payMethod,                                //支付方式
-		DeliveryFee:  *deliveryFee,
-		StoreConf:    *storeConf,
-		IsSelected:   *isSelected,
-	}
-
-	err := session.InitSession(conf)
-
-	if err != nil {
-		fmt.Println(err)
-		return
+	if name == "help" {
+		usage()
+		return 0
 	}
 
-	for true {
-	SaveDeliveryAddress:
-		fmt.Println("########## 切换购物车收货地址 ###########")
-		err = session.SaveDeliveryAddress()
-		if err != nil {
-			goto SaveDeliveryAddress
-		} else {
-			fmt.Println("切换成功!")
-			fmt.Printf("%s %s %s %s %s \n", session.Address.Name, session.Address.DistrictName, session.Address.ReceiverAddress, session.Address.DetailAddress, session.Address.Mobile)
+	for _, c := range commands {
+		if c.Name != name {
+			continue
 		}
-
-		if session.Conf.StoreConf != "" {
-			if _, err := os.Stat(session.Conf.StoreConf); err == nil {
-				if file, err := os.Open(session.Conf.StoreConf); err == nil {
-					fmt.Println("########## 预加载商店配置 ###########")
-					var bytes []byte
-					buf := make([]byte, 10)
-					for {
-						n, err := file.Read(buf)
-						if err != nil && err != io.EOF {
-							fmt.Println("read buf fail", err)
-							return
-						}
-						//说明读取结束
-						if n == 0 {
-							break
-						}
-						bytes = append(bytes, buf[:n]...)
-					}
-
-					for index, store := range session.GetStoreList(gjson.ParseBytes(bytes)) {
-						if _, ok := session.StoreList[store.StoreId]; !ok {
-							session.StoreList[store.StoreId] = store
-							fmt.Printf("[%v] Id：%s 名称：%s, 类型 ：%s\n", index, store.StoreId, store.StoreName, store.StoreType)
-						}
-					}
-				} else {
-					fmt.Println(err)
-				}
-			} else {
-				fmt.Println(err)
-			}
+		err := c.Run(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
 		}
-	StoreLoop:
-		fmt.Println("########## 获取地址附近可用商店 ###########")
-		stores, err := session.CheckStore()
 		if err != nil {
-			fmt.Printf("%s", err)
-			goto StoreLoop
+			fmt.Println(err)
+			return 1
 		}
+		return 0
+	}
+	fmt.Printf("未知命令: %s\n\n", name)
+	usage()
+	return 2
+}
 
-		for index, store := range stores {
-			if oStore, ok := session.StoreList[store.StoreId]; !ok || oStore.StoreDeliveryTemplateId != store.StoreDeliveryTemplateId || oStore.AreaBlockId != store.AreaBlockId {
-				session.StoreList[store.StoreId] = store
-				fmt.Printf("[%v] Id：%s 名称：%s, 类型 ：%s\n", index, store.StoreId, store.StoreName, store.StoreType)
-			}
+// signalContext 收到退出信号时取消
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			fmt.Println("########## 收到退出信号，停止执行 ##########")
+			cancel()
+		case <-ctx.Done():
 		}
-	CartLoop:
-		fmt.Printf("########## 获取购物车中有效商品【%s】 ###########\n", time.Now().Format("15:04:05"))
-		err = session.CheckCart()
-		for _, v := range session.Cart.FloorInfoList {
-			if v.FloorId == session.Conf.FloorId && v.DeliveryType == session.Conf.DeliveryType {
-				session.GoodsList = make([]dd.Goods, 0)
-				for _, goods := range v.NormalGoodsList {
-					if goods.StockQuantity > 0 && goods.StockStatus && goods.IsPutOnSale && goods.IsAvailable {
-						if goods.StockQuantity <= goods.Quantity {
-							goods.Quantity = goods.StockQuantity
-						}
-						if goods.LimitNum > 0 && goods.Quantity > goods.LimitNum {
-							goods.Quantity = goods.LimitNum
-						}
-
-						if goods.LimitNum > 0 && goods.Quantity > goods.ResiduePurchaseNum {
-							goods.Quantity = goods.ResiduePurchaseNum
-						}
-
-						if goods.Quantity > 0 {
-							session.GoodsList = append(session.GoodsList, goods.ToGoods())
-						}
-					}
-				}
-
-				for _, goods := range v.ShortageStockGoodsList {
-					if goods.StockQuantity > 0 && goods.StockStatus && goods.IsPutOnSale && goods.IsAvailable {
-						if goods.StockQuantity <= goods.Quantity {
-							goods.Quantity = goods.StockQuantity
-						}
-						if goods.LimitNum > 0 && goods.Quantity > goods.LimitNum {
-							goods.Quantity = goods.LimitNum
-						}
-						if goods.LimitNum > 0 && goods.Quantity > goods.ResiduePurchaseNum {
-							goods.Quantity = goods.ResiduePurchaseNum
-						}
-
-						if goods.Quantity > 0 {
-							session.GoodsList = append(session.GoodsList, goods.ToGoods())
-						}
-					}
-				}
-
-				for _, goods := range v.AllOutOfStockGoodsList {
-					if goods.StockQuantity > 0 && goods.StockStatus && goods.IsPutOnSale && goods.IsAvailable {
-						if goods.StockQuantity <= goods.Quantity {
-							goods.Quantity = goods.StockQuantity
-						}
-
-						if goods.LimitNum > 0 && goods.Quantity > goods.LimitNum {
-							goods.Quantity = goods.LimitNum
-						}
+		signal.Stop(sig)
+	}()
+	return ctx, cancel
+}
 
-						if goods.LimitNum > 0 && goods.Quantity > goods.ResiduePurchaseNum {
-							goods.Quantity = goods.ResiduePurchaseNum
-						}
+// newSession 按配置初始化会话
+func newSession(ctx context.Context, c *ConfigRequest) (*dd.DingdongSession, error) {
+	if c.AuthToken == "" {
+		return nil, errors.New("authToken不能为空")
+	}
+	session := &dd.DingdongSession{
+		SettleDeliveryInfo: map[int]dd.SettleDeliveryInfo{},
+		StoreList:          map[string]dd.Store{},
+	}
+	conf, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.InitSession(ctx, conf); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
 
-						if goods.Quantity > 0 {
-							session.GoodsList = append(session.GoodsList, goods.ToGoods())
-						}
-					}
-				}
+func runCommand(args []string) error {
+	var version bool
+	fs, c, err := parseConfig("run", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&version, "version", false, "查看版本号")
+	})
+	if err != nil {
+		return err
+	}
+	if version {
+		fmt.Println(versionText)
+		return nil
+	}
+	if c.AuthToken == "" {
+		fs.Usage()
+		return nil
+	}
 
-				session.FloorInfo = v
-			} else {
-				//无效商品
-				//for index, goods := range v.NormalGoodsList {
-				//	fmt.Printf("----[%v] %s 数量：%v 总价：%d\n", index, goods.SpuId, goods.StoreId, goods.Price)
-				//}
-			}
-		}
+	ctx, cancel := signalContext()
+	defer cancel()
 
-		var selGoods = make([]dd.Goods, 0)
-		for index, goods := range session.GoodsList {
-			fmt.Printf("[%v] %s 数量：%v 总价：%d * %d, 是否勾选： %v \n", index, goods.GoodsName, goods.Quantity, goods.Price, goods.Quantity, goods.IsSelected)
-			if goods.IsSelected && session.Conf.IsSelected {
-				selGoods = append(selGoods, goods)
-			}
-		}
+	session, err := newSession(ctx, c)
+	if err != nil {
+		return err
+	}
 
-		if session.Conf.IsSelected {
-			session.GoodsList = selGoods
-		}
+	e, err := newEngine(ctx, c, session)
+	if err != nil {
+		return err
+	}
+	_, err = e.Run(ctx)
+	printStats(session)
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
 
-		if len(session.GoodsList) == 0 {
-			if err != nil {
+// newEngine 按配置创建下单引擎，输出日志并推送bark通知
+func newEngine(ctx context.Context, c *ConfigRequest, session *dd.DingdongSession) (*engine.Engine, error) {
+	startAt, leadTime, err := c.Schedule(session.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	stagger, err := c.CommitStagger()
+	if err != nil {
+		return nil, err
+	}
+	return engine.New(session, engine.Options{
+		StartAt:     startAt,
+		LeadTime:    leadTime,
+		Concurrency: c.Concurrency,
+		Stagger:     stagger,
+		MaxFailures: c.MaxFailures,
+		DryRun:      c.DryRun,
+		Subscribers: []engine.Subscriber{
+			engine.Printer(os.Stdout),
+			engine.BarkNotifier(ctx, session, func(err error) {
 				fmt.Println(err)
-			} else {
-				fmt.Println("当前购物车中无有效商品")
-			}
-			if errors.Is(err, dd.LimitedErr1) {
-				time.Sleep(1 * time.Second)
-			}
-			goto StoreLoop
-		}
-	GoodsLoop:
-		fmt.Printf("########## 开始校验当前商品【%s】 ###########\n", time.Now().Format("15:04:05"))
-		if _, err := session.CheckGoods(); err != nil {
-			fmt.Println(err)
-			time.Sleep(1 * time.Second)
-			switch err {
-			case dd.OOSErr:
-				goto CartLoop
-			default:
-				goto CartLoop
-			}
-		}
-		if settleInfo, err := session.CheckSettleInfo(); err == nil {
-			fmt.Printf("运费： %s\n", settleInfo.DeliveryFee)
-			if store, ok := session.StoreList[session.FloorInfo.StoreId]; ok && store.StoreDeliveryTemplateId != settleInfo.SettleDelivery.StoreDeliveryTemplateId {
-				store.StoreDeliveryTemplateId = settleInfo.SettleDelivery.StoreDeliveryTemplateId
-				store.AreaBlockId = settleInfo.SettleDelivery.AreaBlockId
-				session.StoreList[session.FloorInfo.StoreId] = store
-			}
+			}),
+		},
+	}), nil
+}
 
-			if session.Conf.DeliveryFee && settleInfo.DeliveryFee != "0" {
-				goto CartLoop
-			}
-		} else {
-			fmt.Printf("校验商品失败：%s\n", err)
-			time.Sleep(1 * time.Second)
-			switch err {
-			case dd.CartGoodChangeErr:
-				goto CartLoop
-			case dd.LimitedErr:
-				goto GoodsLoop
-			case dd.NoMatchDeliverMode:
-				goto SaveDeliveryAddress
-			default:
-				goto GoodsLoop
-			}
-		}
-	CapacityLoop:
-		fmt.Printf("########## 获取当前可用配送时间【%s】 ###########\n", time.Now().Format("15:04:05"))
-		capacity, err := session.GetCapacity(session.StoreList[session.FloorInfo.StoreId].StoreDeliveryTemplateId)
-		if err != nil {
-			fmt.Println(err)
-			switch err {
-			case dd.CapacityErr:
-				goto StoreLoop
-			default:
-				time.Sleep(1 * time.Second)
-				//刷新可用配送时间， 会出现“服务器正忙,请稍后再试”， 可以忽略。
-				goto CapacityLoop
-			}
-		}
+func watchStockCommand(args []string) error {
+	var spus string
+	var handoff bool
+	interval := engine.DefaultWatchInterval
+	_, c, err := parseConfig("watch-stock", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&spus, "watch", "", "可选，关注的商品spuId，多个用逗号分隔，默认关注购物车中的全部商品；必需商品始终关注")
+		fs.DurationVar(&interval, "watchInterval", interval, "可选，两次获取购物车的间隔")
+		fs.BoolVar(&handoff, "handoff", false, "可选，必需商品全部有货后(没有必需商品时为关注的商品全部有货)开始下单，默认只通知不下单")
+	})
+	if err != nil {
+		return err
+	}
 
-		session.SettleDeliveryInfo = map[int]dd.SettleDeliveryInfo{}
-		for _, caps := range capacity.CapCityResponseList {
-			for _, v := range caps.List {
-				if v.TimeISFull == false && v.Disabled == false {
-					session.SettleDeliveryInfo[len(session.SettleDeliveryInfo)] = dd.SettleDeliveryInfo{
-						ArrivalTimeStr:       fmt.Sprintf("%s %s - %s", caps.StrDate, v.StartTime, v.EndTime),
-						ExpectArrivalTime:    v.StartRealTime,
-						ExpectArrivalEndTime: v.EndRealTime,
-					}
-				}
-			}
-		}
+	ctx, cancel := signalContext()
+	defer cancel()
 
-		if len(session.SettleDeliveryInfo) > 0 {
-			for _, v := range session.SettleDeliveryInfo {
-				fmt.Printf("发现可用的配送时段::%s!\n", v.ArrivalTimeStr)
-			}
-		} else {
-			fmt.Println("当前无可用配送时间段")
-			time.Sleep(1 * time.Second)
-			goto CapacityLoop
-		}
-	OrderLoop:
-		for len(session.SettleDeliveryInfo) > 0 {
-			for k, v := range session.SettleDeliveryInfo {
-				fmt.Printf("########## 提交订单中【%s】 ###########\n", time.Now().Format("15:04:05"))
-				fmt.Printf("配送时段: %s!\n", v.ArrivalTimeStr)
-				if order, err := session.CommitPay(v); err == nil {
-					fmt.Println("抢购成功，请前往app付款！")
-					if session.Conf.BarkId != "" {
-						for true {
-							err = session.PushSuccess(fmt.Sprintf("Smas抢单成功，订单号：%s", order.OrderNo))
-							if err == nil {
-								break
-							} else {
-								fmt.Println(err)
-							}
-							time.Sleep(1 * time.Second)
-						}
-					}
-					return
-				} else {
-					fmt.Printf("下单失败：%s\n", err)
-					switch err {
-					case dd.LimitedErr1:
-						fmt.Println("立即重试...")
-						goto OrderLoop
-					case dd.CloudGoodsOverWightErr:
-						maxKey := len(session.GoodsList) - 1
-						for key, v := range session.GoodsList {
-							if v.Quantity > 1 && v.Weight > session.GoodsList[maxKey].Weight {
-								maxKey = key
-							}
-						}
-						if maxKey >= 0 {
-							if session.GoodsList[maxKey].Quantity > 1 {
-								session.GoodsList[maxKey].Quantity -= 1
-							} else {
-								session.GoodsList = append(session.GoodsList[:maxKey], session.GoodsList[maxKey+1:]...)
-							}
-						}
-						goto OrderLoop
-					case dd.OOSErr, dd.PreGoodNotStartSellErr, dd.CartGoodChangeErr, dd.GoodsExceedLimitErr:
-						goto CartLoop
-					case dd.StoreHasClosedError, dd.GetDeliveryInfoErr:
-						goto StoreLoop
-					case dd.CloseOrderTimeExceptionErr, dd.DecreaseCapacityCountError, dd.NotDeliverCapCityErr:
-						delete(session.SettleDeliveryInfo, k)
-					default:
-						goto CapacityLoop
-					}
-				}
-			}
-		}
-		goto CapacityLoop
+	session, err := newSession(ctx, c)
+	if err != nil {
+		return err
+	}
+	e, err := newEngine(ctx, c, session)
+	if err != nil {
+		return err
+	}
+	err = e.Watch(ctx, engine.WatchOptions{Spus: splitSpuIds(spus), Interval: interval, Handoff: handoff})
+	if err == nil && handoff {
+		_, err = e.Run(ctx)
+	}
+	printStats(session)
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// printStats 输出各接口的请求及限流统计
+func printStats(session *dd.DingdongSession) {
+	if session.Limiter == nil {
+		return
+	}
+	fmt.Println("########## 请求统计 ##########")
+	for _, line := range dd.FormatStats(session.Limiter.Stats()) {
+		fmt.Println(line)
 	}
 }
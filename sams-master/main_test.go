@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+)
+
+// TestDispatch 测试子命令分发
+// 验证第一个参数为参数时默认执行run、未知命令的退出码以及子命令返回错误时的处理
+func TestDispatch(t *testing.T) {
+	var called string
+	var received []string
+	fake := func(name string, err error) command {
+		return command{Name: name, Run: func(args []string) error {
+			called, received = name, args
+			return err
+		}}
+	}
+	saved := commands
+	commands = []command{
+		fake("run", nil),
+		fake("server", nil),
+		fake("fail", errors.New("执行失败")),
+		fake("usage", flag.ErrHelp),
+	}
+	defer func() { commands = saved }()
+
+	tests := []struct {
+		name   string
+		args   []string
+		called string
+		rest   []string
+		code   int
+	}{
+		{"不指定命令", nil, "run", nil, 0},
+		{"第一个参数为参数", []string{"-authToken=x", "-floorId=2"}, "run", []string{"-authToken=x", "-floorId=2"}, 0},
+		{"指定命令", []string{"server", "8080"}, "server", []string{"8080"}, 0},
+		{"命令返回错误", []string{"fail"}, "fail", []string{}, 1},
+		{"查看命令帮助", []string{"usage", "-help"}, "usage", []string{"-help"}, 0},
+		{"查看用法", []string{"help"}, "", nil, 0},
+		{"未知命令", []string{"unknown", "-authToken=x"}, "", nil, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called, received = "", nil
+			if code := dispatch(tt.args); code != tt.code {
+				t.Errorf("退出码应为%d，实际为%d", tt.code, code)
+			}
+			if called != tt.called {
+				t.Fatalf("应执行%q，实际为%q", tt.called, called)
+			}
+			if len(received) != len(tt.rest) {
+				t.Fatalf("传给子命令的参数有误: %v", received)
+			}
+			for i := range tt.rest {
+				if received[i] != tt.rest[i] {
+					t.Errorf("传给子命令的参数有误: %v", received)
+				}
+			}
+		})
+	}
+
+	t.Log("✅ 子命令分发测试通过")
+}
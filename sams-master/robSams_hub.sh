@@ -1,4 +1,7 @@
 #sh
-if [ $(pgrep robSams|wc -l) -eq 0 ]; then
-  /root/go/src/robFoodDD/robSams > /var/log/robSams.log &
-fi
\ No newline at end of file
+# 抢购进程不存在时在后台启动，脚本参数原样传给 run 子命令。
+# SAMS_BIN 为编译出的程序路径，默认与之前相同为 robSams（go build -o robSams），改用其他名称时设置该变量
+SAMS_BIN=${SAMS_BIN:-/root/go/src/robFoodDD/robSams}
+if [ $(pgrep -x $(basename "$SAMS_BIN")|wc -l) -eq 0 ]; then
+  "$SAMS_BIN" run "$@" > /var/log/robSams.log &
+fi
@@ -0,0 +1,190 @@
+package samsmock
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/tidwall/gjson"
+)
+
+// cartGoods 模拟购物车中的一件商品，Info为商品数据(不含quantity、isSelected)
+type cartGoods struct {
+	Info       map[string]interface{}
+	Quantity   int
+	IsSelected bool
+}
+
+// available 商品是否有货，与dd.NormalGoods.AvailableQuantity的判断一致
+func (g *cartGoods) available() bool {
+	stock, _ := g.Info["stockQuantity"].(float64)
+	return stock > 0 && g.Info["stockStatus"] == true && g.Info["isPutOnSale"] == true && g.Info["isAvailable"] == true
+}
+
+type cartFloor struct {
+	FloorId      int
+	DeliveryType int
+	StoreId      string
+	Goods        []*cartGoods
+}
+
+// mockCart 模拟购物车，以默认购物车数据初始化，加购、修改数量、勾选和移除商品后getUserCart返回最新数据；
+// 商品按库存放入normalGoodsList、shortageStockGoodsList或allOutOfStockGoodsList
+type mockCart struct {
+	floors  []*cartFloor
+	catalog map[string]map[string]interface{} //可加购的商品，包括购物车中的商品和catalogData
+}
+
+func newMockCart() *mockCart {
+	c := &mockCart{catalog: map[string]map[string]interface{}{}}
+	for _, f := range gjson.Get(defaultData[dd.EndpointUserCart], "floorInfoList").Array() {
+		floor := &cartFloor{
+			FloorId:      int(f.Get("floorId").Int()),
+			DeliveryType: int(f.Get("deliveryType").Int()),
+			StoreId:      f.Get("storeId").Str,
+		}
+		for _, list := range []string{"normalGoodsList", "shortageStockGoodsList", "allOutOfStockGoodsList"} {
+			for _, g := range f.Get(list).Array() {
+				info := goodsInfo(g.Raw)
+				c.catalog[g.Get("spuId").Str] = info
+				floor.Goods = append(floor.Goods, &cartGoods{Info: info, Quantity: int(g.Get("quantity").Int()), IsSelected: g.Get("isSelected").Bool()})
+			}
+		}
+		c.floors = append(c.floors, floor)
+	}
+	for _, g := range gjson.Parse(catalogData).Array() {
+		c.catalog[g.Get("spuId").Str] = goodsInfo(g.Raw)
+	}
+	return c
+}
+
+// goodsInfo 解析商品数据，去掉由购物车维护的quantity、isSelected
+func goodsInfo(raw string) map[string]interface{} {
+	info := map[string]interface{}{}
+	json.Unmarshal([]byte(raw), &info)
+	delete(info, "quantity")
+	delete(info, "isSelected")
+	return info
+}
+
+// find 返回购物车中的商品
+func (c *mockCart) find(spuId string) *cartGoods {
+	for _, floor := range c.floors {
+		for _, g := range floor.Goods {
+			if g.Info["spuId"] == spuId {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// add 处理加购请求，已在购物车中的商品增加数量，其他商品从catalog加入配送方式对应的楼层
+func (c *mockCart) add(body []byte) (code, msg string) {
+	deliveryType := int(gjson.GetBytes(body, "deliveryType").Int())
+	for _, v := range gjson.GetBytes(body, "cartGoodsInfoList").Array() {
+		spuId, quantity := v.Get("spuId").Str, int(v.Get("increaseQuantity").Int())
+		if quantity <= 0 {
+			return "PARAM_ERROR", "加购数量有误"
+		}
+		if g := c.find(spuId); g != nil {
+			g.Quantity += quantity
+			g.IsSelected = v.Get("isSelected").Bool()
+			continue
+		}
+		info, ok := c.catalog[spuId]
+		if !ok {
+			return "GOODS_NOT_EXIST", fmt.Sprintf("商品不存在: %s", spuId)
+		}
+		floor := c.floors[0]
+		for _, f := range c.floors {
+			if f.DeliveryType == deliveryType {
+				floor = f
+				break
+			}
+		}
+		floor.Goods = append(floor.Goods, &cartGoods{Info: info, Quantity: quantity, IsSelected: v.Get("isSelected").Bool()})
+	}
+	return "Success", ""
+}
+
+// modify 处理修改数量、勾选和移除商品的请求，商品需已在购物车中
+func (c *mockCart) modify(endpoint string, body []byte) (code, msg string) {
+	for _, v := range gjson.GetBytes(body, "cartGoodsInfoList").Array() {
+		spuId := v.Get("spuId").Str
+		if c.find(spuId) == nil {
+			return "GOODS_NOT_IN_CART", fmt.Sprintf("商品不在购物车中: %s", spuId)
+		}
+		switch endpoint {
+		case dd.EndpointUpdateCartGoods:
+			quantity := int(v.Get("quantity").Int())
+			if quantity <= 0 {
+				return "PARAM_ERROR", "商品数量有误"
+			}
+			c.find(spuId).Quantity = quantity
+		case dd.EndpointSelectCartGoods:
+			c.find(spuId).IsSelected = v.Get("isSelected").Bool()
+		case dd.EndpointDeleteCartGoods:
+			for _, floor := range c.floors {
+				for i, g := range floor.Goods {
+					if g.Info["spuId"] == spuId {
+						floor.Goods = append(floor.Goods[:i], floor.Goods[i+1:]...)
+						break
+					}
+				}
+			}
+		}
+	}
+	return "Success", ""
+}
+
+// data 当前购物车的getUserCart数据
+func (c *mockCart) data() string {
+	floors := make([]map[string]interface{}, 0, len(c.floors))
+	for _, floor := range c.floors {
+		lists := map[string][]map[string]interface{}{
+			"normalGoodsList":        {},
+			"shortageStockGoodsList": {},
+			"allOutOfStockGoodsList": {},
+		}
+		amount, quantity := 0, 0
+		for _, g := range floor.Goods {
+			goods := map[string]interface{}{"quantity": g.Quantity, "isSelected": g.IsSelected}
+			for k, v := range g.Info {
+				goods[k] = v
+			}
+			stock, _ := g.Info["stockQuantity"].(float64)
+			price, _ := g.Info["price"].(float64)
+			switch {
+			case !g.available():
+				lists["allOutOfStockGoodsList"] = append(lists["allOutOfStockGoodsList"], goods)
+				continue
+			case g.Quantity > int(stock):
+				lists["shortageStockGoodsList"] = append(lists["shortageStockGoodsList"], goods)
+			default:
+				lists["normalGoodsList"] = append(lists["normalGoodsList"], goods)
+			}
+			if g.IsSelected {
+				n := g.Quantity
+				if n > int(stock) {
+					n = int(stock)
+				}
+				amount += int(price) * n
+				quantity += n
+			}
+		}
+		f := map[string]interface{}{
+			"floorId":      floor.FloorId,
+			"deliveryType": floor.DeliveryType,
+			"storeId":      floor.StoreId,
+			"amount":       fmt.Sprintf("%d.%02d", amount/100, amount%100),
+			"quantity":     quantity,
+		}
+		for k, v := range lists {
+			f[k] = v
+		}
+		floors = append(floors, f)
+	}
+	b, _ := json.Marshal(map[string]interface{}{"floorInfoList": floors})
+	return string(b)
+}
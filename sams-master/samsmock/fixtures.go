@@ -0,0 +1,235 @@
+package samsmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// 默认数据与CLI默认参数一致：floorId=1, deliveryType=2
+const (
+	MockAddressId  = "mock-address-1"
+	MockStoreId    = "6758"
+	MockTemplateId = "mock-template-1"
+)
+
+var defaultData = map[string]string{
+	dd.EndpointAddressList: `{
+		"addressList": [
+			{
+				"addressId": "mock-address-1",
+				"mobile": "138****0000",
+				"name": "张三",
+				"countryName": "中国",
+				"provinceName": "上海",
+				"cityName": "上海市",
+				"districtName": "浦东新区",
+				"receiverAddress": "张杨路",
+				"detailAddress": "1号楼101",
+				"latitude": "31.2304",
+				"longitude": "121.4737"
+			},
+			{
+				"addressId": "mock-address-2",
+				"mobile": "139****0000",
+				"name": "李四",
+				"countryName": "中国",
+				"provinceName": "上海",
+				"cityName": "上海市",
+				"districtName": "闵行区",
+				"receiverAddress": "七莘路",
+				"detailAddress": "2号楼202",
+				"latitude": "31.1120",
+				"longitude": "121.3817"
+			}
+		]
+	}`,
+	dd.EndpointSaveDeliveryAddress: `{"result": true}`,
+	dd.EndpointStoreList: `{
+		"storeList": [
+			{
+				"storeId": "6758",
+				"storeName": "山姆会员商店(外高桥店)",
+				"storeType": 2,
+				"storeAreaBlockVerifyData": {"areaBlockId": "mock-block-1"},
+				"storeRecmdDeliveryTemplateData": {"storeDeliveryTemplateId": "mock-template-1"},
+				"storeDeliveryModeVerifyData": {"deliveryModeId": "1009", "deliveryType": 2}
+			}
+		]
+	}`,
+	dd.EndpointUserCart: `{
+		"floorInfoList": [
+			{
+				"floorId": 1,
+				"deliveryType": 2,
+				"amount": "167.70",
+				"quantity": 3,
+				"storeId": "6758",
+				"normalGoodsList": [
+					{
+						"spuId": "spu-milk",
+						"skuId": "sku-milk",
+						"storeId": "6758",
+						"goodsName": "Member's Mark 全脂牛奶 1L*2",
+						"price": 4990,
+						"quantity": 2,
+						"stockQuantity": 20,
+						"stockStatus": true,
+						"isPutOnSale": true,
+						"isAvailable": true,
+						"isSelected": true,
+						"weight": 2.1,
+						"purchaseLimitVO": {"limitNum": 0, "residuePurchaseNum": 0}
+					},
+					{
+						"spuId": "spu-beef",
+						"skuId": "sku-beef",
+						"storeId": "6758",
+						"goodsName": "澳洲牛腱 1.2kg",
+						"price": 6790,
+						"quantity": 1,
+						"stockQuantity": 5,
+						"stockStatus": true,
+						"isPutOnSale": true,
+						"isAvailable": true,
+						"isSelected": true,
+						"weight": 1.2,
+						"purchaseLimitVO": {"limitNum": 2, "residuePurchaseNum": 2}
+					}
+				],
+				"shortageStockGoodsList": [],
+				"allOutOfStockGoodsList": [
+					{
+						"spuId": "spu-eggs",
+						"skuId": "sku-eggs",
+						"storeId": "6758",
+						"goodsName": "可生食鸡蛋 30枚",
+						"price": 5980,
+						"quantity": 1,
+						"stockQuantity": 0,
+						"stockStatus": false,
+						"isPutOnSale": true,
+						"isAvailable": false,
+						"isSelected": true,
+						"weight": 1.8,
+						"purchaseLimitVO": {"limitNum": 0, "residuePurchaseNum": 0}
+					}
+				]
+			}
+		]
+	}`,
+	dd.EndpointCheckGoods: `{"isHasException": false}`,
+	dd.EndpointSettleInfo: `{
+		"saasId": "1818",
+		"uid": "mock-uid",
+		"floorId": 1,
+		"floorName": "普通商品",
+		"deliveryFee": "0",
+		"settleDelivery": [
+			{
+				"deliveryType": 2,
+				"deliveryName": "全城配",
+				"storeDeliveryTemplateId": "mock-template-1",
+				"deliveryModeIdList": ["1009"],
+				"areaBlockId": "mock-block-1",
+				"areaBlockName": "浦东"
+			}
+		],
+		"deliveryAddress": {"addressId": "mock-address-1", "name": "张三", "districtName": "浦东新区"}
+	}`,
+}
+
+// catalogData 不在默认购物车中、可通过加购接口加入购物车的商品，
+// 用于替代缺货的鸡蛋：spu-eggs-brown无货，spu-eggs-free有货
+const catalogData = `[
+	{
+		"spuId": "spu-eggs-brown",
+		"skuId": "sku-eggs-brown",
+		"storeId": "6758",
+		"goodsName": "褐壳鸡蛋 20枚",
+		"price": 3980,
+		"stockQuantity": 0,
+		"stockStatus": false,
+		"isPutOnSale": true,
+		"isAvailable": false,
+		"weight": 1.2,
+		"purchaseLimitVO": {"limitNum": 0, "residuePurchaseNum": 0}
+	},
+	{
+		"spuId": "spu-eggs-free",
+		"skuId": "sku-eggs-free",
+		"storeId": "6758",
+		"goodsName": "散养鸡蛋 10枚",
+		"price": 2990,
+		"stockQuantity": 50,
+		"stockStatus": true,
+		"isPutOnSale": true,
+		"isAvailable": true,
+		"weight": 0.6,
+		"purchaseLimitVO": {"limitNum": 0, "residuePurchaseNum": 0}
+	}
+]`
+
+var shanghai = dd.Shanghai
+
+// capacityData 生成请求日期的可用配送时段，未指定日期时为今明两天
+func capacityData(now time.Time, dates []string) string {
+	type slot struct {
+		StartTime     string `json:"startTime"`
+		EndTime       string `json:"endTime"`
+		TimeISFull    bool   `json:"timeISFull"`
+		Disabled      bool   `json:"disabled"`
+		StartRealTime string `json:"startRealTime"`
+		EndRealTime   string `json:"endRealTime"`
+	}
+	type day struct {
+		StrDate    string `json:"strDate"`
+		DateISFull bool   `json:"dateISFull"`
+		List       []slot `json:"list"`
+	}
+	millis := func(t time.Time) string {
+		return fmt.Sprintf("%d", t.UnixNano()/int64(time.Millisecond))
+	}
+
+	now = now.In(shanghai)
+	days := make([]day, 0)
+	if len(dates) == 0 {
+		dates = []string{now.Format("2006-01-02"), now.AddDate(0, 0, 1).Format("2006-01-02")}
+	}
+	for _, v := range dates {
+		date, err := time.ParseInLocation("2006-01-02", v, shanghai)
+		if err != nil {
+			continue
+		}
+		d := day{StrDate: date.Format("01月02日"), List: make([]slot, 0)}
+		for _, hour := range []int{9, 14, 18} {
+			start := date.Add(time.Duration(hour) * time.Hour)
+			end := start.Add(4 * time.Hour)
+			d.List = append(d.List, slot{
+				StartTime:     start.Format("15:04"),
+				EndTime:       end.Format("15:04"),
+				Disabled:      end.Before(now),
+				StartRealTime: millis(start),
+				EndRealTime:   millis(end),
+			})
+		}
+		days = append(days, d)
+	}
+	b, _ := json.Marshal(map[string]interface{}{
+		"capcityResponseList":                  days,
+		"getPortalPerformanceTemplateResponse": "",
+	})
+	return string(b)
+}
+
+func orderData(seq int) string {
+	return fmt.Sprintf(`{
+		"isSuccess": true,
+		"orderNo": "MOCK%08d",
+		"payAmount": "167.70",
+		"channel": "wechat",
+		"PayInfo": {"PayInfo": "mock-pay-info", "OutTradeNo": "MOCKOUT%08d", "TotalAmt": 16770}
+	}`, seq, seq)
+}
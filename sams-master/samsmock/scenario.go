@@ -0,0 +1,98 @@
+package samsmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Duration 支持 "5s"、"1m30s" 形式的JSON时长
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(time.Duration(value) * time.Millisecond)
+	case string:
+		t, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(t)
+	default:
+		return fmt.Errorf("无效的时长: %s", b)
+	}
+	return nil
+}
+
+// Response 一次接口响应
+type Response struct {
+	Status int             `json:"status"` //HTTP状态码，默认200
+	Code   string          `json:"code"`   //业务code，默认Success
+	Msg    string          `json:"msg"`
+	Data   json.RawMessage `json:"data"`  //为空时使用内置的默认数据
+	Body   string          `json:"body"`  //原样返回的响应体，优先于code/msg/data
+	Delay  Duration        `json:"delay"` //响应延迟
+}
+
+// Step 接口脚本中的一步
+// Times 为连续返回次数，Until 为相对服务启动的时间，任一条件满足后进入下一步；最后一步一直生效
+type Step struct {
+	Response
+	Times int      `json:"times"`
+	Until Duration `json:"until"`
+}
+
+// Scenario 模拟场景，key为dd.EndpointXXX
+type Scenario struct {
+	Name        string            `json:"name"`
+	Endpoints   map[string][]Step `json:"endpoints"`
+	Paths       map[string]string `json:"paths"`       //覆盖接口路径，与dd.Config.Endpoints一致，模拟服务按覆盖后的路径路由
+	ClockOffset Duration          `json:"clockOffset"` //服务器时间与本地时间的偏差，体现在响应的Date头
+}
+
+// LoadScenario 从JSON文件加载场景
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := &Scenario{}
+	if err := json.Unmarshal(b, sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// script 单个接口的执行进度
+type script struct {
+	steps []Step
+	index int
+	count int
+}
+
+func (s *script) next(elapsed time.Duration) Response {
+	if len(s.steps) == 0 {
+		return Response{}
+	}
+	for s.index < len(s.steps)-1 {
+		step := s.steps[s.index]
+		if (step.Times > 0 && s.count >= step.Times) || (step.Until > 0 && elapsed >= time.Duration(step.Until)) {
+			s.index++
+			s.count = 0
+			continue
+		}
+		break
+	}
+	s.count++
+	return s.steps[s.index].Response
+}
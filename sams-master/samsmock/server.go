@@ -0,0 +1,201 @@
+// Package samsmock 是一个可脚本化的山姆App接口模拟服务，
+// 覆盖dd包使用的全部接口，用于离线跑通完整下单流程和复现异常场景。
+package samsmock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/tidwall/gjson"
+)
+
+// Request 收到的请求记录
+type Request struct {
+	Endpoint string
+	Header   http.Header
+	Body     []byte
+	Time     time.Time
+}
+
+// Handler 模拟山姆App接口的http.Handler
+type Handler struct {
+	mu       sync.Mutex
+	start    time.Time
+	offset   time.Duration
+	paths    map[string]string //请求路径到接口名称
+	override map[string]string //Scenario.Paths
+	scripts  map[string]*script
+	requests []Request
+	orderSeq int
+	cart     *mockCart
+}
+
+// NewHandler 按场景创建模拟接口，scenario为nil时所有接口返回默认数据
+func NewHandler(scenario *Scenario) *Handler {
+	h := &Handler{
+		start:   time.Now(),
+		paths:   make(map[string]string),
+		scripts: make(map[string]*script),
+		cart:    newMockCart(),
+	}
+	if scenario != nil {
+		h.override = scenario.Paths
+	}
+	for name, path := range dd.DefaultEndpoints {
+		if p, ok := h.override[name]; ok {
+			path = p
+		}
+		h.paths[routePath(path)] = name
+		h.scripts[name] = &script{}
+	}
+	if scenario != nil {
+		h.offset = time.Duration(scenario.ClockOffset)
+		for name, steps := range scenario.Endpoints {
+			h.scripts[name] = &script{steps: steps}
+		}
+	}
+	return h
+}
+
+// routePath 接口路径对应的请求路径，完整地址取其中的路径部分
+func routePath(path string) string {
+	if u, err := url.Parse(path); err == nil && u.Host != "" {
+		path = u.Path
+	}
+	return "/" + strings.TrimLeft(path, "/")
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.paths[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+
+	h.mu.Lock()
+	now := time.Now()
+	h.requests = append(h.requests, Request{Endpoint: name, Header: r.Header.Clone(), Body: body, Time: now})
+	resp := h.scripts[name].next(now.Sub(h.start))
+	code, msg := resp.Code, resp.Msg
+	if code == "" {
+		code = "Success"
+	}
+	data := string(resp.Data)
+	if data == "" && code == "Success" {
+		switch name {
+		case dd.EndpointUserCart:
+			data = h.cart.data()
+		case dd.EndpointAddCartGoods:
+			if code, msg = h.cart.add(body); code == "Success" {
+				data = `{"result": true}`
+			}
+		case dd.EndpointUpdateCartGoods, dd.EndpointSelectCartGoods, dd.EndpointDeleteCartGoods:
+			if code, msg = h.cart.modify(name, body); code == "Success" {
+				data = `{"result": true}`
+			}
+		case dd.EndpointCapacity:
+			dates := make([]string, 0)
+			for _, v := range gjson.GetBytes(body, "perDateList").Array() {
+				dates = append(dates, v.Str)
+			}
+			data = capacityData(now, dates)
+		case dd.EndpointCommitPay:
+			h.orderSeq++
+			data = orderData(h.orderSeq)
+		default:
+			data = defaultData[name]
+		}
+	}
+	h.mu.Unlock()
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(resp.Delay)):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Date", time.Now().Add(h.offset).UTC().Format(http.TimeFormat))
+	w.WriteHeader(status)
+	if resp.Body != "" {
+		w.Write([]byte(resp.Body))
+		return
+	}
+	out := map[string]interface{}{
+		"code":      code,
+		"msg":       msg,
+		"errorMsg":  "",
+		"traceId":   "mock",
+		"requestId": "mock",
+	}
+	if data != "" {
+		out["data"] = json.RawMessage(data)
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// Requests 返回指定接口收到的请求，endpoint为空时返回全部
+func (h *Handler) Requests(endpoint string) []Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := make([]Request, 0)
+	for _, v := range h.requests {
+		if endpoint == "" || v.Endpoint == endpoint {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// Count 返回指定接口的请求次数
+func (h *Handler) Count(endpoint string) int {
+	return len(h.Requests(endpoint))
+}
+
+// Server 基于httptest的模拟服务，供测试使用
+type Server struct {
+	*Handler
+	*httptest.Server
+}
+
+// NewServer 启动模拟服务，使用完毕后调用Close
+func NewServer(scenario *Scenario) *Server {
+	h := NewHandler(scenario)
+	return &Server{Handler: h, Server: httptest.NewServer(h)}
+}
+
+// Config 返回指向模拟服务的dd.Config，场景覆盖的接口路径同时写入Endpoints
+func (s *Server) Config() dd.Config {
+	var endpoints map[string]string
+	if len(s.override) > 0 {
+		endpoints = make(map[string]string, len(s.override))
+		for name, path := range s.override {
+			endpoints[name] = routePath(path)
+		}
+	}
+	return dd.Config{
+		Endpoints:    endpoints,
+		AuthToken:    "mock-token",
+		FloorId:      1,
+		DeliveryType: 2,
+		AddressId:    MockAddressId,
+		PayMethod:    1,
+		BaseURL:      s.URL,
+		Backoff:      dd.Backoff{Base: 10 * time.Millisecond, Max: 100 * time.Millisecond}, //缩短限流退避，便于测试
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+)
+
+// defaultSessionId 未指定会话的接口(/api/config、/api/start等)使用的会话
+const defaultSessionId = "default"
+
+var sessionIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var errNotConfigured = errors.New("请先配置参数")
+var errRunning = errors.New("程序运行中，请先停止")
+var errConfiguring = errors.New("正在保存配置，请稍后再试")
+var errRemoving = errors.New("会话正在删除")
+
+// webSession Web服务中一个账号的会话，配置、运行状态和日志与其他会话互不影响
+type webSession struct {
+	id string
+
+	mu          sync.RWMutex
+	session     *dd.DingdongSession
+	config      ConfigRequest
+	step        string
+	running     bool
+	configuring bool //正在初始化会话或刷新地址，此时不能开始执行或再次配置
+	removing    bool //正在停止并删除，此时不能配置或开始执行
+	cancel      context.CancelFunc
+	runId       int           //每次开始执行时递增，避免已停止的流程结束时影响新的流程
+	done        chan struct{} //当前流程的goroutine返回时关闭，停止后等待它返回再复用session
+
+	// 最近推送的地址、门店、商品和配送时段的副本。执行中的流程会修改session，
+	// 状态接口只读取这些副本，不直接访问session
+	address  *dd.Address
+	stores   []dd.Store
+	goods    []dd.Goods
+	excluded []dd.ExcludedGoods
+	slots    []dd.Slot
+}
+
+// sessionInfo 会话列表中的一项
+type sessionInfo struct {
+	Id      string      `json:"id"`
+	Step    string      `json:"step"`
+	Running bool        `json:"running"`
+	Address *dd.Address `json:"address,omitempty"`
+}
+
+// sessionManager 按ID管理会话
+type sessionManager struct {
+	mu       sync.RWMutex
+	sessions map[string]*webSession
+}
+
+var sessions = &sessionManager{sessions: map[string]*webSession{}}
+
+// get 返回指定会话，不存在时为nil
+func (m *sessionManager) get(id string) *webSession {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sessions[id]
+}
+
+// getOrCreate 返回指定会话，不存在时创建
+func (m *sessionManager) getOrCreate(id string) (*webSession, error) {
+	if !sessionIdPattern.MatchString(id) {
+		return nil, fmt.Errorf("会话ID只能包含字母、数字、_和-，且不超过32个字符: %q", id)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ws, ok := m.sessions[id]
+	if !ok {
+		ws = &webSession{id: id, step: "idle"}
+		m.sessions[id] = ws
+	}
+	return ws, nil
+}
+
+// remove 停止并删除会话。停止期间会话仍在列表中并标记为正在删除，
+// 同一ID的请求会被拒绝，流程返回后才删除，之后才能创建同一ID的新会话
+func (m *sessionManager) remove(id string) bool {
+	ws := m.get(id)
+	if ws == nil {
+		return false
+	}
+	ws.mu.Lock()
+	ws.removing = true
+	ws.mu.Unlock()
+	ws.stop()
+
+	m.mu.Lock()
+	if m.sessions[id] == ws {
+		delete(m.sessions, id)
+	}
+	m.mu.Unlock()
+	return true
+}
+
+// list 按ID排序返回全部会话
+func (m *sessionManager) list() []*webSession {
+	m.mu.RLock()
+	list := make([]*webSession, 0, len(m.sessions))
+	for _, ws := range m.sessions {
+		list = append(list, ws)
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+// stopAll 停止全部会话，用于关闭服务
+func (m *sessionManager) stopAll() {
+	for _, ws := range m.list() {
+		ws.stop()
+	}
+}
+
+func (ws *webSession) log(level, message string) {
+	broadcastMessage(ws.id, LogMessage{
+		SessionId: ws.id,
+		Time:      time.Now().Format("15:04:05"),
+		Level:     level,
+		Message:   message,
+	})
+}
+
+// update 保存并推送状态。引擎事件中的切片可能被流程继续修改，推送和保存的都是副本
+func (ws *webSession) update(status StatusUpdate) {
+	status.SessionId = ws.id
+	if status.Address != nil {
+		address := *status.Address
+		status.Address = &address
+	}
+	if status.Stores != nil {
+		status.Stores = append([]dd.Store(nil), status.Stores...)
+	}
+	if status.GoodsList != nil {
+		status.GoodsList = append([]dd.Goods(nil), status.GoodsList...)
+	}
+	if status.ExcludedGoods != nil {
+		status.ExcludedGoods = append([]dd.ExcludedGoods(nil), status.ExcludedGoods...)
+	}
+	if status.TimeSlots != nil {
+		status.TimeSlots = append([]dd.Slot(nil), status.TimeSlots...)
+	}
+
+	ws.mu.Lock()
+	ws.step = status.Step
+	if status.Address != nil {
+		ws.address = status.Address
+	}
+	if status.Stores != nil {
+		ws.stores = status.Stores
+	}
+	if status.GoodsList != nil {
+		ws.goods, ws.excluded = status.GoodsList, status.ExcludedGoods
+	}
+	if status.TimeSlots != nil {
+		ws.slots = status.TimeSlots
+	}
+	ws.mu.Unlock()
+	broadcastMessage(ws.id, status)
+}
+
+func (ws *webSession) info() sessionInfo {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	return sessionInfo{Id: ws.id, Step: ws.step, Running: ws.running, Address: ws.address}
+}
+
+// configure 使用新的配置初始化会话，返回地址列表及是否需要选择地址
+func (ws *webSession) configure(ctx context.Context, req ConfigRequest) (map[string]interface{}, error) {
+	if req.AuthToken == "" {
+		return nil, errors.New("authToken不能为空")
+	}
+	conf, err := req.Config()
+	if err != nil {
+		return nil, fmt.Errorf("配置错误: %w", err)
+	}
+	// Web模式下不能从标准输入选择地址，未匹配时返回地址列表，由用户通过 addresses/select 选择
+	conf.AddressSelector = dd.FirstAddress(dd.SelectAddressById(conf.AddressId), dd.SelectAddressById(conf.AddressIds...), dd.SelectAddressByKeyword(conf.AddressKeyword), dd.ReturnAddressList)
+
+	// 检查并标记正在配置，初始化期间不持有锁，其他请求不会开始执行或同时配置
+	ws.mu.Lock()
+	switch {
+	case ws.removing:
+		ws.mu.Unlock()
+		return nil, errRemoving
+	case ws.running:
+		ws.mu.Unlock()
+		return nil, errRunning
+	case ws.configuring:
+		ws.mu.Unlock()
+		return nil, errConfiguring
+	}
+	ws.configuring = true
+	ws.mu.Unlock()
+	defer func() {
+		ws.mu.Lock()
+		ws.configuring = false
+		ws.mu.Unlock()
+	}()
+
+	session := &dd.DingdongSession{
+		SettleDeliveryInfo: map[int]dd.SettleDeliveryInfo{},
+		StoreList:          map[string]dd.Store{},
+	}
+	err = session.InitSession(ctx, conf)
+	if err != nil && !errors.Is(err, dd.ErrAddressNotSelected) {
+		return nil, fmt.Errorf("初始化失败: %w", err)
+	}
+	needSelect := err != nil
+
+	stores := make([]dd.Store, 0, len(session.StoreList))
+	for _, store := range session.StoreList {
+		stores = append(stores, store)
+	}
+	ws.mu.Lock()
+	ws.session = session
+	ws.config = req
+	ws.address, ws.stores, ws.goods, ws.excluded, ws.slots = nil, stores, nil, nil, nil
+	if !needSelect {
+		address := session.Address
+		ws.address = &address
+	}
+	ws.mu.Unlock()
+
+	data := map[string]interface{}{
+		"sessionId":   ws.id,
+		"addressList": session.AddressList,
+		"needSelect":  needSelect,
+	}
+	if needSelect {
+		ws.log("warning", "配置保存成功，请选择收货地址")
+		ws.update(StatusUpdate{Step: "configured", Status: "stopped"})
+	} else {
+		ws.log("success", "配置保存成功")
+		ws.update(StatusUpdate{Step: "configured", Status: "stopped", Address: &session.Address})
+		data["selectedAddress"] = session.Address
+	}
+	return data, nil
+}
+
+// refreshAddresses 重新获取收货地址列表。执行中的流程会使用session，此时不能刷新；
+// 请求期间不持有锁，但标记为正在配置，其他请求不会开始执行或同时配置
+func (ws *webSession) refreshAddresses(ctx context.Context) (map[string]interface{}, error) {
+	ws.mu.Lock()
+	switch {
+	case ws.removing:
+		ws.mu.Unlock()
+		return nil, errRemoving
+	case ws.running:
+		ws.mu.Unlock()
+		return nil, errRunning
+	case ws.configuring:
+		ws.mu.Unlock()
+		return nil, errConfiguring
+	case ws.session == nil:
+		ws.mu.Unlock()
+		return nil, errNotConfigured
+	}
+	session := ws.session
+	ws.configuring = true
+	ws.mu.Unlock()
+	defer func() {
+		ws.mu.Lock()
+		ws.configuring = false
+		ws.mu.Unlock()
+	}()
+
+	err, addrList := session.GetAddress(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取地址失败: %w", err)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	session.AddressList = addrList
+	data := map[string]interface{}{"addressList": addrList}
+	if ws.address != nil {
+		data["selectedAddress"] = *ws.address
+	}
+	return data, nil
+}
+
+// selectAddress 从地址列表中选择收货地址
+func (ws *webSession) selectAddress(addressId string) (dd.Address, error) {
+	ws.mu.Lock()
+	if ws.removing {
+		ws.mu.Unlock()
+		return dd.Address{}, errRemoving
+	}
+	if ws.running {
+		ws.mu.Unlock()
+		return dd.Address{}, errRunning
+	}
+	if ws.configuring {
+		ws.mu.Unlock()
+		return dd.Address{}, errConfiguring
+	}
+	if ws.session == nil {
+		ws.mu.Unlock()
+		return dd.Address{}, errNotConfigured
+	}
+	err := ws.session.SelectAddress(addressId)
+	address := ws.session.Address
+	ws.mu.Unlock()
+	if err != nil {
+		return dd.Address{}, err
+	}
+
+	ws.log("success", fmt.Sprintf("收货地址: %s %s %s %s", address.Name, address.DistrictName, address.ReceiverAddress, address.DetailAddress))
+	ws.update(StatusUpdate{Step: "configured", Status: "stopped", Address: &address})
+	return address, nil
+}
+
+// start 开始执行下单流程，override为可选的配置覆盖(如开抢时间)
+func (ws *webSession) start(override func(req *ConfigRequest) error) error {
+	ws.mu.Lock()
+	if ws.removing {
+		ws.mu.Unlock()
+		return errRemoving
+	}
+	if ws.running {
+		ws.mu.Unlock()
+		return errors.New("程序已在运行中")
+	}
+	if ws.configuring {
+		ws.mu.Unlock()
+		return errConfiguring
+	}
+	if ws.session == nil {
+		ws.mu.Unlock()
+		return errNotConfigured
+	}
+	if ws.session.Address.AddressId == "" {
+		ws.mu.Unlock()
+		return errors.New("请先选择收货地址")
+	}
+	req, session := ws.config, ws.session
+	if override != nil {
+		if err := override(&req); err != nil {
+			ws.mu.Unlock()
+			return err
+		}
+	}
+	startAt, leadTime, err := req.Schedule(session.Clock.Now())
+	if err != nil {
+		ws.mu.Unlock()
+		return err
+	}
+	stagger, err := req.CommitStagger()
+	if err != nil {
+		ws.mu.Unlock()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	ws.running = true
+	ws.cancel = cancel
+	ws.done = done
+	ws.runId++
+	runId := ws.runId
+	ws.mu.Unlock()
+
+	ws.log("info", "开始执行抢购流程...")
+	ws.update(StatusUpdate{Step: "starting", Status: "running"})
+
+	go ws.run(ctx, runId, done, session, engine.Options{StartAt: startAt, LeadTime: leadTime, Concurrency: req.Concurrency, Stagger: stagger, MaxFailures: req.MaxFailures, DryRun: req.DryRun})
+	return nil
+}
+
+// stop 停止正在执行的流程并等待流程返回，之后才能再次使用session，未运行时返回false
+func (ws *webSession) stop() bool {
+	ws.mu.Lock()
+	running := ws.running
+	if ws.cancel != nil {
+		ws.cancel()
+		ws.cancel = nil
+	}
+	done := ws.done
+	ws.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	return running
+}
+
+// run 执行下单流程，流程由engine执行，这里只负责推送日志和状态；返回时关闭done
+func (ws *webSession) run(ctx context.Context, runId int, done chan struct{}, session *dd.DingdongSession, opts engine.Options) {
+	defer close(done)
+	defer func() {
+		ws.mu.Lock()
+		if ws.runId == runId {
+			if ws.cancel != nil {
+				ws.cancel()
+				ws.cancel = nil
+			}
+			ws.running = false
+		}
+		ws.mu.Unlock()
+	}()
+
+	opts.Subscribers = []engine.Subscriber{
+		ws.subscriber(),
+		engine.BarkNotifier(ctx, session, func(err error) {
+			ws.log("error", "推送通知失败: "+err.Error())
+		}),
+	}
+	_, err := engine.New(session, opts).Run(ctx)
+	switch {
+	case err == nil:
+		// 下单成功的状态已由OrderPlaced事件推送
+	case ctx.Err() != nil:
+		// 用户手动停止，状态已在停止接口中更新
+	default:
+		ws.update(StatusUpdate{Step: "stopped", Status: "error", Error: err.Error()})
+	}
+}
+
+// subscriber 将引擎事件转换为该会话的日志和状态推送给WebSocket客户端
+func (ws *webSession) subscriber() engine.Subscriber {
+	return engine.SubscriberFunc(func(ev engine.Event) {
+		switch e := ev.(type) {
+		case engine.StepEntered:
+			ws.update(StatusUpdate{Step: e.State.String(), Status: "running"})
+			return
+		case engine.AddressSaved:
+			address := e.Address
+			ws.update(StatusUpdate{Step: "address_saved", Status: "running", Address: &address})
+		case engine.AddressSwitched:
+			address := e.To
+			ws.update(StatusUpdate{Step: "address_switched", Status: "running", Address: &address})
+		case engine.StoresDiscovered:
+			ws.update(StatusUpdate{Step: "stores_loaded", Status: "running", Stores: e.Stores})
+		case engine.CartLoaded:
+			ws.update(StatusUpdate{Step: "cart_loaded", Status: "running", GoodsList: e.Goods, ExcludedGoods: e.Excluded})
+		case engine.SettleChecked:
+			ws.update(StatusUpdate{Step: "settle_checked", Status: "running", DeliveryFee: e.SettleInfo.DeliveryFee})
+		case engine.SlotsFound:
+			ws.update(StatusUpdate{Step: "capacity_loaded", Status: "running", TimeSlots: e.Slots})
+		case engine.OrderPlaced:
+			ws.update(StatusUpdate{Step: "order_success", Status: "success", Order: e.Order, Substitutions: e.Substitutions})
+		case engine.DryRunReady:
+			ws.update(StatusUpdate{Step: "dry_run_ready", Status: "success", DryRun: e.Plan})
+		case engine.ScheduleWaiting:
+			ws.update(StatusUpdate{Step: "waiting_" + e.Phase, Status: "running"})
+		}
+		ws.log(engine.Describe(ev))
+	})
+}
+
+// status 当前状态，用于状态接口及WebSocket连接建立时推送，内容取自最近推送的副本
+func (ws *webSession) status() StatusUpdate {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	status := StatusUpdate{
+		SessionId:     ws.id,
+		Step:          ws.step,
+		Status:        "stopped",
+		Address:       ws.address,
+		Stores:        ws.stores,
+		GoodsList:     ws.goods,
+		ExcludedGoods: ws.excluded,
+		TimeSlots:     ws.slots,
+	}
+	if ws.running {
+		status.Status = "running"
+	}
+	return status
+}
+
+// stats 各接口的请求及限流统计
+func (ws *webSession) stats() (map[string]dd.EndpointStats, error) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	if ws.session == nil || ws.session.Limiter == nil {
+		return nil, errNotConfigured
+	}
+	return ws.session.Limiter.Stats(), nil
+}
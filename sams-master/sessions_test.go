@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// apiResult 接口返回，Data保留原始JSON
+type apiResult struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// newTestServer 使用独立的会话列表启动Web服务，测试结束后停止全部会话并恢复
+func newTestServer(t *testing.T) *httptest.Server {
+	saved := sessions
+	sessions = &sessionManager{sessions: map[string]*webSession{}}
+	srv := httptest.NewServer(newServeMux())
+	t.Cleanup(func() {
+		sessions.stopAll()
+		srv.Close()
+		sessions = saved
+	})
+	return srv
+}
+
+func callAPI(t *testing.T, method, url string, body interface{}) (int, apiResult) {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求%s失败: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var result apiResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+// sessionConfig 指向模拟服务的会话配置
+func sessionConfig(id string, mock *samsmock.Server) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        id,
+		"authToken": "mock-token",
+		"addressId": samsmock.MockAddressId,
+		"baseUrl":   mock.URL,
+	}
+}
+
+// waitStatus 等待会话的状态接口返回指定状态，step为空时不比较步骤
+func waitStatus(t *testing.T, base, id, step, status string) StatusUpdate {
+	t.Helper()
+	var current StatusUpdate
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		_, result := callAPI(t, http.MethodGet, base+"/api/sessions/"+id+"/status", nil)
+		json.Unmarshal(result.Data, &current)
+		if (step == "" || current.Step == step) && current.Status == status {
+			return current
+		}
+	}
+	t.Fatalf("会话%s期望为%s %s，实际为: %+v", id, step, status, current)
+	return current
+}
+
+// wsMessages 连接WebSocket并收集消息，收到第一条(当前状态)后才返回，此时连接已开始接收广播
+func wsMessages(t *testing.T, base, id string) <-chan map[string]interface{} {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/ws?session="+id, nil)
+	if err != nil {
+		t.Fatalf("连接WebSocket失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	messages := make(chan map[string]interface{}, 1000)
+	first := make(chan struct{})
+	go func() {
+		defer close(messages)
+		for i := 0; ; i++ {
+			var msg map[string]interface{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if i == 0 {
+				close(first)
+			}
+			messages <- msg
+		}
+	}()
+	select {
+	case <-first:
+	case <-time.After(5 * time.Second):
+		t.Fatal("未收到WebSocket的当前状态")
+	}
+	return messages
+}
+
+// drain 取出已收到的消息
+func drain(messages <-chan map[string]interface{}) []map[string]interface{} {
+	list := make([]map[string]interface{}, 0)
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return list
+			}
+			list = append(list, msg)
+		case <-time.After(200 * time.Millisecond):
+			return list
+		}
+	}
+}
+
+// TestWebSessions 测试Web服务的多账号会话
+// 验证两个会话同时运行互不影响、WebSocket只推送订阅的会话、运行中拒绝配置、停止后重新开始以及删除会话
+func TestWebSessions(t *testing.T) {
+	srv := newTestServer(t)
+	// 会话a提交订单一直没有返回，会话b正常下单
+	mockA := samsmock.NewServer(&samsmock.Scenario{
+		Endpoints: map[string][]samsmock.Step{
+			dd.EndpointCommitPay: {{Response: samsmock.Response{Delay: samsmock.Duration(10 * time.Second)}}},
+		},
+	})
+	defer mockA.Close()
+	mockB := samsmock.NewServer(nil)
+	defer mockB.Close()
+
+	for id, mock := range map[string]*samsmock.Server{"a": mockA, "b": mockB} {
+		if code, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions", sessionConfig(id, mock)); code != http.StatusOK || !result.Success {
+			t.Fatalf("配置会话%s失败: %d %s", id, code, result.Message)
+		}
+	}
+	messagesA := wsMessages(t, srv.URL, "a")
+	messagesB := wsMessages(t, srv.URL, "b")
+
+	t.Run("测试两个会话同时运行", func(t *testing.T) {
+		if _, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions/a/start", nil); !result.Success {
+			t.Fatalf("会话a开始失败: %s", result.Message)
+		}
+		for deadline := time.Now().Add(5 * time.Second); mockA.Count(dd.EndpointCommitPay) == 0; time.Sleep(20 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("会话a未提交订单")
+			}
+		}
+		if _, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions/b/start", nil); !result.Success {
+			t.Fatalf("会话b开始失败: %s", result.Message)
+		}
+
+		if status := waitStatus(t, srv.URL, "b", "order_success", "stopped"); status.SessionId != "b" {
+			t.Errorf("会话b的状态有误: %+v", status)
+		}
+		waitStatus(t, srv.URL, "a", "", "running")
+		if n := mockA.Count(dd.EndpointCommitPay); n != 1 {
+			t.Errorf("会话b下单不应影响会话a，会话a提交%d次", n)
+		}
+		if n := mockB.Count(dd.EndpointCommitPay); n != 1 {
+			t.Errorf("会话b应只提交1次，实际为: %d", n)
+		}
+
+		t.Log("✅ 两个会话同时运行测试通过")
+	})
+
+	t.Run("测试WebSocket只推送订阅的会话", func(t *testing.T) {
+		for id, messages := range map[string]<-chan map[string]interface{}{"a": messagesA, "b": messagesB} {
+			list := drain(messages)
+			steps := map[string]bool{}
+			for _, msg := range list {
+				if msg["sessionId"] != id {
+					t.Errorf("订阅会话%s的连接收到了其他会话的消息: %v", id, msg)
+				}
+				if step, ok := msg["step"].(string); ok {
+					steps[step] = true
+				}
+			}
+			if !steps["starting"] {
+				t.Errorf("会话%s的连接应收到开始执行的状态，实际为: %v", id, steps)
+			}
+			if (id == "b") != steps["order_success"] {
+				t.Errorf("只有会话b的连接应收到下单成功，会话%s收到: %v", id, steps)
+			}
+		}
+
+		t.Log("✅ WebSocket只推送订阅的会话测试通过")
+	})
+
+	t.Run("测试运行中拒绝配置", func(t *testing.T) {
+		code, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions/a/config", sessionConfig("a", mockA))
+		if code != http.StatusBadRequest || result.Message != errRunning.Error() {
+			t.Errorf("运行中应拒绝配置，实际为: %d %s", code, result.Message)
+		}
+		_, result = callAPI(t, http.MethodPost, srv.URL+"/api/sessions/a/addresses", nil)
+		if result.Message != errRunning.Error() {
+			t.Errorf("运行中应拒绝刷新地址，实际为: %s", result.Message)
+		}
+		_, result = callAPI(t, http.MethodPost, srv.URL+"/api/sessions/a/addresses/select", map[string]string{"addressId": samsmock.MockAddressId})
+		if result.Message != errRunning.Error() {
+			t.Errorf("运行中应拒绝选择地址，实际为: %s", result.Message)
+		}
+		if _, result = callAPI(t, http.MethodPost, srv.URL+"/api/sessions/b/config", sessionConfig("b", mockB)); !result.Success {
+			t.Errorf("会话a运行中不应影响配置会话b: %s", result.Message)
+		}
+
+		t.Log("✅ 运行中拒绝配置测试通过")
+	})
+
+	t.Run("测试配置中拒绝开始", func(t *testing.T) {
+		mockC := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointAddressList: {{Response: samsmock.Response{Delay: samsmock.Duration(500 * time.Millisecond)}}},
+			},
+		})
+		defer mockC.Close()
+		configured := make(chan apiResult, 1)
+		go func() {
+			_, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions", sessionConfig("c", mockC))
+			configured <- result
+		}()
+		for deadline := time.Now().Add(5 * time.Second); mockC.Count(dd.EndpointAddressList) == 0; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("会话c未开始配置")
+			}
+		}
+
+		if _, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions/c/config", sessionConfig("c", mockC)); result.Message != errConfiguring.Error() {
+			t.Errorf("配置中应拒绝再次配置，实际为: %s", result.Message)
+		}
+		if _, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions/c/start", nil); result.Message != errConfiguring.Error() {
+			t.Errorf("配置中应拒绝开始，实际为: %s", result.Message)
+		}
+		if result := <-configured; !result.Success {
+			t.Errorf("会话c配置失败: %s", result.Message)
+		}
+
+		t.Log("✅ 配置中拒绝开始测试通过")
+	})
+
+	t.Run("测试停止后重新开始", func(t *testing.T) {
+		ws := sessions.get("a")
+		ws.mu.RLock()
+		done, runId := ws.done, ws.runId
+		ws.mu.RUnlock()
+
+		if _, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions/a/stop", nil); !result.Success {
+			t.Fatalf("停止失败: %s", result.Message)
+		}
+		select {
+		case <-done:
+		default:
+			t.Fatal("停止接口返回时流程应已返回")
+		}
+		waitStatus(t, srv.URL, "a", "stopped", "stopped")
+
+		if _, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions/a/start", nil); !result.Success {
+			t.Fatalf("重新开始失败: %s", result.Message)
+		}
+		for deadline := time.Now().Add(5 * time.Second); mockA.Count(dd.EndpointCommitPay) < 2; time.Sleep(20 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("重新开始后会话a未提交订单")
+			}
+		}
+		ws.mu.RLock()
+		running, newRunId := ws.running, ws.runId
+		ws.mu.RUnlock()
+		if !running || newRunId != runId+1 {
+			t.Errorf("重新开始后应为新的流程，实际为: %v %d", running, newRunId)
+		}
+		//会话b在上一个测试中重新配置过，停止会话a不应改变它的状态
+		waitStatus(t, srv.URL, "b", "configured", "stopped")
+
+		t.Log("✅ 停止后重新开始测试通过")
+	})
+
+	t.Run("测试删除运行中的会话", func(t *testing.T) {
+		old := sessions.get("a")
+		if code, _ := callAPI(t, http.MethodDelete, srv.URL+"/api/sessions/a", nil); code != http.StatusOK {
+			t.Fatalf("删除会话失败: %d", code)
+		}
+		if sessions.get("a") != nil {
+			t.Fatal("删除后会话应不在列表中")
+		}
+		old.mu.RLock()
+		running := old.running
+		old.mu.RUnlock()
+		if running {
+			t.Error("删除返回时原会话的流程应已停止")
+		}
+		if err := old.start(nil); err != errRemoving {
+			t.Errorf("已删除的会话不应再开始，实际为: %v", err)
+		}
+		if _, err := old.configure(context.Background(), ConfigRequest{AuthToken: "mock-token", BaseURL: mockA.URL}); err != errRemoving {
+			t.Errorf("已删除的会话不应再配置，实际为: %v", err)
+		}
+
+		if _, result := callAPI(t, http.MethodPost, srv.URL+"/api/sessions", sessionConfig("a", mockA)); !result.Success {
+			t.Fatalf("重新创建会话失败: %s", result.Message)
+		}
+		if ws := sessions.get("a"); ws == nil || ws == old {
+			t.Error("删除后应创建新的会话")
+		}
+		if code, _ := callAPI(t, http.MethodDelete, srv.URL+"/api/sessions/missing", nil); code != http.StatusNotFound {
+			t.Errorf("删除不存在的会话应返回404，实际为: %d", code)
+		}
+
+		t.Log("✅ 删除运行中的会话测试通过")
+	})
+}
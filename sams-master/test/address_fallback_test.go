@@ -0,0 +1,141 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+	"github.com/tidwall/gjson"
+)
+
+// useAddresses 设置备选收货地址列表，用于runMockEngine
+func useAddresses(addressIds []string) func(session *dd.DingdongSession) {
+	return func(session *dd.DingdongSession) {
+		session.Conf.AddressIds = addressIds
+	}
+}
+
+// TestAddressFallback 测试备选收货地址
+// 验证当前地址不支持配送或门店已打烊时按顺序切换地址，以及备选地址用完时停止
+func TestAddressFallback(t *testing.T) {
+	t.Run("测试按顺序选择下一个地址", func(t *testing.T) {
+		session := &dd.DingdongSession{
+			Conf:        dd.Config{AddressIds: []string{"a", "missing", "b", "c"}},
+			AddressList: []dd.Address{{AddressId: "a"}, {AddressId: "b"}, {AddressId: "c"}, {AddressId: "x"}},
+			Address:     dd.Address{AddressId: "a"},
+		}
+		for _, expected := range []string{"b", "c"} {
+			next, err := session.NextAddress()
+			if err != nil || next.AddressId != expected || session.Conf.AddressId != expected {
+				t.Fatalf("期望切换到 %s，实际为: %s %v", expected, next.AddressId, err)
+			}
+		}
+		if _, err := session.NextAddress(); !errors.Is(err, dd.ErrNoFallbackAddress) {
+			t.Errorf("备选地址用完时应返回错误，实际为: %v", err)
+		}
+
+		session.Address = dd.Address{AddressId: "x"}
+		if next, _ := session.NextAddress(); next.AddressId != "a" {
+			t.Errorf("当前地址不在备选列表中时应从第一个开始，实际为: %s", next.AddressId)
+		}
+
+		addr, _ := dd.SelectAddressById("missing", "c").Select(session.AddressList)
+		if addr == nil || addr.AddressId != "c" {
+			t.Errorf("指定多个id时应选择第一个存在的地址，实际为: %v", addr)
+		}
+
+		t.Log("✅ 选择下一个地址测试通过")
+	})
+
+	t.Run("测试不支持配送时切换地址", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointSettleInfo: {
+					{Response: samsmock.Response{Code: "NO_MATCH_DELIVERY_MODE", Msg: "当前区域不支持配送，请重新选择地址"}, Times: 1},
+					{},
+				},
+			},
+		}, useAddresses([]string{samsmock.MockAddressId, "mock-address-2"}), engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		saved := server.Requests(dd.EndpointSaveDeliveryAddress)
+		if len(saved) != 2 || gjson.GetBytes(saved[1].Body, "addressId").Str != "mock-address-2" {
+			t.Fatalf("切换后应保存备选地址 mock-address-2，实际请求: %d次", len(saved))
+		}
+		if n := server.Count(dd.EndpointStoreList); n != 2 {
+			t.Errorf("切换地址后应重新获取门店，实际获取%d次", n)
+		}
+		switched := recorder.Events("address_switched")
+		if len(switched) != 1 {
+			t.Fatalf("期望1个切换地址事件，实际为: %d", len(switched))
+		}
+		e := switched[0].(engine.AddressSwitched)
+		if e.From.AddressId != samsmock.MockAddressId || e.To.AddressId != "mock-address-2" || !errors.Is(e.Reason, dd.NoMatchDeliverMode) {
+			t.Errorf("切换地址事件有误: %+v", e)
+		}
+
+		t.Logf("✅ 不支持配送时切换地址测试通过 - %s", order.OrderNo)
+	})
+
+	t.Run("测试门店已打烊时切换地址", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "STORE_HAS_CLOSED", Msg: "门店已打烊"}, Times: 1},
+					{},
+				},
+			},
+		}, useAddresses([]string{"mock-address-2"}), engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		saved := server.Requests(dd.EndpointSaveDeliveryAddress)
+		if len(saved) != 2 || gjson.GetBytes(saved[1].Body, "addressId").Str != "mock-address-2" {
+			t.Fatalf("门店已打烊时应切换到备选地址，实际请求: %d次", len(saved))
+		}
+
+		t.Log("✅ 门店已打烊时切换地址测试通过")
+	})
+
+	t.Run("测试备选地址用完", func(t *testing.T) {
+		_, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointSettleInfo: {
+					{Response: samsmock.Response{Code: "NO_MATCH_DELIVERY_MODE", Msg: "当前区域不支持配送，请重新选择地址"}},
+				},
+			},
+		}, useAddresses([]string{samsmock.MockAddressId, "mock-address-2"}), engine.Options{})
+		if order != nil || !errors.Is(err, dd.ErrNoFallbackAddress) {
+			t.Errorf("备选地址用完时应停止，实际为: %v %v", order, err)
+		}
+
+		t.Logf("✅ 备选地址用完测试通过 - %v", err)
+	})
+
+	t.Run("测试未配置备选地址", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointSettleInfo: {
+					{Response: samsmock.Response{Code: "NO_MATCH_DELIVERY_MODE", Msg: "当前区域不支持配送，请重新选择地址"}, Times: 1},
+					{},
+				},
+			},
+		}, nil, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		for _, req := range server.Requests(dd.EndpointSaveDeliveryAddress) {
+			if id := gjson.GetBytes(req.Body, "addressId").Str; id != samsmock.MockAddressId {
+				t.Errorf("未配置备选地址时不应切换地址，实际为: %s", id)
+			}
+		}
+
+		t.Log("✅ 未配置备选地址测试通过")
+	})
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestAddressSelector 测试收货地址选择策略
+// 验证按id、区县、关键字及交互输入选择地址，以及未选择时返回地址列表
+func TestAddressSelector(t *testing.T) {
+	addrList := []dd.Address{
+		{AddressId: "a1", Name: "张三", DistrictName: "浦东新区", ReceiverAddress: "张杨路", DetailAddress: "1号楼101"},
+		{AddressId: "a2", Name: "李四", DistrictName: "闵行区", ReceiverAddress: "七莘路", DetailAddress: "2号楼202"},
+	}
+
+	t.Run("测试选择策略", func(t *testing.T) {
+		tests := []struct {
+			Name     string
+			Selector dd.AddressSelector
+			Expected string
+		}{
+			{"按id选择", dd.SelectAddressById("a2"), "a2"},
+			{"id不存在", dd.SelectAddressById("a3"), ""},
+			{"按区县选择", dd.SelectAddressByDistrict("闵行区"), "a2"},
+			{"按关键字选择", dd.SelectAddressByKeyword("张杨"), "a1"},
+			{"关键字为空", dd.SelectAddressByKeyword(""), ""},
+			{"依次匹配", dd.FirstAddress(dd.SelectAddressById(""), dd.SelectAddressByKeyword("七莘")), "a2"},
+		}
+		for _, tt := range tests {
+			addr, err := tt.Selector.Select(addrList)
+			if err != nil {
+				t.Errorf("%s: 不应返回错误: %v", tt.Name, err)
+				continue
+			}
+			id := ""
+			if addr != nil {
+				id = addr.AddressId
+			}
+			if id != tt.Expected {
+				t.Errorf("%s: 期望选择 %q，实际为: %q", tt.Name, tt.Expected, id)
+			}
+		}
+
+		t.Log("✅ 选择策略测试通过")
+	})
+
+	t.Run("测试交互输入选择", func(t *testing.T) {
+		var out bytes.Buffer
+		addr, err := dd.PromptAddress(strings.NewReader("5\n1\n"), &out).Select(addrList)
+		if err != nil || addr == nil || addr.AddressId != "a2" {
+			t.Fatalf("期望选择a2，实际为: %v %v", addr, err)
+		}
+		if !strings.Contains(out.String(), "超过最大序号") {
+			t.Errorf("输入超出范围时应提示: %s", out.String())
+		}
+
+		_, err = dd.PromptAddress(strings.NewReader(""), &out).Select(addrList)
+		if !errors.Is(err, dd.ErrAddressNotSelected) {
+			t.Errorf("输入结束时应返回未选择地址，实际为: %v", err)
+		}
+
+		t.Log("✅ 交互输入选择测试通过")
+	})
+
+	t.Run("测试返回地址列表后选择", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+
+		conf := server.Config()
+		conf.AddressId = ""
+		conf.AddressSelector = dd.ReturnAddressList
+		session := &dd.DingdongSession{}
+		err := session.InitSession(context.Background(), conf)
+		if !errors.Is(err, dd.ErrAddressNotSelected) {
+			t.Fatalf("期望返回未选择地址，实际为: %v", err)
+		}
+		if len(session.AddressList) != 2 {
+			t.Fatalf("期望返回2个地址，实际为: %d", len(session.AddressList))
+		}
+
+		if err := session.SelectAddress("not-exist"); !errors.Is(err, dd.ErrAddressNotSelected) {
+			t.Errorf("选择不存在的地址应失败，实际为: %v", err)
+		}
+		if err := session.SelectAddress(session.AddressList[1].AddressId); err != nil {
+			t.Fatalf("选择地址失败: %v", err)
+		}
+		if session.Address.DistrictName != "闵行区" {
+			t.Errorf("期望选择闵行区地址，实际为: %s", session.Address.DistrictName)
+		}
+
+		t.Logf("✅ 返回地址列表后选择测试通过 - %s", session.Address.AddressId)
+	})
+}
@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+	"github.com/tidwall/gjson"
+)
+
+// TestBudget 测试订单金额上限
+// 验证超出上限时按优先级或单价减少商品、更新订单金额，以及无法满足上限时停止
+func TestBudget(t *testing.T) {
+	goodsList := []dd.Goods{
+		{SpuId: "a", GoodsName: "A", Price: 1000, Quantity: 3},
+		{SpuId: "b", GoodsName: "B", Price: 5000, Quantity: 1},
+		{SpuId: "c", GoodsName: "C", Price: 200, Quantity: 5},
+	}
+	quantities := func(goods []dd.Goods) map[string]int {
+		m := map[string]int{}
+		for _, g := range goods {
+			m[g.SpuId] = g.Quantity
+		}
+		return m
+	}
+
+	t.Run("测试按优先级减少", func(t *testing.T) {
+		goods, trims, err := dd.Budget{MaxAmount: 5000}.Apply(goodsList)
+		if err != nil {
+			t.Fatalf("调整失败: %v", err)
+		}
+		q := quantities(goods)
+		if len(goods) != 2 || q["a"] != 3 || q["c"] != 5 {
+			t.Errorf("应从购物车末尾开始移除C和B，再放回移除B后能放下的C，实际为: %v", q)
+		}
+		if len(trims) != 1 || trims[0].Goods.SpuId != "b" || trims[0].Quantity != 0 {
+			t.Errorf("调整记录有误: %+v", trims)
+		}
+		if goodsList[2].Quantity != 5 {
+			t.Error("调整不应修改原商品列表")
+		}
+
+		t.Logf("✅ 按优先级减少测试通过 - 总价%d", dd.GoodsAmount(goods))
+	})
+
+	t.Run("测试按单价减少", func(t *testing.T) {
+		goods, trims, err := dd.Budget{MaxAmount: 5000, Trim: dd.TrimMostExpensive}.Apply(goodsList)
+		if err != nil {
+			t.Fatalf("调整失败: %v", err)
+		}
+		q := quantities(goods)
+		if q["a"] != 3 || q["b"] != 0 || q["c"] != 5 || len(trims) != 1 {
+			t.Errorf("应只移除单价最高的B，实际为: %v", q)
+		}
+
+		goods, _, _ = dd.Budget{MaxAmount: 2500, Trim: dd.TrimMostExpensive}.Apply(goodsList[:1])
+		if len(goods) != 1 || goods[0].Quantity != 2 {
+			t.Errorf("应逐件减少数量，实际为: %+v", goods)
+		}
+
+		t.Logf("✅ 按单价减少测试通过 - 总价%d", dd.GoodsAmount(goods))
+	})
+
+	t.Run("测试放回减少过多的商品", func(t *testing.T) {
+		list := []dd.Goods{
+			{SpuId: "x", GoodsName: "X", Price: 4000, Quantity: 1, Priority: dd.PriorityPreferred},
+			{SpuId: "y", GoodsName: "Y", Price: 600, Quantity: 2, Priority: dd.PriorityOptional, MinQuantity: 2},
+		}
+		goods, trims, err := dd.Budget{MaxAmount: 1500}.Apply(list)
+		if err != nil {
+			t.Fatalf("调整失败: %v", err)
+		}
+		if q := quantities(goods); len(goods) != 1 || q["y"] != 2 {
+			t.Errorf("移除X后应按最少数量放回可选商品Y，实际为: %v", q)
+		}
+		if len(trims) != 1 || trims[0].Goods.SpuId != "x" {
+			t.Errorf("调整记录有误: %+v", trims)
+		}
+		if _, _, err := (dd.Budget{MaxAmount: 1000}).Apply(list); !errors.Is(err, dd.ErrOverBudget) {
+			t.Errorf("放回不足最少数量时不应放回，实际为: %v", err)
+		}
+
+		t.Logf("✅ 放回减少过多的商品测试通过 - 总价%d", dd.GoodsAmount(goods))
+	})
+
+	t.Run("测试未超出上限", func(t *testing.T) {
+		for _, budget := range []dd.Budget{{}, {MaxAmount: 9000}} {
+			goods, trims, err := budget.Apply(goodsList)
+			if err != nil || len(trims) != 0 || len(goods) != 3 {
+				t.Errorf("%+v 不应调整商品，实际为: %v %v", budget, trims, err)
+			}
+		}
+		if _, _, err := (dd.Budget{MaxAmount: 100}).Apply(goodsList); !errors.Is(err, dd.ErrOverBudget) {
+			t.Errorf("全部移除仍超出上限时应返回错误，实际为: %v", err)
+		}
+		if dd.FormatAmount(16770) != "167.70" || dd.FormatAmount(5) != "0.05" {
+			t.Errorf("金额格式有误: %s %s", dd.FormatAmount(16770), dd.FormatAmount(5))
+		}
+
+		t.Log("✅ 未超出上限测试通过")
+	})
+
+	runBudget := func(t *testing.T, budget dd.Budget, recorder *engine.Recorder) (*samsmock.Server, *dd.Order, error) {
+		server := samsmock.NewServer(nil)
+		t.Cleanup(server.Close)
+		session := newMockSession(t, server)
+		session.Conf.Budget = budget
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		order, err := engine.New(session, engine.Options{
+			Retry:       engine.FixedRetry(0),
+			Subscribers: []engine.Subscriber{recorder},
+		}).Run(ctx)
+		return server, order, err
+	}
+
+	t.Run("测试按上限下单", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, order, err := runBudget(t, dd.Budget{MaxAmount: 12000}, recorder)
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		body := gjson.ParseBytes(server.Requests(dd.EndpointCommitPay)[0].Body)
+		if goods := body.Get("goodsList").Array(); len(goods) != 1 || goods[0].Get("spuId").Str != "spu-milk" {
+			t.Errorf("应移除购物车末尾的牛腱，实际提交: %s", body.Get("goodsList").Raw)
+		}
+		if amount := body.Get("amount").Str; amount != "99.80" {
+			t.Errorf("订单金额应按调整后的商品计算，实际为: %s", amount)
+		}
+		if n := len(recorder.Events("goods_trimmed")); n != 1 {
+			t.Errorf("期望1个调整商品事件，实际为: %d", n)
+		}
+
+		t.Logf("✅ 按上限下单测试通过 - %s", order.OrderNo)
+	})
+
+	t.Run("测试无法满足上限时停止", func(t *testing.T) {
+		server, order, err := runBudget(t, dd.Budget{MaxAmount: 1000}, &engine.Recorder{})
+		if order != nil || !errors.Is(err, dd.ErrOverBudget) {
+			t.Fatalf("无法满足上限时应停止，实际为: %v %v", order, err)
+		}
+		if n := server.Count(dd.EndpointSettleInfo) + server.Count(dd.EndpointCommitPay); n != 0 {
+			t.Errorf("停止后不应结算或提交订单，实际请求%d次", n)
+		}
+
+		t.Logf("✅ 无法满足上限时停止测试通过 - %v", err)
+	})
+}
@@ -1,10 +1,12 @@
 package test
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
 	"github.com/tidwall/gjson"
 )
 
@@ -87,8 +89,8 @@ func TestGetCapacity(t *testing.T) {
 			t.Error("应该至少有一个可用时间段")
 		}
 
-		t.Logf("✅ 配送时间数据解析测试通过 - 日期: %s, 可用时段数: %d", 
-			strDate, availableSlots)
+		t.Logf("✅ 配送时间数据解析测试通过 - 日期: %s, 是否约满: %v, 可用时段数: %d", 
+			strDate, dateISFull, availableSlots)
 	})
 
 	t.Run("测试时间段筛选逻辑", func(t *testing.T) {
@@ -200,3 +202,82 @@ func TestGetCapacity(t *testing.T) {
 	})
 }
 
+
+// TestCapacityLookahead 测试配送时间查询日期
+// 验证查询日期按上海时区计算、可配置天数或指定日期，以及跨天时段的合并
+func TestCapacityLookahead(t *testing.T) {
+	t.Run("测试按上海时区计算日期", func(t *testing.T) {
+		// UTC 2022-04-19 17:00 为上海时间 2022-04-20 01:00
+		now := time.Date(2022, 4, 19, 17, 0, 0, 0, time.UTC)
+		dates := dd.Config{}.PerDateList(now)
+		if len(dates) != 2 || dates[0] != "2022-04-20" || dates[1] != "2022-04-21" {
+			t.Errorf("期望查询上海时间今明两天，实际为: %v", dates)
+		}
+
+		dates = dd.Config{CapacityDays: 3}.PerDateList(now)
+		if len(dates) != 3 || dates[2] != "2022-04-22" {
+			t.Errorf("期望查询3天，实际为: %v", dates)
+		}
+
+		dates = dd.Config{CapacityDays: 3, CapacityDates: []string{"2022-05-01"}}.PerDateList(now)
+		if len(dates) != 1 || dates[0] != "2022-05-01" {
+			t.Errorf("指定日期应优先于天数，实际为: %v", dates)
+		}
+
+		t.Logf("✅ 按上海时区计算日期测试通过 - %v", dd.Config{}.PerDateList(now))
+	})
+
+	t.Run("测试跨天时段合并", func(t *testing.T) {
+		// 22:00 - 02:00 的时段同时出现在相邻两天的列表中
+		overnight := dd.List{StartTime: "22:00", EndTime: "02:00", StartRealTime: "1650549600000", EndRealTime: "1650564000000"}
+		overnightFull := overnight
+		overnightFull.TimeISFull = true
+		capacity := &dd.Capacity{CapCityResponseList: []dd.CapCityResponse{
+			{StrDate: "04月22日", List: []dd.List{overnightFull}},
+			{StrDate: "04月21日", List: []dd.List{
+				overnight,
+				{StartTime: "09:00", EndTime: "12:00", StartRealTime: "1650502800000", EndRealTime: "1650513600000"},
+			}},
+			{StrDate: "04月20日", List: []dd.List{
+				{StartTime: "22:00", EndTime: "02:00", TimeISFull: true, StartRealTime: "1650463200000", EndRealTime: "1650477600000"},
+			}},
+		}}
+
+		slots := capacity.Slots()
+		if len(slots) != 3 {
+			t.Fatalf("重复的跨天时段应合并为一个，期望3个时段，实际为: %d", len(slots))
+		}
+		for i := 1; i < len(slots); i++ {
+			if slots[i].Start.Before(slots[i-1].Start) {
+				t.Errorf("时段应按开始时间排序: %v", slots)
+			}
+		}
+		if slots[2].Full {
+			t.Error("跨天时段在任一天可用时应视为可用")
+		}
+
+		t.Logf("✅ 跨天时段合并测试通过 - %d个时段", len(slots))
+	})
+
+	t.Run("测试按配置查询日期", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+		session := newMockSession(t, server)
+		session.Conf.CapacityDays = 3
+
+		capacity, err := session.GetCapacity(context.Background(), "mock-template")
+		if err != nil {
+			t.Fatalf("获取配送时间失败: %v", err)
+		}
+		requests := server.Requests(dd.EndpointCapacity)
+		dates := gjson.GetBytes(requests[0].Body, "perDateList").Array()
+		if len(dates) != 3 || dates[0].Str != time.Now().In(dd.Shanghai).Format("2006-01-02") {
+			t.Errorf("期望从上海时间今天起查询3天，实际为: %v", dates)
+		}
+		if len(capacity.CapCityResponseList) != 3 {
+			t.Errorf("期望返回3天的配送时间，实际为: %d", len(capacity.CapCityResponseList))
+		}
+
+		t.Logf("✅ 按配置查询日期测试通过 - %v", dates)
+	})
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
+	"github.com/tidwall/gjson"
+)
+
+// TestCartMutation 测试修改购物车
+// 验证加购、修改数量、勾选和移除商品的请求参数，以及修改后返回重新获取的购物车
+func TestCartMutation(t *testing.T) {
+	ctx := context.Background()
+	quantityOf := func(cart dd.Cart, spuId string) int {
+		goods, ok := cart.FindGoods(spuId)
+		if !ok {
+			return 0
+		}
+		return goods.Quantity
+	}
+	newCartSession := func(t *testing.T) (*samsmock.Server, *dd.DingdongSession) {
+		server := samsmock.NewServer(nil)
+		t.Cleanup(server.Close)
+		session := newMockSession(t, server)
+		if err := session.CheckCart(ctx); err != nil {
+			t.Fatalf("获取购物车失败: %v", err)
+		}
+		return server, session
+	}
+
+	t.Run("测试加购商品", func(t *testing.T) {
+		server, session := newCartSession(t)
+		//同一楼层出现多次时使用第一个
+		floor := session.Cart.FloorInfoList[0]
+		floor.StoreId = "other-store"
+		session.Cart.FloorInfoList = append(session.Cart.FloorInfoList, floor)
+		list := []dd.CartGoods{{SpuId: "spu-eggs-free", IncreaseQuantity: 3, IsSelected: true}}
+		cart, err := session.AddCartGoods(ctx, list...)
+		if err != nil {
+			t.Fatalf("加购失败: %v", err)
+		}
+		if list[0].StoreId != "" {
+			t.Errorf("不应修改传入的商品，实际为: %+v", list[0])
+		}
+		if quantityOf(cart, "spu-eggs-free") != 3 || cart.FloorInfoList[0].Amount != "257.40" {
+			t.Errorf("加购后的购物车有误: %+v", cart.FloorInfoList[0])
+		}
+		body := server.Requests(dd.EndpointAddCartGoods)[0].Body
+		if store := gjson.GetBytes(body, "cartGoodsInfoList.0.storeId").Str; store != samsmock.MockStoreId {
+			t.Errorf("未指定商店时应使用当前楼层的商店，实际为: %s", store)
+		}
+
+		cart, err = session.AddCartGoods(ctx, dd.CartGoods{SpuId: "spu-milk", IncreaseQuantity: 1, IsSelected: true})
+		if err != nil || quantityOf(cart, "spu-milk") != 3 {
+			t.Errorf("已在购物车中的商品应增加数量，实际为: %d %v", quantityOf(cart, "spu-milk"), err)
+		}
+		if n := server.Count(dd.EndpointUserCart); n != 3 {
+			t.Errorf("每次修改后应重新获取购物车，实际请求%d次", n)
+		}
+
+		_, err = session.AddCartGoods(ctx, dd.CartGoods{SpuId: "spu-unknown", IncreaseQuantity: 1})
+		var apiErr *dd.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "GOODS_NOT_EXIST" {
+			t.Errorf("加购不存在的商品应返回接口错误，实际为: %v", err)
+		}
+
+		t.Logf("✅ 加购商品测试通过 - 金额 %s", cart.FloorInfoList[0].Amount)
+	})
+
+	t.Run("测试修改数量和勾选", func(t *testing.T) {
+		server, session := newCartSession(t)
+		cart, err := session.UpdateCartGoods(ctx, "spu-beef", 2)
+		if err != nil || quantityOf(cart, "spu-beef") != 2 {
+			t.Fatalf("修改数量失败: %d %v", quantityOf(cart, "spu-beef"), err)
+		}
+		if q := gjson.GetBytes(server.Requests(dd.EndpointUpdateCartGoods)[0].Body, "cartGoodsInfoList.0.quantity").Int(); q != 2 {
+			t.Errorf("请求中的数量应为2，实际为: %d", q)
+		}
+
+		cart, err = session.SelectCartGoods(ctx, false, "spu-milk", "spu-beef")
+		if err != nil {
+			t.Fatalf("取消勾选失败: %v", err)
+		}
+		for _, spuId := range []string{"spu-milk", "spu-beef"} {
+			if goods, _ := cart.FindGoods(spuId); goods.IsSelected {
+				t.Errorf("%s 应已取消勾选", spuId)
+			}
+		}
+		if amount := cart.FloorInfoList[0].Amount; amount != "0.00" {
+			t.Errorf("全部取消勾选后金额应为0，实际为: %s", amount)
+		}
+
+		if _, err := session.UpdateCartGoods(ctx, "spu-beef", 0); err == nil {
+			t.Error("数量为0时应返回错误")
+		}
+
+		t.Log("✅ 修改数量和勾选测试通过")
+	})
+
+	t.Run("测试移除商品", func(t *testing.T) {
+		server, session := newCartSession(t)
+		cart, err := session.RemoveCartGoods(ctx, "spu-eggs", "spu-beef")
+		if err != nil {
+			t.Fatalf("移除失败: %v", err)
+		}
+		if _, ok := cart.FindGoods("spu-eggs"); ok || quantityOf(cart, "spu-beef") != 0 || quantityOf(cart, "spu-milk") != 2 {
+			t.Errorf("移除后的购物车有误: %+v", cart.FloorInfoList[0])
+		}
+
+		if _, err := session.RemoveCartGoods(ctx, "spu-eggs"); !errors.Is(err, dd.ErrNotInCart) {
+			t.Errorf("移除不在购物车中的商品应返回ErrNotInCart，实际为: %v", err)
+		}
+		if n := server.Count(dd.EndpointDeleteCartGoods); n != 1 {
+			t.Errorf("商品不在购物车中时不应请求接口，实际请求%d次", n)
+		}
+
+		t.Log("✅ 移除商品测试通过")
+	})
+}
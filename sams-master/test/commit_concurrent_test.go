@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// ignoreCancelTransport 忽略请求的取消，模拟请求在取消前已被服务器受理
+type ignoreCancelTransport struct{}
+
+func (ignoreCancelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return http.DefaultTransport.RoundTrip(req.WithContext(context.Background()))
+}
+
+// TestConcurrentCommit 测试并发提交订单
+// 验证错开为多个配送时段提交订单、失败后立即提交下一个时段、第一个成功后取消其余请求且不再提交、以及同时提交时重复订单的报告
+func TestConcurrentCommit(t *testing.T) {
+	t.Run("测试第一个成功后取消其余请求", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "NOT_DELIVERY_CAPACITY_ERROR"}, Times: 1},
+					{Response: samsmock.Response{Delay: samsmock.Duration(100 * time.Millisecond)}, Times: 1},
+					{Response: samsmock.Response{Delay: samsmock.Duration(2 * time.Second)}},
+				},
+			},
+		}, nil, engine.Options{Concurrency: 3, Stagger: 20 * time.Millisecond, Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		if n := server.Count(dd.EndpointCommitPay); n != 3 {
+			t.Errorf("期望在第一个成功前提交3个时段，实际为: %d", n)
+		}
+		if n := len(recorder.Events("commit_attempted")); n != 3 {
+			t.Errorf("期望3个提交事件，实际为: %d", n)
+		}
+		if n := len(recorder.Events("order_placed")); n != 1 {
+			t.Errorf("期望1个下单成功事件，实际为: %d", n)
+		}
+		if n := len(recorder.Events("duplicate_order")); n != 0 {
+			t.Errorf("取消的请求不应产生重复订单，实际为: %d", n)
+		}
+
+		t.Logf("✅ 第一个成功后取消其余请求测试通过 - 订单号: %s", order.OrderNo)
+	})
+
+	t.Run("测试全部失败后重新提交", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "NOT_DELIVERY_CAPACITY_ERROR"}, Times: 2},
+					{},
+				},
+			},
+		}, nil, engine.Options{Concurrency: 2, Stagger: engine.DefaultStagger})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 3 {
+			t.Errorf("时段约满后应为剩余时段再次提交，成功后不再提交，期望请求3次，实际为: %d", n)
+		}
+		if n := server.Count(dd.EndpointCapacity); n != 1 {
+			t.Errorf("仍有可用时段时不应重新获取配送时间，实际请求: %d", n)
+		}
+
+		t.Log("✅ 全部失败后重新提交测试通过")
+	})
+
+	t.Run("测试失败后立即提交下一个时段", func(t *testing.T) {
+		start := time.Now()
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "NOT_DELIVERY_CAPACITY_ERROR"}, Times: 1},
+					{},
+				},
+			},
+		}, nil, engine.Options{Concurrency: 2, Stagger: 5 * time.Second})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 2 {
+			t.Errorf("期望提交2次，实际为: %d", n)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("第一个时段失败后应立即提交下一个时段，实际耗时: %v", elapsed)
+		}
+
+		t.Log("✅ 失败后立即提交下一个时段测试通过")
+	})
+
+	t.Run("测试成功后不再提交其余时段", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+		session := newMockSession(t, server)
+		session.Client = &http.Client{Transport: ignoreCancelTransport{}}
+
+		recorder := &engine.Recorder{}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		order, err := engine.New(session, engine.Options{
+			Concurrency: 3,
+			Stagger:     engine.DefaultStagger,
+			Retry:       engine.FixedRetry(0),
+			Subscribers: []engine.Subscriber{recorder},
+		}).Run(ctx)
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 1 {
+			t.Errorf("第一个时段在间隔内成功后不应再提交，实际请求%d次", n)
+		}
+		if n := len(recorder.Events("commit_attempted")); n != 1 {
+			t.Errorf("期望1个提交事件，实际为: %d", n)
+		}
+		if n := len(recorder.Events("duplicate_order")); n != 0 {
+			t.Errorf("不应产生重复订单，实际为: %d", n)
+		}
+
+		t.Logf("✅ 成功后不再提交其余时段测试通过 - 订单号: %s", order.OrderNo)
+	})
+
+	t.Run("测试报告重复订单", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+		session := newMockSession(t, server)
+		session.Client = &http.Client{Transport: ignoreCancelTransport{}}
+
+		recorder := &engine.Recorder{}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		order, err := engine.New(session, engine.Options{
+			Concurrency: 2,
+			Stagger:     0,
+			Retry:       engine.FixedRetry(0),
+			Subscribers: []engine.Subscriber{recorder},
+		}).Run(ctx)
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		duplicates := recorder.Events("duplicate_order")
+		if len(duplicates) != 1 {
+			t.Fatalf("期望报告1个重复订单，实际为: %d", len(duplicates))
+		}
+		d := duplicates[0].(engine.DuplicateOrder)
+		if d.First.OrderNo != order.OrderNo || d.Order.OrderNo == order.OrderNo {
+			t.Errorf("重复订单信息不正确: %s %s", d.First.OrderNo, d.Order.OrderNo)
+		}
+
+		t.Logf("✅ 报告重复订单测试通过 - %s", d.Order.OrderNo)
+	})
+}
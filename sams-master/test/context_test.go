@@ -0,0 +1,59 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestContext 测试请求取消
+// 停止抢购时，进行中的请求和等待都应立即返回，而不是等到HTTP超时
+func TestContext(t *testing.T) {
+	t.Run("测试取消进行中的请求", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {{Response: samsmock.Response{Delay: samsmock.Duration(10 * time.Second)}}},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := session.CommitPay(ctx, dd.SettleDeliveryInfo{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("期望返回超时错误，实际为: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("取消后请求应立即返回，实际耗时: %v", elapsed)
+		}
+
+		t.Logf("✅ 取消进行中的请求测试通过 - %v", err)
+	})
+
+	t.Run("测试可取消的等待", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+
+		start := time.Now()
+		if err := dd.Sleep(ctx, 10*time.Second); err != context.Canceled {
+			t.Errorf("期望返回context.Canceled，实际为: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("取消后等待应立即返回，实际耗时: %v", elapsed)
+		}
+		if err := dd.Sleep(context.Background(), 10*time.Millisecond); err != nil {
+			t.Errorf("正常等待不应返回错误: %v", err)
+		}
+
+		t.Log("✅ 可取消的等待测试通过")
+	})
+}
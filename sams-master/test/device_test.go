@@ -0,0 +1,98 @@
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestDeviceProfile 测试请求头设备信息
+// 验证内置设备信息、从文件加载以及请求头的设置
+func TestDeviceProfile(t *testing.T) {
+	t.Run("测试内置设备信息", func(t *testing.T) {
+		p, err := dd.ResolveDeviceProfile("", "")
+		if err != nil || p.Name != dd.DefaultDeviceProfile {
+			t.Fatalf("期望使用默认设备信息，实际为: %+v %v", p, err)
+		}
+		p, err = dd.ResolveDeviceProfile("iphone13-ios15", "")
+		if err != nil || p.DeviceName != "iPhone14,5" || p.OSVersion != "15.4.1" {
+			t.Fatalf("期望选择iphone13-ios15，实际为: %+v %v", p, err)
+		}
+		if _, err := dd.ResolveDeviceProfile("not-exist", ""); err == nil {
+			t.Error("不存在的设备信息应返回错误")
+		}
+
+		t.Log("✅ 内置设备信息测试通过")
+	})
+
+	t.Run("测试从文件加载设备信息", func(t *testing.T) {
+		dir := t.TempDir()
+		single := filepath.Join(dir, "single.json")
+		list := filepath.Join(dir, "list.json")
+		ioutil.WriteFile(single, []byte(`{"name": "my-phone", "appVersion": "5.0.50.1", "osVersion": "16.0"}`), 0644)
+		ioutil.WriteFile(list, []byte(`[
+			{"name": "a", "appVersion": "5.0.48.0"},
+			{"name": "android", "appVersion": "5.0.49.0", "deviceType": "android", "userAgent": "okhttp/4.9.0", "headers": {"channel": "xiaomi"}}
+		]`), 0644)
+
+		p, err := dd.ResolveDeviceProfile("", single)
+		if err != nil || p.AppVersion != "5.0.50.1" {
+			t.Fatalf("加载单个设备信息失败: %+v %v", p, err)
+		}
+		if p.DeviceName != dd.DeviceProfiles[dd.DefaultDeviceProfile].DeviceName {
+			t.Errorf("未填写的字段应使用默认值，实际为: %s", p.DeviceName)
+		}
+
+		p, err = dd.ResolveDeviceProfile("android", list)
+		if err != nil || p.DeviceType != "android" || p.Headers["channel"] != "xiaomi" {
+			t.Fatalf("按名称加载设备信息失败: %+v %v", p, err)
+		}
+		p, err = dd.ResolveDeviceProfile(dd.DefaultDeviceProfile, list)
+		if err != nil || p.Name != dd.DefaultDeviceProfile {
+			t.Errorf("文件中不存在时应使用内置设备信息，实际为: %+v %v", p, err)
+		}
+
+		t.Log("✅ 从文件加载设备信息测试通过")
+	})
+
+	t.Run("测试请求头", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+
+		conf := server.Config()
+		conf.Device = dd.DeviceProfile{AppVersion: "5.0.49.0", DeviceType: "android", UserAgent: "okhttp/4.9.0", Headers: map[string]string{"channel": "xiaomi"}}
+		session := &dd.DingdongSession{StoreList: map[string]dd.Store{}}
+		if err := session.InitSession(context.Background(), conf); err != nil {
+			t.Fatalf("初始化失败: %v", err)
+		}
+		if err := session.CheckCart(context.Background()); err != nil {
+			t.Fatalf("获取购物车失败: %v", err)
+		}
+
+		header := server.Requests(dd.EndpointUserCart)[0].Header
+		expected := map[string]string{
+			"app-version":       "5.0.49.0",
+			"device-type":       "android",
+			"apptype":           "android",
+			"User-Agent":        "okhttp/4.9.0",
+			"channel":           "xiaomi",
+			"device-os-version": "15.4.1",
+		}
+		for k, v := range expected {
+			if header.Get(k) != v {
+				t.Errorf("请求头%s期望为 %s，实际为: %s", k, v, header.Get(k))
+			}
+		}
+		body := string(server.Requests(dd.EndpointUserCart)[0].Body)
+		if !strings.Contains(body, `"deviceType":"android"`) {
+			t.Errorf("购物车请求中的deviceType不正确: %s", body)
+		}
+
+		t.Log("✅ 请求头测试通过")
+	})
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestDryRun 测试演练模式
+// 验证执行到获取配送时间后只构造提交订单的参数，参数与实际提交的内容一致且不发出提交请求
+func TestDryRun(t *testing.T) {
+	t.Run("测试不提交订单", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+		session := newMockSession(t, server)
+		session.Conf.PromotionId = []string{"coupon-1"}
+
+		recorder := &engine.Recorder{}
+		e := engine.New(session, engine.Options{
+			Retry:       engine.FixedRetry(0),
+			Concurrency: 3,
+			DryRun:      true,
+			Subscribers: []engine.Subscriber{recorder},
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		order, err := e.Run(ctx)
+		if err != nil || order != nil {
+			t.Fatalf("演练模式应正常结束且不返回订单，实际为: %v %v", order, err)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 0 {
+			t.Fatalf("演练模式不应提交订单，实际提交%d次", n)
+		}
+		if n := server.Count(dd.EndpointCapacity); n == 0 {
+			t.Error("演练模式应获取配送时间")
+		}
+
+		plan := e.Plan()
+		if plan == nil {
+			t.Fatal("演练模式应返回构造的参数")
+		}
+		if len(plan.Goods) != 2 || len(plan.Payload.GoodsList) != 2 {
+			t.Errorf("期望2件有效商品，实际为: %d", len(plan.Goods))
+		}
+		if len(plan.Coupons) != 1 || plan.Coupons[0].PromotionId != "coupon-1" {
+			t.Errorf("优惠券有误: %+v", plan.Coupons)
+		}
+		if len(plan.Slots) == 0 || plan.Slots[0].Rank != 1 || plan.Payload.SettleDeliveryInfo != plan.Slots[0].DeliveryInfo() {
+			t.Errorf("应为排名第一的配送时段构造参数，实际为: %+v", plan.Payload.SettleDeliveryInfo)
+		}
+		if plan.Payload.AddressId != samsmock.MockAddressId || plan.Payload.StoreInfo.StoreId != samsmock.MockStoreId {
+			t.Errorf("提交参数中的地址或门店有误: %s %s", plan.Payload.AddressId, plan.Payload.StoreInfo.StoreId)
+		}
+		if n := len(recorder.Events("dry_run_ready")); n != 1 {
+			t.Errorf("期望1个演练完成事件，实际为: %d", n)
+		}
+		if n := len(recorder.Events("commit_attempted")); n != 0 {
+			t.Errorf("演练模式不应尝试提交，实际为: %d", n)
+		}
+
+		// 使用同一会话实际提交，请求体应与演练构造的参数一致
+		if _, err := session.CommitPay(context.Background(), plan.Payload.SettleDeliveryInfo); err != nil {
+			t.Fatalf("提交订单失败: %v", err)
+		}
+		expected, _ := json.Marshal(plan.Payload)
+		if body := server.Requests(dd.EndpointCommitPay)[0].Body; !bytes.Equal(body, expected) {
+			t.Errorf("演练构造的参数与实际提交的内容不一致:\n%s\n%s", expected, body)
+		}
+
+		t.Logf("✅ 演练模式测试通过 - %s", plan.Slots[0].ArrivalTimeStr)
+	})
+
+	t.Run("测试多楼层演练", func(t *testing.T) {
+		server, e, order, err := runMockEngine(t, multiFloorScenario(), useFloors([]dd.Floor{{FloorId: 1, DeliveryType: 2}, {FloorId: 4, DeliveryType: 2}}),
+			engine.Options{DryRun: true})
+		if err != nil || order != nil {
+			t.Fatalf("演练模式应正常结束且不返回订单，实际为: %v %v", order, err)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 0 {
+			t.Fatalf("演练模式不应提交订单，实际提交%d次", n)
+		}
+		for _, result := range e.Results() {
+			if result.Plan == nil || result.Plan.Payload.FloorId != result.Floor.FloorId {
+				t.Errorf("%s 应构造本楼层的参数，实际为: %+v", result.Floor, result)
+			}
+		}
+
+		t.Log("✅ 多楼层演练测试通过")
+	})
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+)
+
+// TestEndpointURL 测试接口地址拼接
+// 所有接口地址由 Config.BaseURL 与各接口路径拼接而成，便于指向模拟服务或调试代理
+func TestEndpointURL(t *testing.T) {
+	t.Run("测试默认接口地址", func(t *testing.T) {
+		conf := dd.Config{}
+		url := conf.EndpointURL(dd.EndpointCommitPay)
+		expected := "https://api-sams.walmartmobile.cn/api/v1/sams/trade/settlement/commitPay"
+		if url != expected {
+			t.Errorf("期望地址为 %s，实际为: %s", expected, url)
+		}
+
+		for name := range dd.DefaultEndpoints {
+			if conf.EndpointURL(name) == dd.DefaultBaseURL+"/" {
+				t.Errorf("接口 %s 缺少默认路径", name)
+			}
+		}
+
+		t.Logf("✅ 默认接口地址测试通过 - %s", url)
+	})
+
+	t.Run("测试覆盖BaseURL", func(t *testing.T) {
+		conf := dd.Config{BaseURL: "http://127.0.0.1:9090/"}
+		url := conf.EndpointURL(dd.EndpointUserCart)
+		expected := "http://127.0.0.1:9090/api/v1/sams/trade/cart/getUserCart"
+		if url != expected {
+			t.Errorf("期望地址为 %s，实际为: %s", expected, url)
+		}
+
+		t.Logf("✅ 覆盖BaseURL测试通过 - %s", url)
+	})
+
+	t.Run("测试覆盖单个接口路径", func(t *testing.T) {
+		conf := dd.Config{
+			BaseURL: "http://127.0.0.1:9090",
+			Endpoints: map[string]string{
+				dd.EndpointCapacity:  "/mirror/capacity",
+				dd.EndpointCommitPay: "https://staging.example.com/commitPay",
+			},
+		}
+
+		if url := conf.EndpointURL(dd.EndpointCapacity); url != "http://127.0.0.1:9090/mirror/capacity" {
+			t.Errorf("覆盖路径未生效: %s", url)
+		}
+		if url := conf.EndpointURL(dd.EndpointCommitPay); url != "https://staging.example.com/commitPay" {
+			t.Errorf("完整地址应直接使用: %s", url)
+		}
+		if url := conf.EndpointURL(dd.EndpointAddressList); url != "http://127.0.0.1:9090/api/v1/sams/sams-user/receiver_address/address_list" {
+			t.Errorf("未覆盖的接口应使用默认路径: %s", url)
+		}
+
+		t.Log("✅ 覆盖单个接口路径测试通过")
+	})
+}
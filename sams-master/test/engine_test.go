@@ -0,0 +1,230 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// runMockEngine 使用samsmock执行下单流程，configure不为nil时在开始前修改会话(如配置、楼层)
+func runMockEngine(t *testing.T, scenario *samsmock.Scenario, configure func(session *dd.DingdongSession), opts engine.Options) (*samsmock.Server, *engine.Engine, *dd.Order, error) {
+	server := samsmock.NewServer(scenario)
+	t.Cleanup(server.Close)
+	session := newMockSession(t, server)
+	if configure != nil {
+		configure(session)
+	}
+	if opts.Retry == nil {
+		opts.Retry = engine.FixedRetry(0)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	e := engine.New(session, opts)
+	order, err := e.Run(ctx)
+	return server, e, order, err
+}
+
+// TestEngine 测试下单流程状态机
+// 使用 samsmock 驱动完整流程，验证不同错误分类下的步骤跳转
+func TestEngine(t *testing.T) {
+	t.Run("测试完整流程下单成功", func(t *testing.T) {
+		states := make([]engine.State, 0)
+		server, _, order, err := runMockEngine(t, nil, nil, engine.Options{
+			Subscribers: []engine.Subscriber{engine.SubscriberFunc(func(ev engine.Event) {
+				if e, ok := ev.(engine.StepEntered); ok {
+					states = append(states, e.State)
+				}
+			})},
+		})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if order == nil || order.OrderNo == "" {
+			t.Fatal("订单号不能为空")
+		}
+
+		expected := []engine.State{engine.StateSaveAddress, engine.StateStores, engine.StateCart, engine.StateGoods, engine.StateSettle, engine.StateCapacity, engine.StateOrder}
+		if len(states) != len(expected) {
+			t.Fatalf("期望经过%d个步骤，实际为: %v", len(expected), states)
+		}
+		for i := range expected {
+			if states[i] != expected[i] {
+				t.Errorf("第%d步期望为 %s，实际为: %s", i+1, expected[i], states[i])
+			}
+		}
+		if server.Count(dd.EndpointCommitPay) != 1 {
+			t.Errorf("期望提交1次订单，实际为: %d", server.Count(dd.EndpointCommitPay))
+		}
+
+		t.Logf("✅ 完整流程下单成功测试通过 - 订单号: %s", order.OrderNo)
+	})
+
+	t.Run("测试高峰期场景", func(t *testing.T) {
+		sc, err := samsmock.LoadScenario("../samsmock/scenarios/busy_day.json")
+		if err != nil {
+			t.Fatalf("加载场景失败: %v", err)
+		}
+		server, _, order, err := runMockEngine(t, sc, nil, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		if n := server.Count(dd.EndpointSettleInfo); n != 3 {
+			t.Errorf("结算限流2次后成功，期望请求3次，实际为: %d", n)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 5 {
+			t.Errorf("时段约满2次、限流2次后成功，期望请求5次，实际为: %d", n)
+		}
+		if n := server.Count(dd.EndpointCapacity); n != 2 {
+			t.Errorf("时段约满时应换下一个时段而不是重新获取，期望请求2次，实际为: %d", n)
+		}
+
+		t.Logf("✅ 高峰期场景测试通过 - 订单号: %s", order.OrderNo)
+	})
+
+	t.Run("测试配送区域不匹配重新切换地址", func(t *testing.T) {
+		server, _, _, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointSettleInfo: {
+					{Response: samsmock.Response{Code: "NO_MATCH_DELIVERY_MODE", Msg: "当前区域不支持配送，请重新选择地址"}, Times: 1},
+					{},
+				},
+			},
+		}, nil, engine.Options{})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if n := server.Count(dd.EndpointSaveDeliveryAddress); n != 2 {
+			t.Errorf("期望切换地址2次，实际为: %d", n)
+		}
+
+		t.Log("✅ 配送区域不匹配重新切换地址测试通过")
+	})
+
+	t.Run("测试商品变化重新获取购物车", func(t *testing.T) {
+		server, _, _, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "CART_GOOD_CHANGE"}, Times: 1},
+					{},
+				},
+			},
+		}, nil, engine.Options{})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if n := server.Count(dd.EndpointUserCart); n != 2 {
+			t.Errorf("期望获取购物车2次，实际为: %d", n)
+		}
+		if n := server.Count(dd.EndpointStoreList); n != 1 {
+			t.Errorf("不应重新获取门店，实际请求: %d", n)
+		}
+
+		t.Log("✅ 商品变化重新获取购物车测试通过")
+	})
+
+	t.Run("测试超重减少商品", func(t *testing.T) {
+		server, _, _, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "CLOUD_GOODS_OVER_WEIGHT"}, Times: 1},
+					{},
+				},
+			},
+		}, nil, engine.Options{})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		requests := server.Requests(dd.EndpointCommitPay)
+		var first, last dd.CommitPayPram
+		json.Unmarshal(requests[0].Body, &first)
+		json.Unmarshal(requests[len(requests)-1].Body, &last)
+		count := func(p dd.CommitPayPram) int {
+			n := 0
+			for _, g := range p.GoodsList {
+				n += g.Quantity
+			}
+			return n
+		}
+		if count(last) != count(first)-1 {
+			t.Errorf("超重后应减少一件商品: %d -> %d", count(first), count(last))
+		}
+
+		t.Log("✅ 超重减少商品测试通过")
+	})
+
+	t.Run("测试登录失效停止执行", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointUserCart: {{Response: samsmock.Response{Code: "AUTH_FAIL", Msg: "登录已过期"}}},
+			},
+		}, nil, engine.Options{})
+		if order != nil || dd.ClassOf(err) != dd.ClassAuthExpired {
+			t.Fatalf("登录失效应停止执行，实际为: %v", err)
+		}
+		if n := server.Count(dd.EndpointUserCart); n != 1 {
+			t.Errorf("登录失效后不应重试，实际请求: %d", n)
+		}
+
+		t.Logf("✅ 登录失效停止执行测试通过 - %v", err)
+	})
+
+	t.Run("测试取消执行", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCapacity: {{Response: samsmock.Response{Data: json.RawMessage(`{"capcityResponseList": []}`)}}},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := engine.New(session, engine.Options{Retry: engine.FixedRetry(time.Minute)}).Run(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("期望返回超时错误，实际为: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("取消后应立即停止，实际耗时: %v", elapsed)
+		}
+
+		t.Log("✅ 取消执行测试通过")
+	})
+
+	t.Run("测试重试策略", func(t *testing.T) {
+		type call struct {
+			State   engine.State
+			Attempt int
+		}
+		calls := make([]call, 0)
+		_, _, _, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointStoreList: {
+					{Response: samsmock.Response{Code: "LIMITED"}, Times: 3},
+					{},
+				},
+			},
+		}, nil, engine.Options{
+			Retry: engine.RetryFunc(func(state engine.State, err error, attempt int) time.Duration {
+				calls = append(calls, call{state, attempt})
+				return 0
+			}),
+		})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if len(calls) != 3 || calls[2].State != engine.StateStores || calls[2].Attempt != 3 {
+			t.Errorf("重试策略调用不正确: %+v", calls)
+		}
+
+		t.Log("✅ 重试策略测试通过")
+	})
+}
@@ -0,0 +1,209 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestAPIError 测试接口错误归类
+// 接口返回的code被转换为*dd.APIError，既可按分类处理，也可以用errors.Is匹配预定义错误
+func TestAPIError(t *testing.T) {
+	t.Run("测试下单错误码归类", func(t *testing.T) {
+		cases := []struct {
+			Code     string
+			Sentinel error
+			Class    dd.ErrorClass
+		}{
+			{"LIMITED", dd.LimitedErr1, dd.ClassRetryable},
+			{"CLOUD_GOODS_OVER_WEIGHT", dd.CloudGoodsOverWightErr, dd.ClassRetryable},
+			{"OUT_OF_STOCK", dd.OOSErr, dd.ClassRefreshCart},
+			{"CART_GOOD_CHANGE", dd.CartGoodChangeErr, dd.ClassRefreshCart},
+			{"GOODS_EXCEED_LIMIT", dd.GoodsExceedLimitErr, dd.ClassRefreshCart},
+			{"PRE_GOOD_NOT_START_SELL", dd.PreGoodNotStartSellErr, dd.ClassRefreshCart},
+			{"STORE_HAS_CLOSED", dd.StoreHasClosedError, dd.ClassRefreshStore},
+			{"GET_DELIVERY_INFO_ERROR", dd.GetDeliveryInfoErr, dd.ClassRefreshStore},
+			{"CLOSE_ORDER_TIME_EXCEPTION", dd.CloseOrderTimeExceptionErr, dd.ClassSlotExhausted},
+			{"DECREASE_CAPACITY_COUNT_ERROR", dd.DecreaseCapacityCountError, dd.ClassSlotExhausted},
+			{"NOT_DELIVERY_CAPACITY_ERROR", dd.NotDeliverCapCityErr, dd.ClassSlotExhausted},
+			{"AUTH_FAIL", dd.AuthFailErr, dd.ClassAuthExpired},
+		}
+
+		steps := make([]samsmock.Step, 0)
+		for _, c := range cases {
+			steps = append(steps, samsmock.Step{Response: samsmock.Response{Code: c.Code, Msg: "模拟错误"}, Times: 1})
+		}
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{dd.EndpointCommitPay: steps},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		for _, c := range cases {
+			_, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{})
+			var apiErr *dd.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("%s 期望返回*dd.APIError，实际为: %v", c.Code, err)
+			}
+			if apiErr.Endpoint != dd.EndpointCommitPay || apiErr.Code != c.Code || apiErr.Msg != "模拟错误" {
+				t.Errorf("%s 错误信息不完整: %+v", c.Code, apiErr)
+			}
+			if !errors.Is(err, c.Sentinel) {
+				t.Errorf("%s 应匹配预定义错误: %v", c.Code, c.Sentinel)
+			}
+			if dd.ClassOf(err) != c.Class {
+				t.Errorf("%s 期望分类为 %s，实际为: %s", c.Code, c.Class, dd.ClassOf(err))
+			}
+		}
+
+		t.Logf("✅ 下单错误码归类测试通过 - 共%d种错误码", len(cases))
+	})
+
+	t.Run("测试不同接口的限流错误", func(t *testing.T) {
+		limited := []samsmock.Step{{Response: samsmock.Response{Code: "LIMITED", Msg: "服务器正忙,请稍后再试"}}}
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointUserCart:   limited,
+				dd.EndpointSettleInfo: limited,
+				dd.EndpointCapacity:   limited,
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		if err := session.CheckCart(context.Background()); !errors.Is(err, dd.LimitedErr1) {
+			t.Errorf("购物车限流应为LimitedErr1，实际为: %v", err)
+		}
+		if _, err := session.CheckSettleInfo(context.Background()); !errors.Is(err, dd.LimitedErr) {
+			t.Errorf("结算限流应为LimitedErr，实际为: %v", err)
+		}
+		if _, err := session.GetCapacity(context.Background(), samsmock.MockTemplateId); !errors.Is(err, dd.LimitedErr) || dd.ClassOf(err) != dd.ClassRetryable {
+			t.Errorf("配送时间限流应为可重试的LimitedErr，实际为: %v", err)
+		}
+
+		t.Log("✅ 不同接口的限流错误测试通过")
+	})
+
+	t.Run("测试按msg和failReason归类", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCapacity: {{Response: samsmock.Response{Code: "FAIL", Msg: dd.CapacityErr.Error()}}},
+				dd.EndpointCommitPay: {{Response: samsmock.Response{
+					Data: []byte(`{"isSuccess": false, "failReason": "当前配送时间段已约满，请重新选择配送时段"}`),
+				}}},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		if _, err := session.GetCapacity(context.Background(), samsmock.MockTemplateId); !errors.Is(err, dd.CapacityErr) || dd.ClassOf(err) != dd.ClassRefreshStore {
+			t.Errorf("获取履约时间异常应需要刷新门店，实际为: %v", err)
+		}
+
+		_, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{})
+		var apiErr *dd.APIError
+		if !errors.As(err, &apiErr) || apiErr.FailReason == "" {
+			t.Fatalf("应返回带failReason的错误，实际为: %v", err)
+		}
+		if dd.ClassOf(err) != dd.ClassSlotExhausted {
+			t.Errorf("时段约满应归类为slot_exhausted，实际为: %s", dd.ClassOf(err))
+		}
+
+		t.Logf("✅ 按msg和failReason归类测试通过 - %s", err)
+	})
+
+	t.Run("测试HTTP状态码归类", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointStoreList: {
+					{Response: samsmock.Response{Status: http.StatusServiceUnavailable, Body: "busy"}, Times: 1},
+					{Response: samsmock.Response{Status: http.StatusUnauthorized, Body: "unauthorized"}, Times: 1},
+					{Response: samsmock.Response{Status: http.StatusBadRequest, Body: "bad request"}},
+				},
+				dd.EndpointCheckGoods: {{Response: samsmock.Response{
+					Data: []byte(`{"isHasException": true, "popUpInfo": {"desc": "部分商品已缺货", "goodsList": [{"spuId": "spu-milk"}]}}`),
+				}}},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		expected := []dd.ErrorClass{dd.ClassRetryable, dd.ClassAuthExpired, dd.ClassFatal}
+		for _, class := range expected {
+			_, err := session.CheckStore(context.Background())
+			if dd.ClassOf(err) != class {
+				t.Errorf("期望分类为 %s，实际为: %s (%v)", class, dd.ClassOf(err), err)
+			}
+		}
+
+		goods, err := session.CheckGoods(context.Background())
+		if !errors.Is(err, dd.OOSErr) || dd.ClassOf(err) != dd.ClassRefreshCart || len(goods) != 1 {
+			t.Errorf("商品缺货应需要刷新购物车，实际为: %v", err)
+		}
+
+		if dd.ClassOf(errors.New("network error")) != dd.ClassRetryable {
+			t.Error("网络错误应可重试")
+		}
+
+		t.Log("✅ HTTP状态码归类测试通过")
+	})
+
+	t.Run("测试未识别错误", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {{Response: samsmock.Response{Code: "SOMETHING_NEW", Msg: "系统繁忙"}}},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		_, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{})
+		if dd.ClassOf(err) != dd.ClassUnknown {
+			t.Errorf("未识别的code应归类为unknown，实际为: %s", dd.ClassOf(err))
+		}
+		if delay := engine.DefaultRetry.Delay(engine.StateOrder, err, 1); delay <= 0 {
+			t.Errorf("未识别的错误重试前应等待，实际为: %v", delay)
+		}
+		if delay := engine.DefaultRetry.Delay(engine.StateOrder, err, 100); delay != engine.MaxUnknownDelay {
+			t.Errorf("连续失败后最多等待%v，实际为: %v", engine.MaxUnknownDelay, delay)
+		}
+
+		t.Log("✅ 未识别错误测试通过")
+	})
+	t.Run("测试本地错误", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {{Response: samsmock.Response{Code: "FAIL", Msg: dd.ErrOverBudget.Error()}}},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		_, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{})
+		if errors.Is(err, dd.ErrOverBudget) || dd.ClassOf(err) != dd.ClassUnknown {
+			t.Errorf("接口msg不应匹配本地错误，实际为: %v [%s]", err, dd.ClassOf(err))
+		}
+
+		local := []struct {
+			Err   error
+			Class dd.ErrorClass
+		}{
+			{dd.ErrOverBudget, dd.ClassFatal},
+			{dd.ErrOverWeight, dd.ClassFatal},
+			{dd.ErrMustHaveMissing, dd.ClassRefreshCart},
+		}
+		for _, c := range local {
+			if class := dd.ClassOf(fmt.Errorf("%w: 详情", c.Err)); class != c.Class {
+				t.Errorf("%v 期望分类为 %s，实际为: %s", c.Err, c.Class, class)
+			}
+		}
+
+		t.Log("✅ 本地错误测试通过")
+	})
+}
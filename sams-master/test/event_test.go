@@ -0,0 +1,103 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestEvent 测试引擎事件流
+// 通过 Recorder 记录完整流程中的事件，验证事件类型、顺序和内容
+func TestEvent(t *testing.T) {
+	t.Run("测试完整流程事件", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		_, _, order, err := runMockEngine(t, nil, nil, engine.Options{
+			Subscribers: []engine.Subscriber{recorder},
+		})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		names := make([]string, 0)
+		for _, r := range recorder.Records() {
+			if r.Name != "step_entered" && r.Name != "goods_excluded" {
+				names = append(names, r.Name)
+			}
+		}
+		expected := []string{"address_saved", "stores_discovered", "cart_loaded", "settle_checked", "slots_found", "commit_attempted", "order_placed"}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Fatalf("事件顺序不正确: %v", names)
+		}
+
+		placed := recorder.Events("order_placed")[0].(engine.OrderPlaced)
+		if placed.Order.OrderNo != order.OrderNo {
+			t.Errorf("下单事件中的订单号不正确: %s", placed.Order.OrderNo)
+		}
+		cart := recorder.Events("cart_loaded")[0].(engine.CartLoaded)
+		if len(cart.Goods) != 2 {
+			t.Errorf("期望2件有效商品，实际为: %d", len(cart.Goods))
+		}
+		excluded := recorder.Events("goods_excluded")
+		if len(excluded) != 1 || excluded[0].(engine.GoodsExcluded).Goods.SpuId != "spu-eggs" {
+			t.Errorf("无货商品应被排除: %+v", excluded)
+		}
+
+		t.Logf("✅ 完整流程事件测试通过 - 共%d个事件", len(recorder.Records()))
+	})
+
+	t.Run("测试错误分类事件", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		_, _, _, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "CART_GOOD_CHANGE"}, Times: 1},
+					{},
+				},
+			},
+		}, nil, engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		events := recorder.Events("error_classified")
+		if len(events) != 1 {
+			t.Fatalf("期望1个错误事件，实际为: %d", len(events))
+		}
+		e := events[0].(engine.ErrorClassified)
+		if e.State != engine.StateOrder || e.Class != dd.ClassRefreshCart || e.Next != engine.StateCart || e.Fatal {
+			t.Errorf("错误事件内容不正确: %+v", e)
+		}
+
+		t.Logf("✅ 错误分类事件测试通过 - %s -> %s", e.State, e.Next)
+	})
+
+	t.Run("测试命令行输出和历史记录", func(t *testing.T) {
+		var buf bytes.Buffer
+		recorder := &engine.Recorder{}
+		_, _, order, err := runMockEngine(t, nil, nil, engine.Options{
+			Subscribers: []engine.Subscriber{engine.Printer(&buf), recorder},
+		})
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		output := buf.String()
+		if !strings.Contains(output, "########## 提交订单中") || !strings.Contains(output, order.OrderNo) {
+			t.Errorf("命令行输出不完整:\n%s", output)
+		}
+
+		data, err := json.Marshal(recorder.Records())
+		if err != nil {
+			t.Fatalf("历史记录序列化失败: %v", err)
+		}
+		if !strings.Contains(string(data), `"name":"order_placed"`) {
+			t.Errorf("历史记录缺少下单事件: %s", data)
+		}
+
+		t.Log("✅ 命令行输出和历史记录测试通过")
+	})
+}
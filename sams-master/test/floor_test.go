@@ -0,0 +1,190 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+	"github.com/tidwall/gjson"
+)
+
+// multiFloorCart 普通商品(楼层1)和大件商品(楼层4)混合的购物车
+const multiFloorCart = `{
+	"floorInfoList": [
+		{
+			"floorId": 1,
+			"deliveryType": 2,
+			"amount": "99.80",
+			"quantity": 2,
+			"storeId": "6758",
+			"normalGoodsList": [
+				{"spuId": "spu-milk", "skuId": "sku-milk", "storeId": "6758", "goodsName": "全脂牛奶", "price": 4990, "quantity": 2, "stockQuantity": 20, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true}
+			]
+		},
+		{
+			"floorId": 4,
+			"deliveryType": 2,
+			"amount": "1299.00",
+			"quantity": 1,
+			"storeId": "6758",
+			"normalGoodsList": [
+				{"spuId": "spu-tv", "skuId": "sku-tv", "storeId": "6758", "goodsName": "电视机", "price": 129900, "quantity": 1, "stockQuantity": 3, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true}
+			]
+		}
+	]
+}`
+
+// multiFloorScenario 购物车为multiFloorCart的场景
+func multiFloorScenario() *samsmock.Scenario {
+	return &samsmock.Scenario{
+		Endpoints: map[string][]samsmock.Step{
+			dd.EndpointUserCart: {{Response: samsmock.Response{Data: json.RawMessage(multiFloorCart)}}},
+		},
+	}
+}
+
+// useFloors 设置本次下单的楼层，用于runMockEngine
+func useFloors(floors []dd.Floor) func(session *dd.DingdongSession) {
+	return func(session *dd.DingdongSession) {
+		session.Conf.Floors = floors
+	}
+}
+
+// TestMultiFloor 测试多楼层下单
+// 验证各楼层分别结算和提交订单、分别记录结果、单个楼层不支持配送时所有楼层一起切换地址，以及单个楼层放弃时不影响其他楼层
+func TestMultiFloor(t *testing.T) {
+	t.Run("测试解析楼层", func(t *testing.T) {
+		floors, err := dd.ParseFloors("1, 4, 2:1, 1", 2)
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		expected := []dd.Floor{{FloorId: 1, DeliveryType: 2}, {FloorId: 4, DeliveryType: 2}, {FloorId: 2, DeliveryType: 1}}
+		if len(floors) != len(expected) {
+			t.Fatalf("期望%d个楼层(重复的楼层只保留一个)，实际为: %v", len(expected), floors)
+		}
+		for i := range expected {
+			if floors[i] != expected[i] {
+				t.Errorf("第%d个楼层期望为 %v，实际为: %v", i, expected[i], floors[i])
+			}
+		}
+		for _, s := range []string{"a", "1:x", "0"} {
+			if _, err := dd.ParseFloors(s, 2); err == nil {
+				t.Errorf("%s 应解析失败", s)
+			}
+		}
+
+		t.Logf("✅ 解析楼层测试通过 - %v", floors)
+	})
+
+	t.Run("测试多楼层分别下单", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, e, order, err := runMockEngine(t, multiFloorScenario(), useFloors([]dd.Floor{{FloorId: 1, DeliveryType: 2}, {FloorId: 4, DeliveryType: 2}}),
+			engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		results := e.Results()
+		if len(results) != 2 || results[0].Order == nil || results[1].Order == nil {
+			t.Fatalf("期望两个楼层都下单成功，实际为: %+v", results)
+		}
+		if results[0].Order.OrderNo == results[1].Order.OrderNo {
+			t.Error("各楼层应分别下单")
+		}
+		if order.OrderNo != results[0].Order.OrderNo {
+			t.Errorf("Run应返回第一个下单成功的订单，实际为: %s", order.OrderNo)
+		}
+
+		floorIds := map[int64]int{}
+		for _, req := range server.Requests(dd.EndpointCommitPay) {
+			body := gjson.ParseBytes(req.Body)
+			floorIds[body.Get("floorId").Int()]++
+			if n := len(body.Get("goodsList").Array()); n != 1 {
+				t.Errorf("楼层%d应只提交本楼层的1件商品，实际为: %d", body.Get("floorId").Int(), n)
+			}
+		}
+		if floorIds[1] != 1 || floorIds[4] != 1 {
+			t.Errorf("期望楼层1和楼层4各提交一次订单，实际为: %v", floorIds)
+		}
+		checked := map[int64]string{}
+		for _, req := range server.Requests(dd.EndpointCheckGoods) {
+			body := gjson.ParseBytes(req.Body)
+			checked[body.Get("floorId").Int()] = body.Get("storeId").Str
+		}
+		if len(checked) != 2 || checked[1] != "6758" || checked[4] != "6758" {
+			t.Errorf("各楼层应按本楼层校验商品，实际为: %v", checked)
+		}
+		if n := len(recorder.Events("floor_finished")); n != 2 {
+			t.Errorf("期望2个楼层结束事件，实际为: %d", n)
+		}
+
+		t.Logf("✅ 多楼层分别下单测试通过 - %s, %s", results[0].Order.OrderNo, results[1].Order.OrderNo)
+	})
+
+	t.Run("测试单个楼层切换备选地址", func(t *testing.T) {
+		scenario := multiFloorScenario()
+		scenario.Endpoints[dd.EndpointSettleInfo] = []samsmock.Step{
+			{Response: samsmock.Response{Code: "NO_MATCH_DELIVERY_MODE", Msg: "当前区域不支持配送，请重新选择地址"}, Times: 1},
+			{},
+		}
+		recorder := &engine.Recorder{}
+		server, e, order, err := runMockEngine(t, scenario, func(session *dd.DingdongSession) {
+			session.Conf.Floors = []dd.Floor{{FloorId: 1, DeliveryType: 2}, {FloorId: 4, DeliveryType: 2}}
+			session.Conf.AddressIds = []string{samsmock.MockAddressId, "mock-address-2"}
+		}, engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		results := e.Results()
+		if results[0].Order == nil || results[1].Order == nil {
+			t.Fatalf("期望两个楼层都下单成功，实际为: %+v", results)
+		}
+
+		if n := len(recorder.Events("address_switched")); n != 1 {
+			t.Errorf("一个楼层不支持配送时应只切换一次地址，实际为: %d", n)
+		}
+		saved := server.Requests(dd.EndpointSaveDeliveryAddress)
+		if last := saved[len(saved)-1]; gjson.GetBytes(last.Body, "addressId").Str != "mock-address-2" {
+			t.Errorf("最后保存的地址应为 mock-address-2，实际为: %s", last.Body)
+		}
+		for _, req := range server.Requests(dd.EndpointCommitPay) {
+			body := gjson.ParseBytes(req.Body)
+			if body.Get("addressId").Str != "mock-address-2" {
+				t.Errorf("楼层%d应按切换后的地址提交订单，实际为: %s", body.Get("floorId").Int(), body.Get("addressId").Str)
+			}
+		}
+
+		t.Log("✅ 单个楼层切换备选地址测试通过")
+	})
+
+	t.Run("测试单个楼层放弃", func(t *testing.T) {
+		_, e, order, err := runMockEngine(t, multiFloorScenario(), useFloors([]dd.Floor{{FloorId: 2, DeliveryType: 2}, {FloorId: 1, DeliveryType: 2}}),
+			engine.Options{MaxFailures: 3})
+		if err != nil || order == nil {
+			t.Fatalf("楼层1应下单成功: %v", err)
+		}
+
+		results := e.Results()
+		if results[0].Order != nil || !errors.Is(results[0].Err, engine.ErrNoGoods) {
+			t.Errorf("购物车中没有楼层2的商品，应在累计失败后放弃，实际为: %+v", results[0])
+		}
+		if results[1].Order == nil {
+			t.Errorf("楼层1应下单成功，实际为: %+v", results[1])
+		}
+
+		t.Logf("✅ 单个楼层放弃测试通过 - %v", results[0].Err)
+	})
+
+	t.Run("测试全部楼层放弃", func(t *testing.T) {
+		_, _, order, err := runMockEngine(t, multiFloorScenario(), useFloors([]dd.Floor{{FloorId: 2, DeliveryType: 2}, {FloorId: 5, DeliveryType: 2}}),
+			engine.Options{MaxFailures: 2})
+		if order != nil || !errors.Is(err, engine.ErrNoGoods) {
+			t.Errorf("全部楼层放弃时应返回错误，实际为: %v %v", order, err)
+		}
+
+		t.Logf("✅ 全部楼层放弃测试通过 - %v", err)
+	})
+}
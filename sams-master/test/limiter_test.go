@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
+	"github.com/tidwall/gjson"
+)
+
+// TestLimiter 测试接口限流及退避
+// 验证请求间隔、LIMITED后的指数退避、成功后的恢复以及统计数据
+func TestLimiter(t *testing.T) {
+	t.Run("测试退避时长", func(t *testing.T) {
+		b := dd.Backoff{Base: 100 * time.Millisecond, Max: time.Second}
+		expected := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+		for level, d := range expected {
+			if b.Delay(level) != d {
+				t.Errorf("级别%d期望退避 %v，实际为: %v", level, d, b.Delay(level))
+			}
+		}
+
+		t.Log("✅ 退避时长测试通过")
+	})
+
+	t.Run("测试请求间隔", func(t *testing.T) {
+		intervals, err := dd.ParseIntervals("commitPay=50ms, *=0s")
+		if err != nil {
+			t.Fatalf("解析请求间隔失败: %v", err)
+		}
+		if _, err := dd.ParseIntervals("commitPay"); err == nil {
+			t.Error("格式错误时应返回错误")
+		}
+
+		l := dd.NewLimiter(intervals, dd.DefaultBackoff)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			l.Wait(context.Background(), dd.EndpointCommitPay)
+			l.Wait(context.Background(), dd.EndpointUserCart)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("3次提交订单至少间隔100ms，实际耗时: %v", elapsed)
+		}
+		stats := l.Stats()
+		if stats[dd.EndpointCommitPay].Throttled != 2 || stats[dd.EndpointUserCart].Throttled != 0 {
+			t.Errorf("等待次数不正确: %+v", stats)
+		}
+		b, _ := json.Marshal(stats[dd.EndpointCommitPay])
+		if waited := gjson.GetBytes(b, "waitedMs").Int(); waited < 90 || waited > 10000 || gjson.GetBytes(b, "waited").Exists() {
+			t.Errorf("累计等待时长应输出为毫秒数: %s", b)
+		}
+
+		t.Logf("✅ 请求间隔测试通过 - %s", stats[dd.EndpointCommitPay])
+	})
+
+	t.Run("测试限流退避及恢复", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointStoreList: {
+					{Response: samsmock.Response{Code: "LIMITED"}, Times: 3},
+					{},
+				},
+			},
+		})
+		defer server.Close()
+
+		conf := server.Config()
+		conf.Backoff = dd.Backoff{Base: 20 * time.Millisecond, Max: time.Second}
+		session := &dd.DingdongSession{StoreList: map[string]dd.Store{}}
+		if err := session.InitSession(context.Background(), conf); err != nil {
+			t.Fatalf("初始化失败: %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			if _, err := session.CheckStore(context.Background()); !dd.IsLimited(err) {
+				t.Fatalf("第%d次请求期望被限流，实际为: %v", i+1, err)
+			}
+		}
+		if level := session.Limiter.Stats()[dd.EndpointStoreList].Level; level != 3 {
+			t.Errorf("连续限流3次后退避级别应为3，实际为: %d", level)
+		}
+		if _, err := session.CheckStore(context.Background()); err != nil {
+			t.Fatalf("退避后请求失败: %v", err)
+		}
+
+		requests := server.Requests(dd.EndpointStoreList)
+		gap1 := requests[2].Time.Sub(requests[1].Time)
+		gap2 := requests[3].Time.Sub(requests[2].Time)
+		if gap1 < 30*time.Millisecond || gap2 < 60*time.Millisecond {
+			t.Errorf("退避时长应逐次翻倍，实际间隔: %v %v", gap1, gap2)
+		}
+
+		stats := session.Limiter.Stats()[dd.EndpointStoreList]
+		if stats.Requests != 4 || stats.Limited != 3 || stats.Level != 1 {
+			t.Errorf("统计数据不正确: %+v", stats)
+		}
+
+		t.Logf("✅ 限流退避及恢复测试通过 - %s", stats)
+	})
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+	"github.com/tidwall/gjson"
+)
+
+// committedSpus 提交订单请求中各商品的数量
+func committedSpus(body []byte) map[string]int {
+	spus := map[string]int{}
+	for _, g := range gjson.GetBytes(body, "goodsList").Array() {
+		spus[g.Get("spuId").Str] = int(g.Get("quantity").Int())
+	}
+	return spus
+}
+
+// TestGoodsPriority 测试商品优先级
+// 验证必需商品缺货时不下单，以及按金额上限或重量减少商品时可选商品先减少、必需商品不被减少
+func TestGoodsPriority(t *testing.T) {
+	t.Run("测试解析优先级", func(t *testing.T) {
+		priorities, err := dd.ParsePriorities("spu1:must, spu2:optional,spu3:preferred")
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if priorities.Of("spu1") != dd.PriorityMustHave || priorities.Of("spu2") != dd.PriorityOptional || priorities.Of("other") != dd.PriorityPreferred {
+			t.Errorf("优先级解析错误: %v", priorities)
+		}
+		if must := priorities.MustHave(); len(must) != 1 || must[0] != "spu1" {
+			t.Errorf("必需商品有误: %v", must)
+		}
+		for _, s := range []string{"spu1", "spu1:high", ":must"} {
+			if _, err := dd.ParsePriorities(s); err == nil {
+				t.Errorf("%s 应解析失败", s)
+			}
+		}
+
+		t.Logf("✅ 解析优先级测试通过 - %v", priorities)
+	})
+
+	t.Run("测试按优先级减少", func(t *testing.T) {
+		goodsList := []dd.Goods{
+			{SpuId: "opt", Price: 1000, Quantity: 1, Priority: dd.PriorityOptional},
+			{SpuId: "must", Price: 3000, Quantity: 1, Priority: dd.PriorityMustHave},
+			{SpuId: "pref", Price: 2000, Quantity: 1},
+		}
+		goods, _, err := dd.Budget{MaxAmount: 5000, Trim: dd.TrimMostExpensive}.Apply(goodsList)
+		if err != nil || len(goods) != 2 || goods[0].SpuId != "must" || goods[1].SpuId != "pref" {
+			t.Errorf("应先移除可选商品，实际为: %+v %v", goods, err)
+		}
+		if _, _, err := (dd.Budget{MaxAmount: 2500}).Apply(goodsList); !errors.Is(err, dd.ErrOverBudget) {
+			t.Errorf("只有减少必需商品才能满足上限时应返回错误，实际为: %v", err)
+		}
+
+		t.Log("✅ 按优先级减少测试通过")
+	})
+
+	t.Run("测试必需商品缺货不下单", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, e, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-eggs": dd.PriorityMustHave}
+		}, engine.Options{MaxFailures: 2, Subscribers: []engine.Subscriber{recorder}})
+		if order != nil || !errors.Is(err, dd.ErrMustHaveMissing) {
+			t.Fatalf("必需商品缺货时不应下单，实际为: %v %v", order, err)
+		}
+		if n := server.Count(dd.EndpointSettleInfo) + server.Count(dd.EndpointCommitPay); n != 0 {
+			t.Errorf("必需商品缺货时不应结算或提交订单，实际请求%d次", n)
+		}
+		if len(e.Session.Excluded) != 1 || e.Session.Excluded[0].SpuId != "spu-eggs" || e.Session.Excluded[0].Priority != dd.PriorityMustHave {
+			t.Errorf("未下单商品应包含必需的鸡蛋，实际为: %+v", e.Session.Excluded)
+		}
+		loaded := recorder.Events("cart_loaded")[0].(engine.CartLoaded)
+		if len(loaded.Excluded) != 1 || loaded.Excluded[0].Reason == "" {
+			t.Errorf("购物车事件应带上未下单商品及原因，实际为: %+v", loaded.Excluded)
+		}
+
+		t.Logf("✅ 必需商品缺货不下单测试通过 - %v", err)
+	})
+
+	t.Run("测试金额上限先移除可选商品", func(t *testing.T) {
+		server, e, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-milk": dd.PriorityOptional, "spu-beef": dd.PriorityMustHave}
+			session.Conf.Budget = dd.Budget{MaxAmount: 7000}
+		}, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body)
+		if len(spus) != 1 || spus["spu-beef"] != 1 {
+			t.Errorf("应移除可选的牛奶，保留必需的牛腱，实际提交: %v", spus)
+		}
+		found := false
+		for _, g := range e.Session.Excluded {
+			found = found || (g.SpuId == "spu-milk" && g.Reason == "超出金额上限")
+		}
+		if !found {
+			t.Errorf("被移除的牛奶应记录原因，实际为: %+v", e.Session.Excluded)
+		}
+
+		t.Logf("✅ 金额上限先移除可选商品测试通过 - %v", spus)
+	})
+
+	t.Run("测试超重不减少必需商品", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "CLOUD_GOODS_OVER_WEIGHT"}, Times: 1},
+					{},
+				},
+			},
+		}, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-milk": dd.PriorityMustHave}
+		}, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		requests := server.Requests(dd.EndpointCommitPay)
+		spus := committedSpus(requests[len(requests)-1].Body)
+		if spus["spu-milk"] != 2 || spus["spu-beef"] != 0 {
+			t.Errorf("超重时应减少非必需的牛腱，实际提交: %v", spus)
+		}
+
+		t.Logf("✅ 超重不减少必需商品测试通过 - %v", spus)
+	})
+}
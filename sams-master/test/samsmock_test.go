@@ -0,0 +1,218 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/samsmock"
+)
+
+func newMockSession(t *testing.T, server *samsmock.Server) *dd.DingdongSession {
+	session := &dd.DingdongSession{
+		SettleDeliveryInfo: map[int]dd.SettleDeliveryInfo{},
+		StoreList:          map[string]dd.Store{},
+	}
+	if err := session.InitSession(context.Background(), server.Config()); err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+	return session
+}
+
+// TestSamsMock 测试模拟服务
+// 使用 samsmock 离线调用dd包的全部接口
+func TestSamsMock(t *testing.T) {
+	t.Run("测试完整下单流程", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		if session.Address.AddressId != samsmock.MockAddressId {
+			t.Errorf("期望地址为 %s，实际为: %s", samsmock.MockAddressId, session.Address.AddressId)
+		}
+		if err := session.SaveDeliveryAddress(context.Background()); err != nil {
+			t.Fatalf("保存地址失败: %v", err)
+		}
+
+		stores, err := session.CheckStore(context.Background())
+		if err != nil || len(stores) == 0 {
+			t.Fatalf("获取商店失败: %v", err)
+		}
+		for _, store := range stores {
+			session.StoreList[store.StoreId] = store
+		}
+
+		if err := session.CheckCart(context.Background()); err != nil {
+			t.Fatalf("获取购物车失败: %v", err)
+		}
+		for _, v := range session.Cart.FloorInfoList {
+			if v.FloorId == session.Conf.FloorId {
+				session.FloorInfo = v
+				for _, goods := range v.NormalGoodsList {
+					session.GoodsList = append(session.GoodsList, goods.ToGoods())
+				}
+			}
+		}
+		if len(session.GoodsList) != 2 {
+			t.Fatalf("期望2个有效商品，实际为: %d", len(session.GoodsList))
+		}
+
+		if _, err := session.CheckGoods(context.Background()); err != nil {
+			t.Fatalf("校验商品失败: %v", err)
+		}
+		settleInfo, err := session.CheckSettleInfo(context.Background())
+		if err != nil {
+			t.Fatalf("获取结算信息失败: %v", err)
+		}
+		if settleInfo.SettleDelivery.StoreDeliveryTemplateId != samsmock.MockTemplateId {
+			t.Errorf("配送模板ID不正确: %s", settleInfo.SettleDelivery.StoreDeliveryTemplateId)
+		}
+
+		capacity, err := session.GetCapacity(context.Background(), session.StoreList[session.FloorInfo.StoreId].StoreDeliveryTemplateId)
+		if err != nil {
+			t.Fatalf("获取配送时间失败: %v", err)
+		}
+		var slot *dd.List
+		for _, caps := range capacity.CapCityResponseList {
+			for i, v := range caps.List {
+				if !v.TimeISFull && !v.Disabled && slot == nil {
+					slot = &caps.List[i]
+				}
+			}
+		}
+		if slot == nil {
+			t.Fatal("应该至少有一个可用时间段")
+		}
+
+		order, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{
+			ExpectArrivalTime:    slot.StartRealTime,
+			ExpectArrivalEndTime: slot.EndRealTime,
+		})
+		if err != nil {
+			t.Fatalf("提交订单失败: %v", err)
+		}
+		if order.OrderNo == "" {
+			t.Error("订单号不能为空")
+		}
+
+		requests := server.Requests(dd.EndpointCommitPay)
+		if len(requests) != 1 {
+			t.Fatalf("期望提交1次订单，实际为: %d", len(requests))
+		}
+		var payload dd.CommitPayPram
+		if err := json.Unmarshal(requests[0].Body, &payload); err != nil {
+			t.Fatalf("订单请求解析失败: %v", err)
+		}
+		if payload.AddressId != samsmock.MockAddressId || len(payload.GoodsList) != 2 {
+			t.Errorf("订单请求数据不正确: %+v", payload)
+		}
+		if requests[0].Header.Get("auth-token") != "mock-token" {
+			t.Error("请求头缺少auth-token")
+		}
+
+		t.Logf("✅ 完整下单流程测试通过 - 订单号: %s", order.OrderNo)
+	})
+
+	t.Run("测试按次数切换响应", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "LIMITED", Msg: "当前购物火爆，请稍后再试"}, Times: 3},
+					{Response: samsmock.Response{Code: "Success"}},
+				},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		for i := 0; i < 3; i++ {
+			if _, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{}); !errors.Is(err, dd.LimitedErr1) {
+				t.Errorf("第%d次期望限流错误，实际为: %v", i+1, err)
+			}
+		}
+		if _, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{}); err != nil {
+			t.Errorf("第4次期望成功，实际为: %v", err)
+		}
+
+		t.Log("✅ 按次数切换响应测试通过")
+	})
+
+	t.Run("测试按时间切换响应", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCapacity: {
+					{Response: samsmock.Response{Data: json.RawMessage(`{"capcityResponseList": []}`)}, Until: samsmock.Duration(100 * time.Millisecond)},
+					{},
+				},
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		capacity, err := session.GetCapacity(context.Background(), samsmock.MockTemplateId)
+		if err != nil || len(capacity.CapCityResponseList) != 0 {
+			t.Fatalf("期望暂无配送时段: %v", err)
+		}
+		time.Sleep(150 * time.Millisecond)
+		capacity, err = session.GetCapacity(context.Background(), samsmock.MockTemplateId)
+		if err != nil || len(capacity.CapCityResponseList) == 0 {
+			t.Fatalf("期望放出配送时段: %v", err)
+		}
+
+		t.Log("✅ 按时间切换响应测试通过")
+	})
+
+	t.Run("测试覆盖接口路径", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{
+			Paths: map[string]string{
+				dd.EndpointUserCart:  "/mirror/cart",
+				dd.EndpointCommitPay: "https://staging.example.com/v2/commitPay",
+			},
+		})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		if err := session.CheckCart(context.Background()); err != nil {
+			t.Fatalf("按覆盖路径获取购物车失败: %v", err)
+		}
+		if _, err := session.CommitPay(context.Background(), dd.SettleDeliveryInfo{}); err != nil {
+			t.Fatalf("按完整地址的路径提交订单失败: %v", err)
+		}
+		if server.Count(dd.EndpointUserCart) != 1 || server.Count(dd.EndpointCommitPay) != 1 {
+			t.Errorf("请求应按覆盖后的路径记录到对应接口")
+		}
+		resp, err := http.Post(server.URL+dd.DefaultEndpoints[dd.EndpointUserCart], "application/json", nil)
+		if err != nil {
+			t.Fatalf("请求默认路径失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("覆盖后默认路径应返回404，实际为: %d", resp.StatusCode)
+		}
+
+		t.Log("✅ 覆盖接口路径测试通过")
+	})
+
+	t.Run("测试加载场景文件", func(t *testing.T) {
+		for _, name := range []string{"limited_then_success", "slots_after_5s", "busy_day"} {
+			sc, err := samsmock.LoadScenario("../samsmock/scenarios/" + name + ".json")
+			if err != nil {
+				t.Fatalf("加载场景 %s 失败: %v", name, err)
+			}
+			if sc.Name == "" || len(sc.Endpoints) == 0 {
+				t.Errorf("场景 %s 内容为空", name)
+			}
+			for endpoint := range sc.Endpoints {
+				if _, ok := dd.DefaultEndpoints[endpoint]; !ok {
+					t.Errorf("场景 %s 包含未知接口: %s", name, endpoint)
+				}
+			}
+		}
+
+		t.Log("✅ 加载场景文件测试通过")
+	})
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestSchedule 测试定时开抢
+// 验证开抢时间解析、根据Date头估算服务器时间偏差以及按服务器时间等待
+func TestSchedule(t *testing.T) {
+	t.Run("测试开抢时间解析", func(t *testing.T) {
+		now := time.Date(2022, 4, 20, 7, 0, 0, 0, dd.Shanghai)
+		tests := []struct {
+			Input    string
+			Expected time.Time
+		}{
+			{"08:00", time.Date(2022, 4, 20, 8, 0, 0, 0, dd.Shanghai)},
+			{"06:00", time.Date(2022, 4, 21, 6, 0, 0, 0, dd.Shanghai)},
+			{"06:00:30", time.Date(2022, 4, 21, 6, 0, 30, 0, dd.Shanghai)},
+			{"2022-04-20 06:00:00", time.Date(2022, 4, 20, 6, 0, 0, 0, dd.Shanghai)},
+			{"2022-04-22 08:00", time.Date(2022, 4, 22, 8, 0, 0, 0, dd.Shanghai)},
+			{"2022-04-20T06:00:00Z", time.Date(2022, 4, 20, 14, 0, 0, 0, dd.Shanghai)},
+		}
+		for _, tt := range tests {
+			at, err := engine.ParseStartAt(tt.Input, now)
+			if err != nil || !at.Equal(tt.Expected) {
+				t.Errorf("%s: 期望为 %v，实际为: %v %v", tt.Input, tt.Expected, at, err)
+			}
+		}
+		if _, err := engine.ParseStartAt("6点", now); err == nil {
+			t.Error("格式错误时应返回错误")
+		}
+
+		t.Log("✅ 开抢时间解析测试通过")
+	})
+
+	t.Run("测试服务器时间偏差", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{ClockOffset: samsmock.Duration(time.Hour)})
+		defer server.Close()
+		session := newMockSession(t, server)
+		for i := 0; i < 3; i++ {
+			session.CheckStore(context.Background())
+		}
+
+		offset := session.Clock.Offset()
+		if offset < time.Hour-time.Second || offset > time.Hour+time.Second {
+			t.Errorf("期望偏差约1小时，实际为: %v", offset)
+		}
+		if session.Clock.Samples() != 4 {
+			t.Errorf("期望4个样本，实际为: %d", session.Clock.Samples())
+		}
+
+		t.Logf("✅ 服务器时间偏差测试通过 - %v", offset)
+	})
+
+	t.Run("测试按服务器时间开抢", func(t *testing.T) {
+		server := samsmock.NewServer(&samsmock.Scenario{ClockOffset: samsmock.Duration(time.Hour)})
+		defer server.Close()
+		session := newMockSession(t, server)
+
+		recorder := &engine.Recorder{}
+		startAt := time.Now().Add(time.Hour + 1500*time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := engine.New(session, engine.Options{
+			StartAt:     startAt,
+			LeadTime:    time.Second,
+			Retry:       engine.FixedRetry(0),
+			Subscribers: []engine.Subscriber{recorder},
+		}).Run(ctx)
+		if err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		waits := recorder.Events("schedule_waiting")
+		if len(waits) != 2 || waits[0].(engine.ScheduleWaiting).Phase != engine.PhasePrepare || waits[1].(engine.ScheduleWaiting).Phase != engine.PhaseStart {
+			t.Fatalf("期望先等待准备再等待开抢，实际为: %+v", waits)
+		}
+
+		// Date头精确到秒，允许0.6秒误差
+		local := startAt.Add(-time.Hour)
+		settle := server.Requests(dd.EndpointSettleInfo)[0].Time
+		capacity := server.Requests(dd.EndpointCapacity)[0].Time
+		if settle.Before(local.Add(-time.Second - 600*time.Millisecond)) {
+			t.Errorf("准备步骤执行过早: 提前 %v", local.Sub(settle))
+		}
+		if capacity.Before(local.Add(-600 * time.Millisecond)) {
+			t.Errorf("开抢前不应获取配送时间: 提前 %v", local.Sub(capacity))
+		}
+		if !settle.Before(capacity) {
+			t.Error("结算应在开抢前完成")
+		}
+
+		t.Logf("✅ 按服务器时间开抢测试通过 - 结算提前 %v，获取配送时间偏差 %v", local.Sub(settle).Round(time.Millisecond), capacity.Sub(local).Round(time.Millisecond))
+	})
+}
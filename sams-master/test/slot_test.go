@@ -0,0 +1,176 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// newSlot 生成指定日期、开始时间和时长的配送时段
+func newSlot(date string, hour, hours int) dd.Slot {
+	day, _ := time.ParseInLocation("2006-01-02", date, dd.Shanghai)
+	start := day.Add(time.Duration(hour) * time.Hour)
+	return dd.Slot{
+		ArrivalTimeStr: start.Format("2006-01-02 15:04"),
+		Start:          start,
+		End:            start.Add(time.Duration(hours) * time.Hour),
+	}
+}
+
+func rankedNames(slots []dd.Slot) []string {
+	names := make([]string, 0)
+	for _, slot := range slots {
+		if slot.Rank > 0 {
+			names = append(names, slot.ArrivalTimeStr)
+		}
+	}
+	return names
+}
+
+// TestSlotPolicy 测试配送时段偏好
+// 验证时段解析、排序以及按星期、时间窗口、日期和最短提前时间过滤
+func TestSlotPolicy(t *testing.T) {
+	// 2022-04-20 为周三
+	now := time.Date(2022, 4, 20, 8, 0, 0, 0, dd.Shanghai)
+	slots := []dd.Slot{
+		newSlot("2022-04-21", 18, 3),
+		newSlot("2022-04-20", 9, 3),
+		newSlot("2022-04-23", 9, 3),
+		newSlot("2022-04-20", 14, 4),
+	}
+
+	t.Run("测试时段解析", func(t *testing.T) {
+		slot, err := dd.ParseSlot("04月20日", dd.List{
+			StartTime:     "09:00",
+			EndTime:       "12:00",
+			StartRealTime: "1650416400000",
+			EndRealTime:   "1650427200000",
+		})
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if !slot.Start.Equal(time.Date(2022, 4, 20, 9, 0, 0, 0, dd.Shanghai)) {
+			t.Errorf("开始时间解析错误: %v", slot.Start)
+		}
+		info := slot.DeliveryInfo()
+		if info.ExpectArrivalTime != "1650416400000" || info.ExpectArrivalEndTime != "1650427200000" {
+			t.Errorf("提交的配送时间应与原始时间戳一致: %+v", info)
+		}
+		if _, err := dd.ParseSlot("04月20日", dd.List{StartRealTime: "abc"}); err == nil {
+			t.Error("时间戳有误时应返回错误")
+		}
+
+		t.Logf("✅ 时段解析测试通过 - %s", slot.ArrivalTimeStr)
+	})
+
+	t.Run("测试最早和最晚优先", func(t *testing.T) {
+		earliest := rankedNames(dd.SlotPolicy{}.Rank(slots, now))
+		expected := []string{"2022-04-20 09:00", "2022-04-20 14:00", "2022-04-21 18:00", "2022-04-23 09:00"}
+		for i := range expected {
+			if earliest[i] != expected[i] {
+				t.Fatalf("最早优先排序错误: %v", earliest)
+			}
+		}
+
+		latest := rankedNames(dd.SlotPolicy{Order: dd.SlotLatest}.Rank(slots, now))
+		if latest[0] != "2022-04-23 09:00" || latest[3] != "2022-04-20 09:00" {
+			t.Errorf("最晚优先排序错误: %v", latest)
+		}
+
+		t.Logf("✅ 排序测试通过 - %v", earliest)
+	})
+
+	t.Run("测试过滤条件", func(t *testing.T) {
+		full := newSlot("2022-04-20", 18, 3)
+		full.Full = true
+
+		testCases := []struct {
+			name     string
+			policy   dd.SlotPolicy
+			slot     dd.Slot
+			excluded bool
+		}{
+			{"已约满", dd.SlotPolicy{}, full, true},
+			{"工作日允许周三", dd.SlotPolicy{Weekdays: []time.Weekday{time.Monday, time.Wednesday}}, slots[1], false},
+			{"工作日排除周六", dd.SlotPolicy{Weekdays: []time.Weekday{time.Monday, time.Wednesday}}, slots[2], true},
+			{"时间窗口内", dd.SlotPolicy{Hours: []dd.HourWindow{{From: 9, To: 12}}}, slots[1], false},
+			{"超出时间窗口", dd.SlotPolicy{Hours: []dd.HourWindow{{From: 9, To: 12}}}, slots[3], true},
+			{"排除日期", dd.SlotPolicy{ExcludeDates: []string{"2022-04-21"}}, slots[0], true},
+			{"满足最短提前", dd.SlotPolicy{MinLead: time.Hour}, slots[1], false},
+			{"不足最短提前", dd.SlotPolicy{MinLead: 2 * time.Hour}, slots[1], true},
+		}
+		for _, tc := range testCases {
+			reason := tc.policy.Check(tc.slot, now)
+			if (reason != "") != tc.excluded {
+				t.Errorf("%s: 期望排除=%v，实际原因: %q", tc.name, tc.excluded, reason)
+			}
+		}
+
+		ranked := dd.SlotPolicy{ExcludeDates: []string{"2022-04-20"}}.Rank(slots, now)
+		if ranked[0].Rank != 1 || ranked[1].Rank != 2 || ranked[2].Rank != 0 || ranked[2].Excluded == "" {
+			t.Errorf("被排除的时段应排在最后且不编号: %+v", ranked)
+		}
+
+		t.Log("✅ 过滤条件测试通过")
+	})
+
+	t.Run("测试解析偏好参数", func(t *testing.T) {
+		days, err := dd.ParseWeekdays("1-3,7")
+		if err != nil || len(days) != 4 || days[3] != time.Sunday {
+			t.Errorf("星期解析错误: %v %v", days, err)
+		}
+		hours, err := dd.ParseHourWindows("9-12, 18-21")
+		if err != nil || len(hours) != 2 || hours[1].From != 18 {
+			t.Errorf("时间窗口解析错误: %v %v", hours, err)
+		}
+		for _, s := range []string{"0", "5-8"} {
+			if _, err := dd.ParseWeekdays(s); err == nil {
+				t.Errorf("%s 应解析失败", s)
+			}
+		}
+		for _, s := range []string{"9", "12-9", "20-25"} {
+			if _, err := dd.ParseHourWindows(s); err == nil {
+				t.Errorf("%s 应解析失败", s)
+			}
+		}
+		if _, err := dd.ParseDates("2022-4-20"); err == nil {
+			t.Error("日期格式有误时应解析失败")
+		}
+
+		t.Log("✅ 解析偏好参数测试通过")
+	})
+
+	t.Run("测试按排序提交订单", func(t *testing.T) {
+		server := samsmock.NewServer(nil)
+		defer server.Close()
+		session := newMockSession(t, server)
+		session.Conf.SlotPolicy = dd.SlotPolicy{Order: dd.SlotLatest}
+
+		recorder := &engine.Recorder{}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := engine.New(session, engine.Options{
+			Retry:       engine.FixedRetry(0),
+			Subscribers: []engine.Subscriber{recorder},
+		}).Run(ctx); err != nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		found := recorder.Events("slots_found")[0].(engine.SlotsFound)
+		attempted := recorder.Events("commit_attempted")[0].(engine.CommitAttempted)
+		if found.Slots[0].Rank != 1 || attempted.Slot.ArrivalTimeStr != found.Slots[0].ArrivalTimeStr {
+			t.Errorf("应首先提交排名第一的时段 %s，实际为: %s", found.Slots[0].ArrivalTimeStr, attempted.Slot.ArrivalTimeStr)
+		}
+		for _, slot := range found.Slots[1:] {
+			if slot.Rank > 0 && slot.Start.After(found.Slots[0].Start) {
+				t.Errorf("最晚优先时 %s 不应排在 %s 之后", slot.ArrivalTimeStr, found.Slots[0].ArrivalTimeStr)
+			}
+		}
+
+		t.Logf("✅ 按排序提交订单测试通过 - %s", attempted.Slot.ArrivalTimeStr)
+	})
+}
@@ -0,0 +1,178 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// shortageCart 矿泉水想买6件只剩1件、大米想买4件只剩3件的购物车
+const shortageCart = `{
+	"floorInfoList": [
+		{
+			"floorId": 1,
+			"deliveryType": 2,
+			"amount": "277.70",
+			"quantity": 12,
+			"storeId": "6758",
+			"normalGoodsList": [
+				{"spuId": "spu-milk", "skuId": "sku-milk", "storeId": "6758", "goodsName": "全脂牛奶", "price": 4990, "quantity": 2, "stockQuantity": 20, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true}
+			],
+			"shortageStockGoodsList": [
+				{"spuId": "spu-water", "skuId": "sku-water", "storeId": "6758", "goodsName": "矿泉水 24瓶", "price": 3990, "quantity": 6, "stockQuantity": 1, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true},
+				{"spuId": "spu-rice", "skuId": "sku-rice", "storeId": "6758", "goodsName": "东北大米 5kg", "price": 5990, "quantity": 4, "stockQuantity": 3, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true}
+			]
+		}
+	]
+}`
+
+// TestPartialStock 测试库存不足时的处理方式及按SPU配置的最少数量
+// 验证可购买数量少于最少数量的商品不下单并记录原因，以及必需商品按最少数量判断是否缺货
+func TestPartialStock(t *testing.T) {
+	run := func(t *testing.T, configure func(session *dd.DingdongSession)) (*samsmock.Server, *engine.Engine, *dd.Order, error) {
+		return runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointUserCart: {{Response: samsmock.Response{Data: json.RawMessage(shortageCart)}}},
+			},
+		}, configure, engine.Options{MaxFailures: 2})
+	}
+	excluded := func(session *dd.DingdongSession) map[string]string {
+		reasons := map[string]string{}
+		for _, g := range session.Excluded {
+			reasons[g.SpuId] = g.Reason
+		}
+		return reasons
+	}
+
+	t.Run("测试解析配置", func(t *testing.T) {
+		for s, want := range map[string]dd.PartialStock{
+			"":          {},
+			"accept":    {},
+			"full":      {Mode: dd.PartialFull},
+			"atleast:3": {Mode: dd.PartialAtLeast, AtLeast: 3},
+		} {
+			if policy, err := dd.ParsePartialStock(s); err != nil || policy != want {
+				t.Errorf("%q 解析错误: %+v %v", s, policy, err)
+			}
+		}
+		for _, s := range []string{"all", "atleast:0", "atleast:x"} {
+			if _, err := dd.ParsePartialStock(s); err == nil {
+				t.Errorf("%s 应解析失败", s)
+			}
+		}
+		quantities, err := dd.ParseMinQuantities("spu1:6, spu2:2")
+		if err != nil || quantities["spu1"] != 6 || quantities["spu2"] != 2 {
+			t.Errorf("最少数量解析错误: %v %v", quantities, err)
+		}
+		for _, s := range []string{"spu1", "spu1:0", ":2"} {
+			if _, err := dd.ParseMinQuantities(s); err == nil {
+				t.Errorf("%s 应解析失败", s)
+			}
+		}
+
+		t.Log("✅ 解析配置测试通过")
+	})
+
+	t.Run("测试最少数量", func(t *testing.T) {
+		goods := dd.NormalGoods{SpuId: "spu1", Quantity: 6}
+		for _, c := range []struct {
+			conf dd.Config
+			want int
+		}{
+			{dd.Config{}, 1},
+			{dd.Config{PartialStock: dd.PartialStock{Mode: dd.PartialFull}}, 6},
+			{dd.Config{PartialStock: dd.PartialStock{Mode: dd.PartialAtLeast, AtLeast: 4}}, 4},
+			{dd.Config{PartialStock: dd.PartialStock{Mode: dd.PartialAtLeast, AtLeast: 10}}, 6},
+			{dd.Config{Priorities: dd.Priorities{"spu1": dd.PriorityMustHave}}, 6},
+			{dd.Config{Priorities: dd.Priorities{"spu1": dd.PriorityMustHave}, MinQuantities: map[string]int{"spu1": 2}}, 2},
+			{dd.Config{PartialStock: dd.PartialStock{Mode: dd.PartialFull}, MinQuantities: map[string]int{"spu1": 8}}, 6},
+		} {
+			if n := c.conf.MinQuantity(goods); n != c.want {
+				t.Errorf("%+v 最少数量应为%d，实际为: %d", c.conf, c.want, n)
+			}
+		}
+
+		t.Log("✅ 最少数量测试通过")
+	})
+
+	t.Run("测试接受可购买的数量", func(t *testing.T) {
+		server, _, order, err := run(t, nil)
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body)
+		if spus["spu-milk"] != 2 || spus["spu-water"] != 1 || spus["spu-rice"] != 3 {
+			t.Errorf("默认应按可购买数量下单，实际提交: %v", spus)
+		}
+
+		t.Logf("✅ 接受可购买的数量测试通过 - %v", spus)
+	})
+
+	t.Run("测试要求全部数量", func(t *testing.T) {
+		server, e, order, err := run(t, func(session *dd.DingdongSession) {
+			session.Conf.PartialStock = dd.PartialStock{Mode: dd.PartialFull}
+		})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body)
+		if len(spus) != 1 || spus["spu-milk"] != 2 {
+			t.Errorf("只应下单库存充足的牛奶，实际提交: %v", spus)
+		}
+		reasons := excluded(e.Session)
+		if !strings.Contains(reasons["spu-water"], "可购买1件，少于最少6件") || !strings.Contains(reasons["spu-rice"], "可购买3件，少于最少4件") {
+			t.Errorf("库存不足的商品应记录原因，实际为: %v", reasons)
+		}
+
+		t.Logf("✅ 要求全部数量测试通过 - %v", reasons)
+	})
+
+	t.Run("测试至少N件及按SPU配置", func(t *testing.T) {
+		server, e, order, err := run(t, func(session *dd.DingdongSession) {
+			session.Conf.PartialStock = dd.PartialStock{Mode: dd.PartialAtLeast, AtLeast: 2}
+			session.Conf.MinQuantities = map[string]int{"spu-rice": 4}
+		})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body)
+		if len(spus) != 1 || spus["spu-milk"] != 2 {
+			t.Errorf("矿泉水少于2件、大米少于配置的4件，只应下单牛奶，实际提交: %v", spus)
+		}
+		if reasons := excluded(e.Session); len(reasons) != 2 {
+			t.Errorf("应记录2件未下单的商品，实际为: %v", reasons)
+		}
+
+		t.Logf("✅ 至少N件及按SPU配置测试通过 - %v", spus)
+	})
+
+	t.Run("测试必需商品数量不足", func(t *testing.T) {
+		server, _, order, err := run(t, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-water": dd.PriorityMustHave}
+		})
+		if order != nil || !errors.Is(err, dd.ErrMustHaveMissing) || !strings.Contains(err.Error(), "矿泉水") {
+			t.Fatalf("必需商品数量不足时不应下单，实际为: %v %v", order, err)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 0 {
+			t.Errorf("不应提交订单，实际请求%d次", n)
+		}
+
+		server, _, order, err = run(t, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-water": dd.PriorityMustHave}
+			session.Conf.MinQuantities = map[string]int{"spu-water": 1}
+		})
+		if err != nil || order == nil {
+			t.Fatalf("必需商品满足配置的最少数量时应下单: %v", err)
+		}
+		if spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body); spus["spu-water"] != 1 {
+			t.Errorf("应下单1件矿泉水，实际提交: %v", spus)
+		}
+
+		t.Logf("✅ 必需商品数量不足测试通过")
+	})
+}
@@ -0,0 +1,246 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+	"github.com/tidwall/gjson"
+)
+
+// TestSubstitution 测试缺货商品的替代规则
+// 验证按顺序将第一个有货的替代商品加入购物车、购物车中已有时不再加入、演练模式不修改购物车、按数量映射下单、商品校验缺货时替换、原商品补货后不再替换，以及下单结果和bark通知中的替换记录
+func TestSubstitution(t *testing.T) {
+	t.Run("测试解析替代规则", func(t *testing.T) {
+		substitutions, err := dd.ParseSubstitutions("spuA:spuB*2|spuC, spuX:spuY")
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		alts := substitutions["spuA"]
+		if len(alts) != 2 || alts[0] != (dd.Alternative{SpuId: "spuB", Ratio: 2}) || alts[1] != (dd.Alternative{SpuId: "spuC", Ratio: 1}) {
+			t.Errorf("替代商品解析错误: %+v", alts)
+		}
+		if alts[0].Quantity(3) != 6 || len(substitutions["spuX"]) != 1 {
+			t.Errorf("数量映射或规则数量有误: %+v", substitutions)
+		}
+		for _, s := range []string{"spuA", "spuA:", "spuA:spuB*0", "spuA:spuA"} {
+			if _, err := dd.ParseSubstitutions(s); err == nil {
+				t.Errorf("%s 应解析失败", s)
+			}
+		}
+
+		t.Logf("✅ 解析替代规则测试通过 - %+v", substitutions)
+	})
+
+	t.Run("测试缺货时加购第一个有货的替代商品", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, e, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.Substitutions = dd.Substitutions{"spu-eggs": {{SpuId: "spu-eggs-brown", Ratio: 1}, {SpuId: "spu-eggs-free", Ratio: 2}}}
+		}, engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+
+		added := make([]string, 0)
+		for _, r := range server.Requests(dd.EndpointAddCartGoods) {
+			added = append(added, gjson.GetBytes(r.Body, "cartGoodsInfoList.0.spuId").Str)
+		}
+		if len(added) != 2 || added[0] != "spu-eggs-brown" || added[1] != "spu-eggs-free" {
+			t.Errorf("应先加购无货的褐壳鸡蛋，再加购散养鸡蛋，实际为: %v", added)
+		}
+		spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body)
+		if spus["spu-eggs-free"] != 2 || spus["spu-milk"] != 2 || spus["spu-beef"] != 1 || len(spus) != 3 {
+			t.Errorf("应按数量映射下单2件散养鸡蛋，实际提交: %v", spus)
+		}
+
+		placed := recorder.Events("order_placed")[0].(engine.OrderPlaced)
+		if len(placed.Substitutions) != 1 || placed.Substitutions[0].Substitute != "spu-eggs-free" || placed.Substitutions[0].SubstituteQuantity != 2 {
+			t.Errorf("下单结果应包含替换记录，实际为: %+v", placed.Substitutions)
+		}
+		if _, message := engine.Describe(placed); !strings.Contains(message, "替换商品: 可生食鸡蛋 30枚 x1 → 散养鸡蛋 10枚 x2") {
+			t.Errorf("下单结果描述应包含替换商品，实际为: %s", message)
+		}
+		found := false
+		for _, g := range e.Session.Excluded {
+			found = found || (g.SpuId == "spu-eggs" && strings.Contains(g.Reason, "已替换为散养鸡蛋"))
+		}
+		if !found {
+			t.Errorf("缺货的鸡蛋应记录替换原因，实际为: %+v", e.Session.Excluded)
+		}
+
+		t.Logf("✅ 缺货时加购替代商品测试通过 - %s", placed.Substitutions[0])
+	})
+
+	t.Run("测试替换必需商品", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-eggs": dd.PriorityMustHave, "spu-eggs-free": dd.PriorityOptional}
+			session.Conf.Substitutions = dd.Substitutions{"spu-eggs": {{SpuId: "spu-eggs-free", Ratio: 1}}}
+			session.Conf.Budget = dd.Budget{MaxAmount: 10000}
+		}, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("必需商品有替代商品时应下单: %v", err)
+		}
+		spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body)
+		if spus["spu-eggs-free"] != 1 {
+			t.Errorf("替代商品继承必需优先级，不应因金额上限被减少，实际提交: %v", spus)
+		}
+
+		t.Logf("✅ 替换必需商品测试通过 - %v", spus)
+	})
+
+	t.Run("测试商品校验缺货时替换", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCheckGoods: {
+					{Response: samsmock.Response{Data: json.RawMessage(`{"isHasException": true, "popUpInfo": {"desc": "部分商品已售完", "goodsList": [{"spuId": "spu-milk", "goodsName": "全脂牛奶", "quantity": 2}]}}`)}, Times: 1},
+					{},
+				},
+			},
+		}, func(session *dd.DingdongSession) {
+			session.Conf.Substitutions = dd.Substitutions{"spu-milk": {{SpuId: "spu-eggs-free", Ratio: 1}}}
+		}, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		requests := server.Requests(dd.EndpointCommitPay)
+		spus := committedSpus(requests[len(requests)-1].Body)
+		if spus["spu-milk"] != 0 || spus["spu-eggs-free"] != 2 || spus["spu-beef"] != 1 {
+			t.Errorf("校验未通过的牛奶应替换为2件散养鸡蛋，实际提交: %v", spus)
+		}
+
+		t.Logf("✅ 商品校验缺货时替换测试通过 - %v", spus)
+	})
+
+	t.Run("测试原商品补货后不再替换", func(t *testing.T) {
+		server, e, order, err := runMockEngine(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCheckGoods: {
+					{Response: samsmock.Response{Data: json.RawMessage(`{"isHasException": true, "popUpInfo": {"desc": "部分商品已售完", "goodsList": [{"spuId": "spu-milk", "goodsName": "全脂牛奶", "quantity": 2}]}}`)}, Times: 1},
+					{},
+				},
+				dd.EndpointCommitPay: {
+					{Response: samsmock.Response{Code: "CART_GOOD_CHANGE", Msg: "购物车商品发生变化"}, Times: 1},
+					{},
+				},
+			},
+		}, func(session *dd.DingdongSession) {
+			session.Conf.Substitutions = dd.Substitutions{"spu-milk": {{SpuId: "spu-eggs-free", Ratio: 1}}}
+		}, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		requests := server.Requests(dd.EndpointCommitPay)
+		if spus := committedSpus(requests[0].Body); spus["spu-milk"] != 0 || spus["spu-eggs-free"] != 2 {
+			t.Errorf("第一次提交应使用替代商品，实际提交: %v", spus)
+		}
+		spus := committedSpus(requests[len(requests)-1].Body)
+		if spus["spu-milk"] != 2 || spus["spu-eggs-free"] != 0 {
+			t.Errorf("刷新购物车后牛奶有货，应下单牛奶，实际提交: %v", spus)
+		}
+		if len(e.Session.Substitutions) != 0 {
+			t.Errorf("不应有替换记录，实际为: %+v", e.Session.Substitutions)
+		}
+
+		t.Logf("✅ 原商品补货后不再替换测试通过 - %v", spus)
+	})
+
+	t.Run("测试替换记录的bark通知", func(t *testing.T) {
+		paths := make(chan string, 1)
+		session := &dd.DingdongSession{Conf: dd.Config{BarkId: "bark-key"}}
+		session.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			paths <- req.URL.Path
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		})}
+		var pushErr error
+		notifier := engine.BarkNotifier(context.Background(), session, func(err error) { pushErr = err })
+		notifier.Handle(engine.OrderPlaced{
+			Order:         &dd.Order{OrderNo: "mock-order"},
+			Substitutions: []dd.Substitution{{GoodsName: "全脂牛奶", Quantity: 2, SubstituteName: "100%纯牛奶/低脂", SubstituteQuantity: 2}},
+		})
+		if pushErr != nil {
+			t.Fatalf("推送失败: %v", pushErr)
+		}
+		path := <-paths
+		if !strings.HasPrefix(path, "/bark-key/") || !strings.Contains(path, "100%纯牛奶/低脂") {
+			t.Errorf("通知中的替代商品名称应完整保留，实际路径: %s", path)
+		}
+
+		t.Logf("✅ 替换记录的bark通知测试通过 - %s", path)
+	})
+
+	t.Run("测试替代商品已在购物车中", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.Substitutions = dd.Substitutions{"spu-eggs": {{SpuId: "spu-eggs-free", Ratio: 2}}}
+			//之前的流程已将替代商品加入购物车
+			if err := session.CheckCart(context.Background()); err != nil {
+				t.Fatalf("获取购物车失败: %v", err)
+			}
+			if _, err := session.AddCartGoods(context.Background(), dd.CartGoods{SpuId: "spu-eggs-free", IncreaseQuantity: 2, IsSelected: true}); err != nil {
+				t.Fatalf("加购失败: %v", err)
+			}
+		}, engine.Options{})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if n := server.Count(dd.EndpointAddCartGoods); n != 1 {
+			t.Errorf("购物车中已有足够的替代商品，不应再次加购，实际请求%d次", n)
+		}
+		if spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body); spus["spu-eggs-free"] != 2 {
+			t.Errorf("应下单购物车中的2件散养鸡蛋，实际提交: %v", spus)
+		}
+
+		t.Log("✅ 替代商品已在购物车中测试通过")
+	})
+
+	t.Run("测试演练模式不修改购物车", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, e, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-eggs": dd.PriorityMustHave}
+			session.Conf.Substitutions = dd.Substitutions{"spu-eggs": {{SpuId: "spu-eggs-free", Ratio: 2}}}
+		}, engine.Options{DryRun: true, Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order != nil || e.Plan() == nil {
+			t.Fatalf("演练模式应构造提交参数且不返回订单，实际为: %v %v", order, err)
+		}
+		if n := server.Count(dd.EndpointAddCartGoods); n != 0 {
+			t.Errorf("演练模式不应加购替代商品，实际请求%d次", n)
+		}
+		planned := recorder.Events("dry_run_substitute")
+		if len(planned) != 1 || planned[0].(engine.DryRunSubstitute).Substitution.Substitute != "spu-eggs-free" || planned[0].(engine.DryRunSubstitute).Quantity != 2 {
+			t.Errorf("应报告计划的替换，实际为: %+v", planned)
+		}
+
+		t.Logf("✅ 演练模式不修改购物车测试通过 - %+v", planned)
+	})
+
+	t.Run("测试替代商品均无货", func(t *testing.T) {
+		server, e, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-eggs": dd.PriorityMustHave}
+			session.Conf.Substitutions = dd.Substitutions{"spu-eggs": {{SpuId: "spu-eggs-brown", Ratio: 1}}}
+		}, engine.Options{MaxFailures: 2})
+		if order != nil || !errors.Is(err, dd.ErrMustHaveMissing) {
+			t.Fatalf("替代商品无货时必需商品仍缺货，实际为: %v %v", order, err)
+		}
+		if n := server.Count(dd.EndpointAddCartGoods); n != 1 {
+			t.Errorf("每个替代商品只应加购一次，实际请求%d次", n)
+		}
+		if len(e.Session.Substitutions) != 0 {
+			t.Errorf("不应有替换记录，实际为: %+v", e.Session.Substitutions)
+		}
+
+		t.Logf("✅ 替代商品均无货测试通过 - %v", err)
+	})
+}
+
+// roundTripFunc 用函数拦截http请求
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// eggsBackCart 鸡蛋重新有货的购物车
+const eggsBackCart = `{
+	"floorInfoList": [
+		{
+			"floorId": 1,
+			"deliveryType": 2,
+			"amount": "227.50",
+			"quantity": 4,
+			"storeId": "6758",
+			"normalGoodsList": [
+				{"spuId": "spu-milk", "skuId": "sku-milk", "storeId": "6758", "goodsName": "全脂牛奶", "price": 4990, "quantity": 2, "stockQuantity": 20, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true},
+				{"spuId": "spu-beef", "skuId": "sku-beef", "storeId": "6758", "goodsName": "澳洲牛腱", "price": 6790, "quantity": 1, "stockQuantity": 5, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true},
+				{"spuId": "spu-eggs", "skuId": "sku-eggs", "storeId": "6758", "goodsName": "可生食鸡蛋 30枚", "price": 5980, "quantity": 1, "stockQuantity": 8, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true}
+			]
+		}
+	]
+}`
+
+// twoFloorCart 鸡蛋同时在普通商品和大件商品楼层，floor1Stock为普通商品楼层的库存
+func twoFloorCart(floor1Stock int) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{
+	"floorInfoList": [
+		{
+			"floorId": 1,
+			"deliveryType": 2,
+			"storeId": "6758",
+			"normalGoodsList": [
+				{"spuId": "spu-eggs", "skuId": "sku-eggs", "storeId": "6758", "goodsName": "可生食鸡蛋 30枚", "price": 5980, "quantity": 1, "stockQuantity": %d, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true}
+			]
+		},
+		{
+			"floorId": 4,
+			"deliveryType": 2,
+			"storeId": "6758",
+			"normalGoodsList": [
+				{"spuId": "spu-eggs", "skuId": "sku-eggs", "storeId": "6758", "goodsName": "可生食鸡蛋 30枚", "price": 5980, "quantity": 1, "stockQuantity": 6, "stockStatus": true, "isPutOnSale": true, "isAvailable": true, "isSelected": true}
+			]
+		}
+	]
+}`, floor1Stock))
+}
+
+// TestWatchStock 测试关注库存模式
+// 验证先保存收货地址、商品到货和售罄时发布带数量和价格的事件且不下单、同一商品在各楼层分别比较，必需商品到货后转入下单流程，以及登录失效时停止
+func TestWatchStock(t *testing.T) {
+	// 鸡蛋第2次获取购物车时到货，第3次起售罄
+	scenario := func() *samsmock.Scenario {
+		return &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointUserCart: {
+					{Times: 1},
+					{Response: samsmock.Response{Data: json.RawMessage(eggsBackCart)}, Times: 1},
+					{},
+				},
+			},
+		}
+	}
+	watch := func(t *testing.T, scenario *samsmock.Scenario, conf func(c *dd.Config), opts engine.WatchOptions, stop func(ev engine.Event) bool) (*samsmock.Server, *engine.Engine, *engine.Recorder, error) {
+		server := samsmock.NewServer(scenario)
+		t.Cleanup(server.Close)
+		session := newMockSession(t, server)
+		conf(&session.Conf)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		recorder := &engine.Recorder{}
+		e := engine.New(session, engine.Options{
+			Retry: engine.FixedRetry(0),
+			Sleep: func(ctx context.Context, d time.Duration) error { return ctx.Err() },
+			Subscribers: []engine.Subscriber{recorder, engine.SubscriberFunc(func(ev engine.Event) {
+				if stop != nil && stop(ev) {
+					cancel()
+				}
+			})},
+		})
+		opts.Interval = time.Millisecond
+		err := e.Watch(ctx, opts)
+		return server, e, recorder, err
+	}
+
+	t.Run("测试到货和售罄通知", func(t *testing.T) {
+		server, _, recorder, err := watch(t, scenario(), func(c *dd.Config) {}, engine.WatchOptions{Spus: []string{"spu-eggs"}}, func(ev engine.Event) bool {
+			return ev.EventName() == "out_of_stock"
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("未开启handoff时应一直关注直到取消，实际为: %v", err)
+		}
+
+		watched := recorder.Events("stock_watched")
+		if len(watched) != 1 || len(watched[0].(engine.StockWatched).Goods) != 1 {
+			t.Fatalf("应只关注鸡蛋，实际为: %+v", watched)
+		}
+		back := recorder.Events("back_in_stock")
+		if len(back) != 1 {
+			t.Fatalf("应发布1次到货事件，实际为: %d", len(back))
+		}
+		goods := back[0].(engine.BackInStock).Goods
+		if goods.SpuId != "spu-eggs" || goods.Available != 1 || goods.Stock != 8 || goods.Price != 5980 {
+			t.Errorf("到货事件的数量或价格有误: %+v", goods)
+		}
+		if _, message := engine.Describe(back[0]); !strings.Contains(message, "可购买1件(库存8) 单价59.80元") {
+			t.Errorf("到货描述有误: %s", message)
+		}
+		if n := len(recorder.Events("out_of_stock")); n != 1 {
+			t.Errorf("应发布1次售罄事件，实际为: %d", n)
+		}
+		if n := server.Count(dd.EndpointSaveDeliveryAddress); n != 1 {
+			t.Errorf("获取购物车前应保存1次收货地址，实际请求%d次", n)
+		}
+		if first, cart := server.Requests(dd.EndpointSaveDeliveryAddress)[0].Time, server.Requests(dd.EndpointUserCart)[0].Time; first.After(cart) {
+			t.Error("应在获取购物车前保存收货地址")
+		}
+		for _, endpoint := range []string{dd.EndpointSettleInfo, dd.EndpointCommitPay} {
+			if n := server.Count(endpoint); n != 0 {
+				t.Errorf("关注库存时不应请求%s，实际请求%d次", endpoint, n)
+			}
+		}
+
+		t.Logf("✅ 到货和售罄通知测试通过 - %s", goods.GoodsName)
+	})
+
+	t.Run("测试必需商品到货后停止关注", func(t *testing.T) {
+		server, _, recorder, err := watch(t, scenario(), func(c *dd.Config) {
+			c.Priorities = dd.Priorities{"spu-eggs": dd.PriorityMustHave}
+		}, engine.WatchOptions{Handoff: true}, nil)
+		if err != nil {
+			t.Fatalf("必需商品到货后应返回nil，实际为: %v", err)
+		}
+		if n := len(recorder.Events("back_in_stock")); n != 1 {
+			t.Errorf("应发布1次到货事件，实际为: %d", n)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 0 {
+			t.Errorf("关注库存时不应提交订单，实际请求%d次", n)
+		}
+
+		t.Log("✅ 必需商品到货后停止关注测试通过")
+	})
+
+	t.Run("测试按楼层比较库存", func(t *testing.T) {
+		server, _, recorder, err := watch(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointUserCart: {
+					{Response: samsmock.Response{Data: twoFloorCart(0)}, Times: 1},
+					{Response: samsmock.Response{Data: twoFloorCart(8)}},
+				},
+			},
+		}, func(c *dd.Config) {
+			c.Priorities = dd.Priorities{"spu-eggs": dd.PriorityMustHave}
+		}, engine.WatchOptions{Spus: []string{"spu-eggs"}, Handoff: true}, nil)
+		if err != nil {
+			t.Fatalf("普通商品楼层的鸡蛋到货后应返回nil，实际为: %v", err)
+		}
+		if n := server.Count(dd.EndpointUserCart); n != 2 {
+			t.Errorf("只有大件商品楼层有货时不应开始下单，实际获取购物车%d次", n)
+		}
+		watched := recorder.Events("stock_watched")
+		if len(watched) != 1 || len(watched[0].(engine.StockWatched).Goods) != 2 {
+			t.Fatalf("应分别关注两个楼层的鸡蛋，实际为: %+v", watched)
+		}
+		back := recorder.Events("back_in_stock")
+		if len(back) != 1 || back[0].(engine.BackInStock).Goods.Floor != (dd.Floor{FloorId: 1, DeliveryType: 2}) {
+			t.Fatalf("应只发布普通商品楼层的到货事件，实际为: %+v", back)
+		}
+		if n := len(recorder.Events("out_of_stock")); n != 0 {
+			t.Errorf("不应发布售罄事件，实际为: %d", n)
+		}
+
+		t.Logf("✅ 按楼层比较库存测试通过 - %s", back[0].(engine.BackInStock).Goods.Floor)
+	})
+
+	t.Run("测试转入下单流程", func(t *testing.T) {
+		server, e, _, err := watch(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointUserCart: {
+					{Times: 1},
+					{Response: samsmock.Response{Data: json.RawMessage(eggsBackCart)}},
+				},
+			},
+		}, func(c *dd.Config) {
+			c.Priorities = dd.Priorities{"spu-eggs": dd.PriorityMustHave}
+		}, engine.WatchOptions{Handoff: true}, nil)
+		if err != nil {
+			t.Fatalf("关注库存失败: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		order, err := e.Run(ctx)
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		if spus := committedSpus(server.Requests(dd.EndpointCommitPay)[0].Body); spus["spu-eggs"] != 1 {
+			t.Errorf("应下单到货的鸡蛋，实际提交: %v", spus)
+		}
+
+		t.Logf("✅ 转入下单流程测试通过 - 订单号 %s", order.OrderNo)
+	})
+
+	t.Run("测试登录失效时停止", func(t *testing.T) {
+		_, _, recorder, err := watch(t, &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointUserCart: {{Response: samsmock.Response{Code: "AUTH_FAIL", Msg: "登录已过期"}}},
+			},
+		}, func(c *dd.Config) {}, engine.WatchOptions{}, nil)
+		if dd.ClassOf(err) != dd.ClassAuthExpired {
+			t.Fatalf("登录失效时应返回错误，实际为: %v", err)
+		}
+		if n := len(recorder.Events("stock_watched")); n != 0 {
+			t.Errorf("获取购物车失败时不应发布关注事件，实际为: %d", n)
+		}
+
+		t.Logf("✅ 登录失效时停止测试通过 - %v", err)
+	})
+}
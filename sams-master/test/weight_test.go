@@ -0,0 +1,207 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robGoods/sams/dd"
+	"github.com/robGoods/sams/engine"
+	"github.com/robGoods/sams/samsmock"
+)
+
+// TestWeightLimit 测试提交订单前按限重减少商品
+// 验证按优先级一次性减少商品、放回减少过多的商品、保留最少数量，只剩必需商品仍超重时停止，
+// 同一优先级先减少较重的商品，以及提交订单时服务器一直提示超重时每次减少最重的一件商品、无法减少时停止
+func TestWeightLimit(t *testing.T) {
+	quantities := func(goods []dd.Goods) map[string]int {
+		m := map[string]int{}
+		for _, g := range goods {
+			m[g.SpuId] = g.Quantity
+		}
+		return m
+	}
+
+	t.Run("测试限重配置", func(t *testing.T) {
+		if limit := (dd.Config{DeliveryType: 1}).WeightLimit(); limit != dd.ExpressWeightLimit {
+			t.Errorf("急速达默认限重应为%.0fkg，实际为: %v", dd.ExpressWeightLimit, limit)
+		}
+		if limit := (dd.Config{DeliveryType: 2}).WeightLimit(); limit != 0 {
+			t.Errorf("全城配送默认不限重，实际为: %v", limit)
+		}
+		if limit := (dd.Config{DeliveryType: 2, MaxWeight: 20}).WeightLimit(); limit != 20 {
+			t.Errorf("应使用配置的限重，实际为: %v", limit)
+		}
+
+		t.Log("✅ 限重配置测试通过")
+	})
+
+	t.Run("测试按优先级减少", func(t *testing.T) {
+		goodsList := []dd.Goods{
+			{SpuId: "a", Weight: 3, Quantity: 1, Priority: dd.PriorityOptional},
+			{SpuId: "b", Weight: 5, Quantity: 2},
+			{SpuId: "c", Weight: 0.5, Quantity: 4},
+			{SpuId: "d", Weight: 10, Quantity: 1, Priority: dd.PriorityMustHave},
+		}
+		goods, trims, err := dd.ReduceWeight(goodsList, 19)
+		if err != nil {
+			t.Fatalf("减少商品失败: %v", err)
+		}
+		q := quantities(goods)
+		if q["a"] != 0 || q["b"] != 1 || q["c"] != 4 || q["d"] != 1 {
+			t.Errorf("应先移除可选商品，再减少最重的优先商品，实际为: %v", q)
+		}
+		if len(trims) != 2 || dd.GoodsWeight(goods) > 19 {
+			t.Errorf("调整记录或重量有误: %+v %.1f", trims, dd.GoodsWeight(goods))
+		}
+
+		goods, _, _ = dd.ReduceWeight(goodsList, 100)
+		if len(goods) != 4 {
+			t.Errorf("未超重时不应减少商品，实际为: %v", quantities(goods))
+		}
+
+		t.Logf("✅ 按优先级减少测试通过 - %.1fkg", dd.GoodsWeight(goods))
+	})
+
+	t.Run("测试同一优先级先减少较重的商品", func(t *testing.T) {
+		goods, trims, err := dd.ReduceWeight([]dd.Goods{
+			{SpuId: "salt", Weight: 0.5, Quantity: 4},
+			{SpuId: "rice", Weight: 10, Quantity: 1},
+			{SpuId: "milk", Weight: 1, Quantity: 2},
+			{SpuId: "juice", Weight: 1.5, Quantity: 2},
+		}, 10)
+		if err != nil {
+			t.Fatalf("减少商品失败: %v", err)
+		}
+		q := quantities(goods)
+		if q["rice"] != 0 || q["salt"] != 4 || q["milk"] != 2 || q["juice"] != 2 || len(trims) != 1 {
+			t.Errorf("只移除最重的大米即可满足限重，不应减少多件较轻的商品，实际为: %v", q)
+		}
+
+		t.Logf("✅ 同一优先级先减少较重的商品测试通过 - %.1fkg", dd.GoodsWeight(goods))
+	})
+
+	t.Run("测试放回减少过多的商品", func(t *testing.T) {
+		goods, trims, err := dd.ReduceWeight([]dd.Goods{
+			{SpuId: "light", Weight: 0.2, Quantity: 1},
+			{SpuId: "heavy", Weight: 8, Quantity: 1},
+			{SpuId: "other", Weight: 20, Quantity: 1, Priority: dd.PriorityMustHave},
+		}, 24)
+		if err != nil {
+			t.Fatalf("减少商品失败: %v", err)
+		}
+		q := quantities(goods)
+		if q["light"] != 1 || q["heavy"] != 0 || len(trims) != 1 {
+			t.Errorf("只移除较重的商品即可满足限重，应放回较轻的商品，实际为: %v", q)
+		}
+
+		t.Log("✅ 放回减少过多的商品测试通过")
+	})
+
+	t.Run("测试最少数量", func(t *testing.T) {
+		goodsList := []dd.Goods{{SpuId: "water", Weight: 1, Quantity: 5, MinQuantity: 3}}
+		goods, _, _ := dd.ReduceWeight(goodsList, 4)
+		if q := quantities(goods); q["water"] != 4 {
+			t.Errorf("应只减少1件，实际为: %v", q)
+		}
+		goods, trims, err := dd.ReduceWeight(append(goodsList, dd.Goods{SpuId: "rice", Weight: 2, Quantity: 1, Priority: dd.PriorityMustHave}), 4)
+		if q := quantities(goods); err != nil || q["water"] != 0 || q["rice"] != 1 || trims[0].Quantity != 0 {
+			t.Errorf("少于最少数量时应移除该商品，实际为: %v %v", q, err)
+		}
+
+		t.Log("✅ 最少数量测试通过")
+	})
+
+	t.Run("测试必需商品超重", func(t *testing.T) {
+		_, _, err := dd.ReduceWeight([]dd.Goods{
+			{SpuId: "a", Weight: 1, Quantity: 3},
+			{SpuId: "b", Weight: 16, Quantity: 2, Priority: dd.PriorityMustHave},
+		}, dd.ExpressWeightLimit)
+		if !errors.Is(err, dd.ErrOverWeight) {
+			t.Errorf("只剩必需商品仍超重时应返回错误，实际为: %v", err)
+		}
+
+		t.Logf("✅ 必需商品超重测试通过 - %v", err)
+	})
+
+	t.Run("测试提交订单前减少商品", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, _, order, err := runMockEngine(t, nil, func(session *dd.DingdongSession) {
+			session.Conf.MaxWeight = 4.5
+		}, engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if err != nil || order == nil {
+			t.Fatalf("下单失败: %v", err)
+		}
+		requests := server.Requests(dd.EndpointCommitPay)
+		if len(requests) != 1 {
+			t.Fatalf("提交订单前已减少商品，应一次提交成功，实际提交%d次", len(requests))
+		}
+		if spus := committedSpus(requests[0].Body); spus["spu-milk"] != 1 || spus["spu-beef"] != 1 {
+			t.Errorf("应只减少一件较重的牛奶即可满足限重，实际提交: %v", spus)
+		}
+
+		reduced, attempted := -1, -1
+		for i, record := range recorder.Records() {
+			switch record.Name {
+			case "weight_reduced":
+				reduced = i
+			case "commit_attempted":
+				if attempted < 0 {
+					attempted = i
+				}
+			}
+		}
+		if reduced < 0 || reduced > attempted {
+			t.Errorf("应在第一次提交订单前报告减少的商品，事件顺序: %d %d", reduced, attempted)
+		}
+
+		t.Log("✅ 提交订单前减少商品测试通过")
+	})
+
+	overWeight := func() *samsmock.Scenario {
+		return &samsmock.Scenario{
+			Endpoints: map[string][]samsmock.Step{
+				dd.EndpointCommitPay: {{Response: samsmock.Response{Code: "CLOUD_GOODS_OVER_WEIGHT"}}},
+			},
+		}
+	}
+
+	t.Run("测试提交时必需商品一直超重", func(t *testing.T) {
+		server, _, order, err := runMockEngine(t, overWeight(), func(session *dd.DingdongSession) {
+			session.Conf.Priorities = dd.Priorities{"spu-milk": dd.PriorityMustHave, "spu-beef": dd.PriorityMustHave}
+		}, engine.Options{})
+		if order != nil || !errors.Is(err, dd.ErrOverWeight) || dd.ClassOf(err) != dd.ClassFatal {
+			t.Fatalf("没有可减少的商品时应停止，实际为: %v", err)
+		}
+		if n := server.Count(dd.EndpointCommitPay); n != 1 {
+			t.Errorf("无法减少商品时不应重复提交，实际提交%d次", n)
+		}
+
+		t.Logf("✅ 提交时必需商品一直超重测试通过 - %v", err)
+	})
+
+	t.Run("测试提交时一直超重", func(t *testing.T) {
+		recorder := &engine.Recorder{}
+		server, _, order, err := runMockEngine(t, overWeight(), func(session *dd.DingdongSession) {
+			session.Conf.MinQuantities = map[string]int{"spu-milk": 2}
+		}, engine.Options{Subscribers: []engine.Subscriber{recorder}})
+		if order != nil || !errors.Is(err, dd.ErrOverWeight) {
+			t.Fatalf("减少到没有商品时应停止，实际为: %v", err)
+		}
+		requests := server.Requests(dd.EndpointCommitPay)
+		if len(requests) != 2 {
+			t.Fatalf("牛奶不能少于最少数量，应先移除较重的牛奶再提交，之后移除牛腱，期望提交2次，实际为: %d", len(requests))
+		}
+		if spus := committedSpus(requests[0].Body); spus["spu-milk"] != 2 || spus["spu-beef"] != 1 {
+			t.Errorf("第1次提交的商品有误: %v", spus)
+		}
+		if spus := committedSpus(requests[1].Body); len(spus) != 1 || spus["spu-beef"] != 1 {
+			t.Errorf("第2次提交应只移除牛奶，实际为: %v", spus)
+		}
+		reduced := recorder.Events("weight_reduced")
+		if len(reduced) != 2 || !reduced[0].(engine.WeightReduced).Server {
+			t.Errorf("应报告提交时减少的商品，实际为: %+v", reduced)
+		}
+
+		t.Logf("✅ 提交时一直超重测试通过 - %v", err)
+	})
+}
@@ -2,6 +2,14 @@
 let ws = null;
 let reconnectTimer = null;
 
+// 当前账号会话，不同会话的配置、运行状态和日志互不影响
+let sessionId = localStorage.getItem('sessionId') || 'default';
+
+// 当前会话的接口地址
+function sessionApi(action) {
+    return `/api/sessions/${encodeURIComponent(sessionId)}/${action}`;
+}
+
 // 状态管理
 const state = {
     isRunning: false,
@@ -9,6 +17,7 @@ const state = {
     address: null,
     stores: [],
     goodsList: [],
+    excludedGoods: [],
     timeSlots: [],
     order: null
 };
@@ -18,18 +27,23 @@ const stepMap = {
     'idle': { title: '等待开始', desc: '配置参数后点击开始', icon: '⏸️' },
     'configured': { title: '配置完成', desc: '参数已保存', icon: '✅' },
     'starting': { title: '正在启动', desc: '初始化中...', icon: '🚀' },
+    'waiting_prepare': { title: '等待准备', desc: '等待开始执行准备步骤...', icon: '⏳' },
+    'waiting_start': { title: '等待开抢', desc: '准备完成，等待开抢时间...', icon: '⏳' },
     'saving_address': { title: '保存地址', desc: '正在保存配送地址...', icon: '📍' },
     'address_saved': { title: '地址已保存', desc: '配送地址设置成功', icon: '✅' },
+    'address_switched': { title: '切换备选地址', desc: '当前地址不支持配送，已切换到下一个备选地址', icon: '🔀' },
     'checking_stores': { title: '查找商店', desc: '正在查找可用门店...', icon: '🏪' },
     'stores_loaded': { title: '商店已加载', desc: '已找到可用门店', icon: '✅' },
     'checking_cart': { title: '检查购物车', desc: '正在获取购物车商品...', icon: '🛒' },
     'cart_loaded': { title: '购物车已加载', desc: '已获取购物车商品', icon: '✅' },
     'checking_goods': { title: '校验商品', desc: '正在校验商品状态...', icon: '🔍' },
+    'checking_settle': { title: '获取结算信息', desc: '正在计算运费...', icon: '💰' },
     'settle_checked': { title: '结算信息', desc: '正在计算运费...', icon: '💰' },
     'checking_capacity': { title: '获取配送时间', desc: '正在查询可用时间段...', icon: '⏰' },
     'capacity_loaded': { title: '配送时间已获取', desc: '已找到可用时间段', icon: '✅' },
     'submitting_order': { title: '提交订单', desc: '正在提交订单...', icon: '📦' },
     'order_success': { title: '订单成功', desc: '抢购成功！', icon: '🎉' },
+    'dry_run_ready': { title: '演练完成', desc: '已生成提交订单参数，未提交订单', icon: '📝' },
     'stopped': { title: '已停止', desc: '程序已停止', icon: '⏹️' }
 };
 
@@ -43,7 +57,7 @@ document.addEventListener('DOMContentLoaded', () => {
 // 初始化WebSocket
 function initWebSocket() {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = `${protocol}//${window.location.host}/ws`;
+    const wsUrl = `${protocol}//${window.location.host}/ws?session=${encodeURIComponent(sessionId)}`;
     
     ws = new WebSocket(wsUrl);
 
@@ -75,6 +89,9 @@ function handleWebSocketMessage(data) {
     if (data.type === 'ping') {
         return;
     }
+    if (data.sessionId && data.sessionId !== sessionId) {
+        return;
+    }
 
     // 日志消息
     if (data.time && data.level && data.message) {
@@ -89,6 +106,13 @@ function handleWebSocketMessage(data) {
 
 // 初始化事件监听
 function initEventListeners() {
+    // 切换账号会话
+    const sessionInput = document.getElementById('sessionId');
+    sessionInput.value = sessionId;
+    sessionInput.addEventListener('change', () => {
+        switchSession(sessionInput.value.trim() || 'default');
+    });
+
     // 配置表单提交
     document.getElementById('configForm').addEventListener('submit', async (e) => {
         e.preventDefault();
@@ -111,12 +135,55 @@ function initEventListeners() {
     });
 }
 
+// 切换账号会话，重新连接WebSocket并加载该会话的状态
+function switchSession(id) {
+    if (id === sessionId) {
+        return;
+    }
+    sessionId = id;
+    localStorage.setItem('sessionId', id);
+    document.getElementById('logContainer').innerHTML = '';
+    if (reconnectTimer) {
+        clearTimeout(reconnectTimer);
+    }
+    if (ws) {
+        ws.onclose = null;
+        ws.close();
+    }
+    initWebSocket();
+    state.isRunning = false;
+    state.address = null;
+    updateUI();
+    loadStatus();
+}
+
 // 保存配置
 async function saveConfig() {
     const formData = new FormData(document.getElementById('configForm'));
     const config = {
         authToken: formData.get('authToken'),
         addressId: formData.get('addressId') || '',
+        addressKeyword: formData.get('addressKeyword') || '',
+        addressIds: formData.get('addressIds') || '',
+        startAt: formData.get('startAt') || '',
+        leadTime: formData.get('leadTime') || '',
+        concurrency: parseInt(formData.get('concurrency')) || 0,
+        stagger: formData.get('stagger') || '',
+        slotOrder: formData.get('slotOrder') || '',
+        slotWeekdays: formData.get('slotWeekdays') || '',
+        slotHours: formData.get('slotHours') || '',
+        excludeDates: formData.get('excludeDates') || '',
+        minLead: formData.get('minLead') || '',
+        capacityDays: parseInt(formData.get('capacityDays')) || 0,
+        floors: formData.get('floors') || '',
+        maxFailures: parseInt(formData.get('maxFailures')) || 0,
+        maxAmount: parseInt(formData.get('maxAmount')) || 0,
+        trimPolicy: formData.get('trimPolicy') || '',
+        priorities: formData.get('priorities') || '',
+        maxWeight: parseFloat(formData.get('maxWeight')) || 0,
+        minQuantity: formData.get('minQuantity') || '',
+        partialStock: formData.get('partialStock') || '',
+        substitutions: formData.get('substitutions') || '',
         deliveryType: parseInt(formData.get('deliveryType')) || 2,
         payMethod: parseInt(formData.get('payMethod')) || 1,
         floorId: parseInt(formData.get('floorId')) || 1,
@@ -126,13 +193,14 @@ async function saveConfig() {
         promotionId: formData.get('promotionId') || '',
         deliveryFee: formData.get('deliveryFee') === 'on',
         isSelected: formData.get('isSelected') === 'on',
+        dryRun: formData.get('dryRun') === 'on',
         deviceId: '',
         trackInfo: '',
         storeConf: ''
     };
 
     try {
-        const response = await fetch('/api/config', {
+        const response = await fetch(sessionApi('config'), {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json'
@@ -145,13 +213,15 @@ async function saveConfig() {
         if (result.success) {
             addLog('success', '配置保存成功');
             if (result.data && result.data.selectedAddress) {
+                state.address = result.data.selectedAddress;
                 displayAddress(result.data.selectedAddress);
+                document.getElementById('startBtn').disabled = false;
+            } else if (result.data && result.data.addressList) {
+                // 未匹配到地址，显示地址列表供选择
+                state.address = null;
+                displayAddressList(result.data.addressList);
+                document.getElementById('startBtn').disabled = true;
             }
-            if (result.data && result.data.addressList) {
-                // 可以显示地址列表供选择
-                console.log('地址列表:', result.data.addressList);
-            }
-            document.getElementById('startBtn').disabled = false;
         } else {
             addLog('error', '配置保存失败: ' + result.message);
             alert('配置失败: ' + result.message);
@@ -165,7 +235,7 @@ async function saveConfig() {
 // 开始流程
 async function startProcess() {
     try {
-        const response = await fetch('/api/start', {
+        const response = await fetch(sessionApi('start'), {
             method: 'POST'
         });
 
@@ -188,7 +258,7 @@ async function startProcess() {
 // 停止流程
 async function stopProcess() {
     try {
-        const response = await fetch('/api/stop', {
+        const response = await fetch(sessionApi('stop'), {
             method: 'POST'
         });
 
@@ -209,7 +279,7 @@ async function stopProcess() {
 // 加载状态
 async function loadStatus() {
     try {
-        const response = await fetch('/api/status');
+        const response = await fetch(sessionApi('status'));
         const result = await response.json();
         
         if (result.success && result.data) {
@@ -235,9 +305,10 @@ function updateStatus(data) {
     if (data.stores) {
         state.stores = data.stores;
     }
-    if (data.goodsList) {
-        state.goodsList = data.goodsList;
-        displayGoods(data.goodsList);
+    if (data.goodsList || data.excludedGoods) {
+        state.goodsList = data.goodsList || [];
+        state.excludedGoods = data.excludedGoods || [];
+        displayGoods(state.goodsList, state.excludedGoods);
     }
     if (data.timeSlots) {
         state.timeSlots = data.timeSlots;
@@ -245,7 +316,7 @@ function updateStatus(data) {
     }
     if (data.order) {
         state.order = data.order;
-        displayOrder(data.order);
+        displayOrder(data.order, data.substitutions);
     }
     if (data.error) {
         addLog('error', data.error);
@@ -312,18 +383,59 @@ function displayAddress(address) {
     `;
 }
 
+// 显示地址列表供选择
+function displayAddressList(addressList) {
+    const panel = document.getElementById('addressPanel');
+    const info = document.getElementById('addressInfo');
+
+    panel.style.display = 'block';
+    info.innerHTML = addressList.map(address => `
+        <div class="address-info">
+            <div class="address-line"><strong>${escapeHtml(address.name)}</strong> ${escapeHtml(address.mobile)}</div>
+            <div class="address-line">${escapeHtml(address.districtName)} ${escapeHtml(address.receiverAddress)} ${escapeHtml(address.detailAddress)}</div>
+            <button class="btn btn-small" onclick="selectAddress('${escapeHtml(address.addressId)}')">选择此地址</button>
+        </div>
+    `).join('');
+}
+
+// 选择收货地址
+async function selectAddress(addressId) {
+    try {
+        const response = await fetch(sessionApi('addresses/select'), {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ addressId: addressId })
+        });
+
+        const result = await response.json();
+
+        if (result.success) {
+            state.address = result.data.selectedAddress;
+            displayAddress(result.data.selectedAddress);
+            updateUI();
+        } else {
+            addLog('error', '选择地址失败: ' + result.message);
+        }
+    } catch (error) {
+        addLog('error', '请求失败: ' + error.message);
+    }
+}
+
 // 显示商品列表
-function displayGoods(goodsList) {
-    if (!goodsList || goodsList.length === 0) {
+function displayGoods(goodsList, excludedGoods = []) {
+    if ((!goodsList || goodsList.length === 0) && excludedGoods.length === 0) {
         document.getElementById('goodsPanel').style.display = 'none';
         return;
     }
 
     const panel = document.getElementById('goodsPanel');
     const list = document.getElementById('goodsList');
+    const priorityNames = { must: '必需', preferred: '优先', optional: '可选' };
     
     panel.style.display = 'block';
-    list.innerHTML = goodsList.map(goods => `
+    list.innerHTML = (goodsList || []).map(goods => `
         <div class="goods-item">
             <div class="goods-name">${goods.goodsName || '未知商品'}</div>
             <div class="goods-info">
@@ -332,6 +444,18 @@ function displayGoods(goodsList) {
                 <span>总价: ¥${(goods.price * goods.quantity / 100).toFixed(2)}</span>
             </div>
         </div>
+    `).join('') + excludedGoods.map(goods => `
+        <div class="goods-item excluded ${goods.priority === 'must' ? 'must-have' : ''}">
+            <div>
+                <div class="goods-name">${goods.goodsName || goods.spuId}</div>
+                <div class="goods-reason">未下单: ${goods.reason}</div>
+            </div>
+            <div class="goods-info">
+                <span>${priorityNames[goods.priority] || ''}</span>
+                <span>数量: ${goods.quantity}</span>
+                <span>单价: ¥${(goods.price / 100).toFixed(2)}</span>
+            </div>
+        </div>
     `).join('');
 }
 
@@ -347,14 +471,15 @@ function displayTimeSlots(timeSlots) {
     
     panel.style.display = 'block';
     list.innerHTML = timeSlots.map(slot => `
-        <div class="time-slot">
-            <div class="time-slot-text">${slot.arrivalTimeStr}</div>
+        <div class="time-slot ${slot.rank > 0 ? '' : 'excluded'}">
+            <div class="time-slot-text">${slot.rank > 0 ? '[' + slot.rank + '] ' : ''}${slot.arrivalTimeStr}</div>
+            ${slot.excluded ? `<div class="time-slot-reason">${slot.excluded}</div>` : ''}
         </div>
     `).join('');
 }
 
 // 显示订单信息
-function displayOrder(order) {
+function displayOrder(order, substitutions = []) {
     if (!order) {
         document.getElementById('orderPanel').style.display = 'none';
         return;
@@ -370,6 +495,9 @@ function displayOrder(order) {
             <div class="order-detail"><strong>订单号:</strong> ${order.orderNo}</div>
             <div class="order-detail"><strong>支付金额:</strong> ¥${order.payAmount}</div>
             <div class="order-detail"><strong>支付方式:</strong> ${order.channel === 'wechat' ? '微信支付' : '支付宝'}</div>
+            ${substitutions.map(sub => `
+            <div class="order-detail"><strong>替换商品:</strong> ${sub.goodsName} x${sub.quantity} → ${sub.substituteName || sub.substitute} x${sub.substituteQuantity}</div>
+            `).join('')}
             <div class="order-detail" style="margin-top: 15px; color: #4CAF50; font-weight: 600;">
                 请前往山姆APP完成支付！
             </div>